@@ -0,0 +1,14 @@
+package database
+
+// AfterCommit registers f to run once the transaction db belongs to has
+// committed, e.g. to publish an event only for writes that became visible.
+// f does not run if the transaction rolls back; hooks registered in a
+// savepoint that was rolled back still run. Outside a transaction f runs
+// at once.
+func (db *DB) AfterCommit(f func()) {
+	if db.tx == nil {
+		f()
+		return
+	}
+	*db.afterCommit = append(*db.afterCommit, f)
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+)
+
+// WithApplicationName sets application_name on every new connection, so
+// pg_stat_activity shows which service owns each session. Behind a
+// transaction-mode pooler (WithPgBouncerMode) put it in the DSN instead.
+func WithApplicationName(name string) Option {
+	return func(db *DB) {
+		db.appName = name
+	}
+}
+
+type appTagKey struct{}
+
+// WithAppTag returns a context whose transactions set application_name to
+// tag, appended to the WithApplicationName name as "name/tag", for their
+// duration. It identifies the component behind a transaction, e.g.
+// "checkout-worker".
+func WithAppTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, appTagKey{}, tag)
+}
+
+func appTagFrom(ctx context.Context) string {
+	tag, _ := ctx.Value(appTagKey{}).(string)
+	return tag
+}
+
+// applyAppTag sets the transaction's application_name from ctx. db is the
+// transaction's DB.
+func (db *DB) applyAppTag(ctx context.Context) error {
+	tag := appTagFrom(ctx)
+	if tag == "" {
+		return nil
+	}
+	if db.appName != "" {
+		tag = db.appName + "/" + tag
+	}
+	return db.SetLocal(ctx, "application_name", tag)
+}
+
+// setApplicationName sets application_name on a new driver connection.
+func (db *DB) setApplicationName(ctx context.Context, conn driver.Conn) error {
+	if db.appName == "" || db.pgBouncer {
+		return nil
+	}
+	ex, ok := conn.(driver.ExecerContext)
+	if !ok {
+		return errors.New("database: WithApplicationName: driver does not implement driver.ExecerContext")
+	}
+	_, err := ex.ExecContext(ctx, `SELECT set_config('application_name', $1, false)`,
+		[]driver.NamedValue{{Ordinal: 1, Value: db.appName}})
+	return err
+}
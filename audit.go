@@ -0,0 +1,32 @@
+package database
+
+import (
+	"context"
+	"reflect"
+)
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx naming the user or service acting, which
+// Insert and Update write to the `createdby` and `updatedby` fields.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor set by WithActor.
+func ActorFrom(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorKey{}).(string)
+	return actor, ok
+}
+
+// fieldValue returns the value to write for field f of v: the actor for
+// the `createdby` and `updatedby` fields when ctx names one, and the field
+// itself otherwise.
+func fieldValue(ctx context.Context, v reflect.Value, f field) interface{} {
+	if f.opts["createdby"] || f.opts["updatedby"] {
+		if actor, ok := ActorFrom(ctx); ok {
+			return actor
+		}
+	}
+	return v.FieldByIndex(f.index).Interface()
+}
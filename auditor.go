@@ -0,0 +1,252 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Auditor records every insert, update and delete on registered tables in
+// an audit table, with the row before and after as jsonb and the actor
+// (WithActor) and request ID (WithRequestID) of the transaction. Triggers
+// do the recording, so writes made outside this package are audited too;
+// writes outside a Transaction have no actor or request ID.
+type Auditor struct {
+	db    *DB
+	table string
+}
+
+// NewAuditor returns an Auditor recording into table, "audit_log" if
+// empty.
+func NewAuditor(db *DB, table string) *Auditor {
+	if table == "" {
+		table = "audit_log"
+	}
+	return &Auditor{db: db, table: table}
+}
+
+// The transaction settings the audit trigger reads.
+const (
+	auditActorSetting     = "app.actor"
+	auditRequestIDSetting = "app.request_id"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID that an
+// Auditor records for the writes of its transactions.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// applyAuditContext makes the actor and request ID in ctx visible to the
+// audit trigger. db is the transaction's DB.
+func (db *DB) applyAuditContext(ctx context.Context) error {
+	if actor, ok := ActorFrom(ctx); ok {
+		if err := db.SetLocal(ctx, auditActorSetting, actor); err != nil {
+			return err
+		}
+	}
+	if id := requestIDFrom(ctx); id != "" {
+		return db.SetLocal(ctx, auditRequestIDSetting, id)
+	}
+	return nil
+}
+
+func (a *Auditor) function() string {
+	return quoteIdent(a.table + "_trigger")
+}
+
+// Install creates the audit table and the trigger function if they do not
+// exist.
+func (a *Auditor) Install(ctx context.Context) error {
+	table := quoteIdent(a.table)
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS ` + table + ` (
+			id bigserial PRIMARY KEY,
+			table_name text NOT NULL,
+			operation text NOT NULL,
+			old_row jsonb,
+			new_row jsonb,
+			actor text,
+			request_id text,
+			changed_at timestamptz NOT NULL DEFAULT now()
+		)`,
+		`CREATE OR REPLACE FUNCTION ` + a.function() + `() RETURNS trigger LANGUAGE plpgsql AS $$
+		BEGIN
+			INSERT INTO ` + table + ` (table_name, operation, old_row, new_row, actor, request_id)
+			VALUES (
+				TG_TABLE_SCHEMA || '.' || TG_TABLE_NAME,
+				TG_OP,
+				CASE WHEN TG_OP IN ('UPDATE', 'DELETE') THEN to_jsonb(OLD) END,
+				CASE WHEN TG_OP IN ('INSERT', 'UPDATE') THEN to_jsonb(NEW) END,
+				nullif(current_setting('` + auditActorSetting + `', true), ''),
+				nullif(current_setting('` + auditRequestIDSetting + `', true), '')
+			);
+			RETURN NULL;
+		END
+		$$`,
+	}
+	return a.db.Transaction(ctx, sql.LevelDefault, func(tx *DB) error {
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("Auditor.Install(): %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// trigger returns the name of the audit trigger on a table.
+func (a *Auditor) trigger() string {
+	name := a.table
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	return pq.QuoteIdentifier(name)
+}
+
+// Register starts auditing tables, replacing their audit triggers if they
+// already have one. Install must have run.
+func (a *Auditor) Register(ctx context.Context, tables ...string) error {
+	return a.db.Transaction(ctx, sql.LevelDefault, func(tx *DB) error {
+		for _, t := range tables {
+			stmts := []string{
+				`DROP TRIGGER IF EXISTS ` + a.trigger() + ` ON ` + quoteIdent(t),
+				`CREATE TRIGGER ` + a.trigger() + ` AFTER INSERT OR UPDATE OR DELETE ON ` + quoteIdent(t) +
+					` FOR EACH ROW EXECUTE PROCEDURE ` + a.function() + `()`,
+			}
+			for _, stmt := range stmts {
+				if _, err := tx.Exec(ctx, stmt); err != nil {
+					return fmt.Errorf("Auditor.Register(%s): %w", t, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Unregister stops auditing tables. Their recorded history is kept.
+func (a *Auditor) Unregister(ctx context.Context, tables ...string) error {
+	for _, t := range tables {
+		if _, err := a.db.Exec(ctx, `DROP TRIGGER IF EXISTS `+a.trigger()+` ON `+quoteIdent(t)); err != nil {
+			return fmt.Errorf("Auditor.Unregister(%s): %w", t, err)
+		}
+	}
+	return nil
+}
+
+// AuditEntry is one change recorded by an Auditor.
+type AuditEntry struct {
+	ID        int64
+	Table     string
+	Operation string
+	// Old and New are the row before and after the change as JSON, nil for
+	// inserts and deletes respectively.
+	Old       json.RawMessage
+	New       json.RawMessage
+	Actor     string
+	RequestID string
+	ChangedAt time.Time
+}
+
+// auditRowQuery selects the changes to the row of table $1 whose columns
+// include those of the jsonb object $2.
+const auditRowQuery = `SELECT id, table_name, operation, old_row, new_row, coalesce(actor, ''), coalesce(request_id, ''), changed_at
+	FROM %s
+	WHERE table_name = (SELECT n.nspname || '.' || c.relname FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace WHERE c.oid = to_regclass($1))
+	AND coalesce(new_row, old_row) @> $2::jsonb`
+
+// History returns the recorded changes to the row of table identified by
+// key, column values such as {"id": 42}, oldest first.
+func (a *Auditor) History(ctx context.Context, table string, key map[string]interface{}) ([]AuditEntry, error) {
+	k, err := json.Marshal(key)
+	if err != nil {
+		return nil, fmt.Errorf("Auditor.History(%s): %w", table, err)
+	}
+	rows, err := a.db.Query(ctx, fmt.Sprintf(auditRowQuery, quoteIdent(a.table))+` ORDER BY changed_at, id`, table, string(k))
+	if err != nil {
+		return nil, fmt.Errorf("Auditor.History(%s): %w", table, err)
+	}
+	defer rows.Close()
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var oldRow, newRow []byte
+		if err := rows.Scan(&e.ID, &e.Table, &e.Operation, &oldRow, &newRow, &e.Actor, &e.RequestID, &e.ChangedAt); err != nil {
+			return nil, fmt.Errorf("Auditor.History(%s): %w", table, err)
+		}
+		if oldRow != nil {
+			e.Old = json.RawMessage(oldRow)
+		}
+		if newRow != nil {
+			e.New = json.RawMessage(newRow)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Auditor.History(%s): %w", table, err)
+	}
+	return entries, nil
+}
+
+// AsOf reconstructs the row of table identified by key as it was at time
+// at from the recorded changes, and stores it in dest: a pointer to a
+// struct, matched by `db` tags, or to a map[string]interface{}. It returns
+// sql.ErrNoRows if the row did not exist then, or was not yet audited.
+func (a *Auditor) AsOf(ctx context.Context, table string, key map[string]interface{}, at time.Time, dest interface{}) error {
+	k, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("Auditor.AsOf(%s): %w", table, err)
+	}
+	var row []byte
+	err = a.db.QueryRow(ctx, `SELECT new_row FROM (`+fmt.Sprintf(auditRowQuery, quoteIdent(a.table))+
+		` AND changed_at <= $3 ORDER BY changed_at DESC, id DESC LIMIT 1) AS last`, table, string(k), at).Scan(&row)
+	if err == sql.ErrNoRows || (err == nil && row == nil) {
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("Auditor.AsOf(%s): %w", table, err)
+	}
+	if err := decodeRow(row, dest); err != nil {
+		return fmt.Errorf("Auditor.AsOf(%s): %w", table, err)
+	}
+	return nil
+}
+
+// decodeRow decodes a row image into dest, matching struct fields by their
+// `db` tags.
+func decodeRow(row []byte, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("dest must be a non-nil pointer, got %T", dest)
+	}
+	if !isStructDest(v.Elem().Type()) {
+		return json.Unmarshal(row, dest)
+	}
+	var cols map[string]json.RawMessage
+	if err := json.Unmarshal(row, &cols); err != nil {
+		return err
+	}
+	for _, f := range structFields(v.Elem().Type()) {
+		raw, ok := cols[f.column]
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(raw, v.Elem().FieldByIndex(f.index).Addr().Interface()); err != nil {
+			return fmt.Errorf("column %s: %w", f.column, err)
+		}
+	}
+	return nil
+}
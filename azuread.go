@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// azureDBResource is the Azure AD resource of Azure Database for PostgreSQL.
+const azureDBResource = "https://ossrdbms-aad.database.windows.net"
+
+// AzureToken is an Azure AD access token.
+type AzureToken struct {
+	AccessToken string
+	ExpiresAt   time.Time
+}
+
+type AzureADConfig struct {
+	// User is the Azure AD user, group or managed identity name the server
+	// knows the principal as.
+	User string
+	// Token acquires an access token for resource, e.g. from the Azure SDK's
+	// DefaultAzureCredential. Defaults to AzureManagedIdentityToken("").
+	Token func(ctx context.Context, resource string) (AzureToken, error)
+	// RefreshBefore is how long before it expires a token is replaced.
+	// Defaults to 5 minutes.
+	RefreshBefore time.Duration
+}
+
+// AzureADCredentials returns a CredentialsProvider that authenticates with
+// Azure AD access tokens for Azure Database for PostgreSQL, acquiring a new
+// one before the current one expires. The connections must use TLS.
+func AzureADCredentials(cfg AzureADConfig) CredentialsProvider {
+	if cfg.Token == nil {
+		cfg.Token = AzureManagedIdentityToken("")
+	}
+	if cfg.RefreshBefore <= 0 {
+		cfg.RefreshBefore = 5 * time.Minute
+	}
+	var (
+		mu    sync.Mutex
+		token AzureToken
+	)
+	return func(ctx context.Context) (string, string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if token.AccessToken != "" && time.Until(token.ExpiresAt) > cfg.RefreshBefore {
+			return cfg.User, token.AccessToken, nil
+		}
+		t, err := cfg.Token(ctx, azureDBResource)
+		if err != nil {
+			return "", "", fmt.Errorf("Azure AD token: %w", err)
+		}
+		token = t
+		return cfg.User, token.AccessToken, nil
+	}
+}
+
+// AzureManagedIdentityToken returns a function that gets tokens from the
+// instance metadata service of an Azure VM, App Service or AKS pod with a
+// managed identity. clientID selects a user-assigned identity; "" uses the
+// system-assigned one.
+func AzureManagedIdentityToken(clientID string) func(ctx context.Context, resource string) (AzureToken, error) {
+	return func(ctx context.Context, resource string) (AzureToken, error) {
+		q := url.Values{"api-version": {"2018-02-01"}, "resource": {resource}}
+		if clientID != "" {
+			q.Set("client_id", clientID)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+			"http://169.254.169.254/metadata/identity/oauth2/token?"+q.Encode(), nil)
+		if err != nil {
+			return AzureToken{}, err
+		}
+		req.Header.Set("Metadata", "true")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return AzureToken{}, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return AzureToken{}, fmt.Errorf("managed identity endpoint: %s", resp.Status)
+		}
+		var body struct {
+			AccessToken string `json:"access_token"`
+			ExpiresOn   string `json:"expires_on"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return AzureToken{}, fmt.Errorf("managed identity endpoint: %w", err)
+		}
+		expires, err := strconv.ParseInt(body.ExpiresOn, 10, 64)
+		if err != nil {
+			return AzureToken{}, fmt.Errorf("managed identity endpoint: expires_on %q: %w", body.ExpiresOn, err)
+		}
+		return AzureToken{AccessToken: body.AccessToken, ExpiresAt: time.Unix(expires, 0)}, nil
+	}
+}
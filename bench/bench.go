@@ -0,0 +1,275 @@
+// Package bench runs a weighted mix of queries and transactions against a
+// database at a fixed concurrency and reports latency percentiles, error and
+// retry rates, to tune pool and retry settings with data.
+//
+//	report, err := bench.Run(ctx, db, bench.Config{
+//		Concurrency: 32,
+//		Duration:    time.Minute,
+//		Workloads: []bench.Workload{
+//			{Name: "lookup", Weight: 9, Op: bench.Query(`SELECT * FROM users WHERE id = $1`, 42)},
+//			{Name: "transfer", Weight: 1, Op: bench.Transaction(sql.LevelSerializable, transfer)},
+//		},
+//	})
+//	fmt.Println(report)
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkrypt0987/database"
+)
+
+// Op is one benchmarked operation.
+type Op func(ctx context.Context, db *database.DB) error
+
+// Query returns an Op that runs query and reads all of its rows.
+func Query(query string, args ...interface{}) Op {
+	return func(ctx context.Context, db *database.DB) error {
+		rows, err := db.Query(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+		}
+		return rows.Err()
+	}
+}
+
+// Exec returns an Op that executes a statement.
+func Exec(query string, args ...interface{}) Op {
+	return func(ctx context.Context, db *database.DB) error {
+		_, err := db.Exec(ctx, query, args...)
+		return err
+	}
+}
+
+type attemptsKey struct{}
+
+// Transaction returns an Op that runs f in a transaction. Each extra call of
+// f made by the retry loop is counted as a retry.
+func Transaction(iso sql.IsolationLevel, f func(ctx context.Context, tx *database.DB) error) Op {
+	return func(ctx context.Context, db *database.DB) error {
+		attempts, _ := ctx.Value(attemptsKey{}).(*int)
+		return db.Transaction(ctx, iso, func(tx *database.DB) error {
+			if attempts != nil {
+				*attempts++
+			}
+			return f(ctx, tx)
+		})
+	}
+}
+
+type Workload struct {
+	Name string
+	// Weight is the relative frequency of the workload in the mix.
+	Weight int
+	Op     Op
+}
+
+type Config struct {
+	// Concurrency is the number of concurrent workers. Defaults to 1.
+	Concurrency int
+	// Duration bounds the run; zero means until ctx is done or Operations
+	// have run.
+	Duration time.Duration
+	// Operations bounds the total number of operations; zero means no bound.
+	Operations int
+	Workloads  []Workload
+	// Seed makes the workload selection reproducible.
+	Seed int64
+}
+
+// Stats summarizes the operations of one workload.
+type Stats struct {
+	Name       string
+	Operations int
+	Errors     int
+	Retries    int
+	Mean       time.Duration
+	P50        time.Duration
+	P90        time.Duration
+	P95        time.Duration
+	P99        time.Duration
+	Max        time.Duration
+}
+
+// ErrorRate is the fraction of operations that failed.
+func (s Stats) ErrorRate() float64 {
+	if s.Operations == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Operations)
+}
+
+// RetryRate is the average number of retries per operation.
+func (s Stats) RetryRate() float64 {
+	if s.Operations == 0 {
+		return 0
+	}
+	return float64(s.Retries) / float64(s.Operations)
+}
+
+type Report struct {
+	Elapsed   time.Duration
+	Total     Stats
+	Workloads []Stats
+}
+
+// Throughput is the number of operations per second.
+func (r *Report) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Total.Operations) / r.Elapsed.Seconds()
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d ops in %s (%.1f ops/s)\n", r.Total.Operations, r.Elapsed.Round(time.Millisecond), r.Throughput())
+	fmt.Fprintf(&b, "%-16s %8s %7s %7s %10s %10s %10s %10s %10s\n", "workload", "ops", "err%", "retry", "mean", "p50", "p95", "p99", "max")
+	for _, s := range append(r.Workloads, r.Total) {
+		fmt.Fprintf(&b, "%-16s %8d %6.2f%% %7.3f %10s %10s %10s %10s %10s\n",
+			s.Name, s.Operations, 100*s.ErrorRate(), s.RetryRate(),
+			s.Mean.Round(time.Microsecond), s.P50.Round(time.Microsecond), s.P95.Round(time.Microsecond),
+			s.P99.Round(time.Microsecond), s.Max.Round(time.Microsecond))
+	}
+	return b.String()
+}
+
+type sample struct {
+	workload int
+	latency  time.Duration
+	retries  int
+	failed   bool
+}
+
+// Run executes the workload mix until Duration elapses, Operations have run
+// or ctx is done, whichever comes first.
+func Run(ctx context.Context, db *database.DB, cfg Config) (*Report, error) {
+	if len(cfg.Workloads) == 0 {
+		return nil, errors.New("bench.Run(): no workloads")
+	}
+	total := 0
+	for _, w := range cfg.Workloads {
+		if w.Weight < 0 || w.Op == nil {
+			return nil, fmt.Errorf("bench.Run(): invalid workload %q", w.Name)
+		}
+		total += w.Weight
+	}
+	if total == 0 {
+		return nil, errors.New("bench.Run(): workload weights sum to zero")
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	var (
+		mu      sync.Mutex
+		samples []sample
+		started int
+		wg      sync.WaitGroup
+	)
+	// next reserves an operation slot, reporting false when the run is over.
+	next := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if cfg.Operations > 0 && started >= cfg.Operations {
+			return false
+		}
+		started++
+		return true
+	}
+
+	start := time.Now()
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		rnd := rand.New(rand.NewSource(cfg.Seed + int64(i)))
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil && next() {
+				w := pick(rnd, cfg.Workloads, total)
+				attempts := 0
+				opCtx := context.WithValue(ctx, attemptsKey{}, &attempts)
+				t := time.Now()
+				err := cfg.Workloads[w].Op(opCtx, db)
+				s := sample{workload: w, latency: time.Since(t), failed: err != nil}
+				if ctx.Err() != nil && err != nil {
+					// Cut off by the end of the run, not a real failure.
+					return
+				}
+				if attempts > 1 {
+					s.retries = attempts - 1
+				}
+				mu.Lock()
+				samples = append(samples, s)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	r := &Report{Elapsed: time.Since(start)}
+	all := make([]sample, 0, len(samples))
+	for i, w := range cfg.Workloads {
+		var ws []sample
+		for _, s := range samples {
+			if s.workload == i {
+				ws = append(ws, s)
+			}
+		}
+		all = append(all, ws...)
+		r.Workloads = append(r.Workloads, summarize(w.Name, ws))
+	}
+	r.Total = summarize("total", all)
+	return r, nil
+}
+
+func pick(rnd *rand.Rand, ws []Workload, total int) int {
+	n := rnd.Intn(total)
+	for i, w := range ws {
+		if n < w.Weight {
+			return i
+		}
+		n -= w.Weight
+	}
+	return len(ws) - 1
+}
+
+func summarize(name string, ss []sample) Stats {
+	st := Stats{Name: name, Operations: len(ss)}
+	if len(ss) == 0 {
+		return st
+	}
+	lat := make([]time.Duration, len(ss))
+	var sum time.Duration
+	for i, s := range ss {
+		lat[i] = s.latency
+		sum += s.latency
+		st.Retries += s.retries
+		if s.failed {
+			st.Errors++
+		}
+	}
+	sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+	pct := func(p float64) time.Duration {
+		return lat[int(p*float64(len(lat)-1))]
+	}
+	st.Mean = sum / time.Duration(len(lat))
+	st.P50, st.P90, st.P95, st.P99 = pct(0.50), pct(0.90), pct(0.95), pct(0.99)
+	st.Max = lat[len(lat)-1]
+	return st
+}
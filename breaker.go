@@ -0,0 +1,198 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the database while the
+// circuit breaker is open.
+var ErrCircuitOpen = errors.New("database: circuit breaker open")
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the
+	// circuit. Defaults to 5.
+	FailureThreshold int
+	// OpenDuration is how long the circuit stays open before letting probes
+	// through. Defaults to 30 seconds.
+	OpenDuration time.Duration
+	// HalfOpenProbes is the number of concurrent probes allowed while half
+	// open; that many successes close the circuit. Defaults to 1.
+	HalfOpenProbes int
+	// IsFailure reports whether an error means the database is unavailable.
+	// By default only connection-level errors are failures: broken or reset
+	// connections, network errors and SQLSTATE classes 08 and 57 but
+	// 57014 (query_canceled, a statement timeout or cancellation). Other
+	// errors reported by the server (constraint violations, serialization
+	// failures, ...), sql.ErrNoRows, context errors and the errors of
+	// Transaction callbacks are not.
+	IsFailure func(error) bool
+	// OnStateChange is called after each state transition.
+	OnStateChange func(from, to BreakerState)
+}
+
+// WithCircuitBreaker makes Exec, Query, QueryRow and Transaction fail fast
+// with ErrCircuitOpen after repeated failures, until probes succeed again.
+func WithCircuitBreaker(cfg BreakerConfig) Option {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenDuration <= 0 {
+		cfg.OpenDuration = 30 * time.Second
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 1
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = isUnavailable
+	}
+	return func(db *DB) {
+		db.breaker = &breaker{cfg: cfg}
+		db.guards = append(db.guards, db.breaker)
+	}
+}
+
+// BreakerState returns the circuit breaker state, BreakerClosed if there is
+// no breaker.
+func (db *DB) BreakerState() BreakerState {
+	if db.breaker == nil {
+		return BreakerClosed
+	}
+	db.breaker.mu.Lock()
+	defer db.breaker.mu.Unlock()
+	return db.breaker.state
+}
+
+type breaker struct {
+	cfg BreakerConfig
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probes    int
+	successes int
+	// changes are transitions to report once mu is released.
+	changes [][2]BreakerState
+}
+
+// locked runs f with b.mu held and then reports any state changes, so that
+// OnStateChange may call back into the DB.
+func (b *breaker) locked(f func()) {
+	b.mu.Lock()
+	f()
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+	if b.cfg.OnStateChange != nil {
+		for _, c := range changes {
+			b.cfg.OnStateChange(c[0], c[1])
+		}
+	}
+}
+
+func (b *breaker) enter(ctx context.Context) (context.Context, func(error), error) {
+	var exit func(error)
+	b.locked(func() {
+		if b.state == BreakerOpen {
+			if time.Since(b.openedAt) < b.cfg.OpenDuration {
+				return
+			}
+			b.setState(BreakerHalfOpen)
+		}
+		if b.state == BreakerHalfOpen {
+			if b.probes < b.cfg.HalfOpenProbes {
+				b.probes++
+				exit = b.exitProbe
+			}
+			return
+		}
+		exit = b.exit
+	})
+	if exit == nil {
+		return ctx, nil, ErrCircuitOpen
+	}
+	return ctx, exit, nil
+}
+
+func (b *breaker) exit(err error) {
+	if err == errNotRun {
+		return
+	}
+	b.locked(func() {
+		if err == nil || !b.cfg.IsFailure(err) {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.state == BreakerClosed && b.failures >= b.cfg.FailureThreshold {
+			b.open()
+		}
+	})
+}
+
+func (b *breaker) exitProbe(err error) {
+	b.locked(func() {
+		b.probes--
+		if err == errNotRun || b.state != BreakerHalfOpen {
+			return
+		}
+		if err != nil && b.cfg.IsFailure(err) {
+			b.open()
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenProbes {
+			b.failures = 0
+			b.setState(BreakerClosed)
+		}
+	})
+}
+
+func (b *breaker) open() {
+	b.openedAt = time.Now()
+	b.setState(BreakerOpen)
+}
+
+// setState must be called with b.mu held.
+func (b *breaker) setState(s BreakerState) {
+	if b.state == s {
+		return
+	}
+	b.changes = append(b.changes, [2]BreakerState{b.state, s})
+	b.state = s
+	b.successes = 0
+}
+
+// isUnavailable is the default BreakerConfig.IsFailure. Only errors of the
+// connection itself count: errors the server reports about a statement, and
+// the caller's own errors and deadlines, say nothing about its
+// availability.
+func isUnavailable(err error) bool {
+	if code := SQLState(err); code != "" {
+		return len(code) == 5 && (code[:2] == "08" || (code[:2] == "57" && code != "57014"))
+	}
+	return isConnError(err)
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	pgconn5 "github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+// errorCases are shared by TestIsUnavailable and TestRetryable.
+var errorCases = []struct {
+	name        string
+	err         error
+	unavailable bool
+	retryable   bool
+}{
+	{"nil", nil, false, false},
+	{"bad conn", driver.ErrBadConn, true, true},
+	{"wrapped EOF", fmt.Errorf("read: %w", io.EOF), true, true},
+	{"unexpected EOF", io.ErrUnexpectedEOF, true, true},
+	{"connection reset", syscall.ECONNRESET, true, true},
+	{"net error", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("refused")}, true, true},
+	{"connection failure", &pq.Error{Code: "08006"}, true, true},
+	{"admin shutdown", &pgconn.PgError{Code: "57P01"}, true, true},
+	{"cannot connect now", &pgconn5.PgError{Code: "57P03"}, true, true},
+	{"query canceled", &pq.Error{Code: "57014"}, false, false},
+	{"read only", &pq.Error{Code: "25006"}, false, true},
+	{"serialization failure", &pgconn5.PgError{Code: serializationFailureCode}, false, true},
+	{"deadlock", &pgconn.PgError{Code: "40P01"}, false, true},
+	{"unique violation", &pq.Error{Code: "23505"}, false, false},
+	{"no rows", sql.ErrNoRows, false, false},
+	{"canceled", context.Canceled, false, false},
+	{"deadline", fmt.Errorf("Exec(): %w", context.DeadlineExceeded), false, false},
+	{"retry budget", ErrRetryBudgetExhausted, false, false},
+	{"other", errors.New("boom"), false, false},
+}
+
+func TestIsUnavailable(t *testing.T) {
+	for _, c := range errorCases {
+		if got := isUnavailable(c.err); got != c.unavailable {
+			t.Errorf("%s: isUnavailable(%v) = %v, want %v", c.name, c.err, got, c.unavailable)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	for _, c := range errorCases {
+		if got := Retryable(c.err); got != c.retryable {
+			t.Errorf("%s: Retryable(%v) = %v, want %v", c.name, c.err, got, c.retryable)
+		}
+	}
+}
+
+func TestGuardError(t *testing.T) {
+	conn := &pq.Error{Code: "08006"}
+	for _, c := range []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"nil", nil, nil},
+		{"callback", fmt.Errorf("Transaction(Default): %w", &callbackError{conn}), nil},
+		{"panic", &PanicError{Value: "boom"}, nil},
+		{"begin", fmt.Errorf("conn.BeginTx(): %w", conn), conn},
+		{"callback and rollback", errors.Join(&callbackError{errors.New("boom")}, conn), conn},
+	} {
+		if got := guardError(c.err); !errors.Is(got, c.want) || (got == nil) != (c.want == nil) {
+			t.Errorf("%s: guardError(%v) = %v, want %v", c.name, c.err, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package database
+
+import "context"
+
+// WithBulkhead caps the number of concurrent top-level operations of the
+// workload (see WithWorkload) at max, so one heavy workload cannot take the
+// whole pool. Callers over the cap wait for a slot or for their context.
+// The workload "" covers operations without a workload. A Query, like a
+// QueryRow, holds its slot until its rows are closed, as they hold its
+// connection. Zero or less for max means no cap.
+func WithBulkhead(workload string, max int) Option {
+	return func(db *DB) {
+		if max <= 0 {
+			delete(db.bulkheads, workload)
+			return
+		}
+		if db.bulkheads == nil {
+			db.bulkheads = bulkheads{}
+			db.guards = append(db.guards, db.bulkheads)
+		}
+		db.bulkheads[workload] = make(chan struct{}, max)
+	}
+}
+
+// WithDefaultWorkload assigns operations whose context names no workload to
+// the given one.
+func WithDefaultWorkload(workload string) Option {
+	return func(db *DB) {
+		db.defaultWorkload = workload
+	}
+}
+
+// bulkheads maps workloads to semaphores.
+type bulkheads map[string]chan struct{}
+
+func (b bulkheads) enter(ctx context.Context) (context.Context, func(error), error) {
+	sem, ok := b[workloadFrom(ctx)]
+	if !ok {
+		return ctx, func(error) {}, nil
+	}
+	select {
+	case sem <- struct{}{}:
+		return ctx, func(error) { <-sem }, nil
+	case <-ctx.Done():
+		return ctx, nil, ctx.Err()
+	}
+}
@@ -0,0 +1,39 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pkrypt0987/database"
+	"github.com/pkrypt0987/database/fakedb"
+)
+
+func TestBulkhead(t *testing.T) {
+	f := fakedb.New()
+	f.On(`^SELECT`).Return([]string{"n"}, []interface{}{int64(1)})
+	db := f.DB(t, database.WithBulkhead("reports", 1), database.WithBulkhead("", 0))
+	ctx := context.Background()
+
+	rows, err := db.Query(database.WithWorkload(ctx, "reports"), "SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The open rows hold the workload's only slot.
+	short, cancel := context.WithTimeout(database.WithWorkload(ctx, "reports"), 10*time.Millisecond)
+	defer cancel()
+	if _, err := db.Exec(short, "SELECT 1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("second report: err = %v, want it to wait until the deadline", err)
+	}
+	// No cap for the workload "", as max is 0.
+	for i := 0; i < 3; i++ {
+		if _, err := db.Exec(ctx, "SELECT 1"); err != nil {
+			t.Errorf("uncapped workload: %v", err)
+		}
+	}
+	rows.Close()
+	if _, err := db.Exec(database.WithWorkload(ctx, "reports"), "SELECT 1"); err != nil {
+		t.Errorf("after the rows were closed: %v", err)
+	}
+}
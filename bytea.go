@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/lib/pq"
+)
+
+// byteaChunk is the default chunk size of ByteaReader and ByteaWriter.
+const byteaChunk = 1 << 20
+
+// byteaTarget is the bytea column of one row.
+type byteaTarget struct {
+	db     *DB
+	ctx    context.Context
+	table  string
+	column string
+	key    string
+	id     interface{}
+	chunk  int
+}
+
+func (t *byteaTarget) describe() string {
+	return fmt.Sprintf("%s.%s %v", t.table, t.column, t.id)
+}
+
+// ByteaReader reads a bytea value in chunks of substring windows, so it
+// is never held in memory whole. Set the column's storage to EXTERNAL
+// (ALTER TABLE ... ALTER COLUMN ... SET STORAGE EXTERNAL) so the server
+// can read a window without decompressing the whole value.
+type ByteaReader struct {
+	byteaTarget
+	off int64
+}
+
+// NewByteaReader returns a reader of column of the row of table whose
+// keyColumn is id, reading chunkSize bytes per query, 1MB if 0. A NULL
+// value reads as empty. Use it in a REPEATABLE READ transaction if the
+// value may change while it is read.
+func (db *DB) NewByteaReader(ctx context.Context, table, column, keyColumn string, id interface{}, chunkSize int) *ByteaReader {
+	if chunkSize <= 0 {
+		chunkSize = byteaChunk
+	}
+	return &ByteaReader{byteaTarget: byteaTarget{db: db, ctx: ctx, table: table, column: column, key: keyColumn, id: id, chunk: chunkSize}}
+}
+
+func (r *ByteaReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n := len(p)
+	if n > r.chunk {
+		n = r.chunk
+	}
+	var b []byte
+	err := r.db.QueryRow(r.ctx, fmt.Sprintf(`SELECT substring(%s FROM $1 FOR $2) FROM %s WHERE %s = $3`,
+		pq.QuoteIdentifier(r.column), quoteIdent(r.table), pq.QuoteIdentifier(r.key)), r.off+1, n, r.id).Scan(&b)
+	if err != nil {
+		return 0, fmt.Errorf("ByteaReader.Read(%s): %w", r.describe(), err)
+	}
+	if len(b) == 0 {
+		return 0, io.EOF
+	}
+	r.off += int64(len(b))
+	return copy(p, b), nil
+}
+
+// ByteaWriter writes a bytea value in chunks: the first chunk replaces the
+// column's value and each later one is appended to it. Every append
+// rewrites the stored value, so prefer a large chunk size. Use it in a
+// transaction so readers never see a partly written value.
+type ByteaWriter struct {
+	byteaTarget
+	buf     []byte
+	written bool
+}
+
+// NewByteaWriter returns a writer of column of the row of table whose
+// keyColumn is id, sending chunkSize bytes per statement, 1MB if 0. Close
+// writes the rest.
+func (db *DB) NewByteaWriter(ctx context.Context, table, column, keyColumn string, id interface{}, chunkSize int) *ByteaWriter {
+	if chunkSize <= 0 {
+		chunkSize = byteaChunk
+	}
+	return &ByteaWriter{byteaTarget: byteaTarget{db: db, ctx: ctx, table: table, column: column, key: keyColumn, id: id, chunk: chunkSize}}
+}
+
+func (w *ByteaWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		m := w.chunk - len(w.buf)
+		if m > len(p) {
+			m = len(p)
+		}
+		w.buf = append(w.buf, p[:m]...)
+		p = p[m:]
+		if len(w.buf) == w.chunk {
+			if err := w.flush(); err != nil {
+				return n - len(p) - len(w.buf), err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close writes the buffered bytes, or an empty value if nothing was
+// written.
+func (w *ByteaWriter) Close() error {
+	if len(w.buf) > 0 || !w.written {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *ByteaWriter) flush() error {
+	col := pq.QuoteIdentifier(w.column)
+	set := col + ` = $1`
+	if w.written {
+		set = col + ` = ` + col + ` || $1`
+	}
+	chunk := w.buf
+	if chunk == nil {
+		// Not NULL: Close of an empty writer stores an empty value.
+		chunk = []byte{}
+	}
+	n, err := w.db.Exec(w.ctx, `UPDATE `+quoteIdent(w.table)+` SET `+set+` WHERE `+pq.QuoteIdentifier(w.key)+` = $2`, chunk, w.id)
+	if err == nil && n == 0 {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("ByteaWriter.Write(%s): %w", w.describe(), err)
+	}
+	w.written = true
+	w.buf = w.buf[:0]
+	return nil
+}
@@ -0,0 +1,371 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Cache stores query results for Cached. Implement it over Redis or
+// memcached to share results between instances; NewMemoryCache is the
+// in-process default.
+type Cache interface {
+	// Get returns the value stored under key, ok false if there is none or
+	// it expired.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// WithCache sets the Cache behind Cached. Defaults to NewMemoryCache(1000).
+func WithCache(c Cache) Option {
+	return func(db *DB) {
+		db.cache.cache = c
+	}
+}
+
+// WithCacheBroadcast makes InvalidateTags also send the invalidated tags
+// with NOTIFY on channel, so other instances running
+// ListenCacheInvalidations drop them from their own caches. A shared Cache
+// such as Redis does not need it.
+func WithCacheBroadcast(channel string) Option {
+	return func(db *DB) {
+		db.cache.channel = channel
+	}
+}
+
+// queryCache is shared by a DB and its transaction DBs.
+type queryCache struct {
+	cache   Cache
+	channel string
+
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a cache miss being loaded; concurrent misses of the same key
+// wait for it instead of querying too.
+type flight struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+// CachedDB runs reads through the DB's Cache; see Cached.
+type CachedDB struct {
+	db   *DB
+	ttl  time.Duration
+	tags []string
+}
+
+// Cached returns a view of db whose Get and Select serve results from the
+// cache for up to ttl, keyed by the query, its arguments and the
+// destination type, so hot reference data is read once per ttl. Concurrent
+// misses of the same key run the query once. Results are stored as JSON,
+// so destinations need exported, JSON-round-trippable fields. In a
+// transaction the cache is bypassed, as the transaction may see its own
+// uncommitted writes.
+func (db *DB) Cached(ttl time.Duration) *CachedDB {
+	return &CachedDB{db: db, ttl: ttl}
+}
+
+// Tags returns a copy of c whose results are also dropped when any of tags
+// is invalidated, by InvalidateTags or a write passed InvalidatesTags.
+func (c *CachedDB) Tags(tags ...string) *CachedDB {
+	cp := *c
+	cp.tags = append(append([]string(nil), c.tags...), tags...)
+	return &cp
+}
+
+func (c *CachedDB) Get(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return c.load(ctx, "Get", dest, query, args, c.db.Get)
+}
+
+func (c *CachedDB) Select(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return c.load(ctx, "Select", dest, query, args, c.db.Select)
+}
+
+func (c *CachedDB) load(ctx context.Context, op string, dest interface{}, query string, args []interface{}, run func(context.Context, interface{}, string, ...interface{}) error) error {
+	if c.db.tx != nil {
+		return run(ctx, dest, query, args...)
+	}
+	qc := c.db.cache
+	versions, err := qc.tagVersions(ctx, c.tags)
+	if err != nil {
+		// Without the tag versions a cached result may be stale.
+		return run(ctx, dest, query, args...)
+	}
+	key, err := cacheKey(op, dest, query, args, versions)
+	if err != nil {
+		return fmt.Errorf("Cached.%s(): %w", op, err)
+	}
+	if b, ok, err := qc.cache.Get(ctx, key); err == nil && ok {
+		if err := json.Unmarshal(b, dest); err == nil {
+			return nil
+		}
+	}
+	qc.mu.Lock()
+	if f, ok := qc.flights[key]; ok {
+		qc.mu.Unlock()
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if f.err != nil {
+			return f.err
+		}
+		return json.Unmarshal(f.value, dest)
+	}
+	// f.err stays set for the waiters if run panics.
+	f := &flight{done: make(chan struct{}), err: fmt.Errorf("Cached.%s(): query panicked", op)}
+	qc.flights[key] = f
+	qc.mu.Unlock()
+	defer func() {
+		qc.mu.Lock()
+		delete(qc.flights, key)
+		qc.mu.Unlock()
+		close(f.done)
+	}()
+
+	f.err = run(ctx, dest, query, args...)
+	if f.err == nil {
+		f.value, f.err = json.Marshal(dest)
+		if f.err == nil {
+			// A failing cache only costs the next caller a query.
+			qc.cache.Set(ctx, key, f.value, c.ttl)
+		}
+	}
+	return f.err
+}
+
+// cacheKey hashes what identifies a cached result, including the current
+// versions of its tags.
+func cacheKey(op string, dest interface{}, query string, args []interface{}, versions []string) (string, error) {
+	var keyArgs []interface{}
+	for _, a := range args {
+		if _, ok := a.(CallOption); !ok {
+			keyArgs = append(keyArgs, a)
+		}
+	}
+	b, err := json.Marshal(keyArgs)
+	if err != nil {
+		return "", fmt.Errorf("arguments not cacheable: %w", err)
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00", op, reflect.TypeOf(dest), query)
+	h.Write(b)
+	for _, v := range versions {
+		fmt.Fprintf(h, "\x00%s", v)
+	}
+	return "query:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Invalidating a tag replaces its version, which is part of the key of
+// every result carrying the tag, so the results are never read again and
+// age out of the cache; this works for any Cache without a tag index. A
+// version that was evicted is replaced the same way.
+const tagTTL = 7 * 24 * time.Hour
+
+func tagKey(tag string) string {
+	return "tag:" + tag
+}
+
+func newTagVersion() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// tagVersions returns the current versions of tags.
+func (qc *queryCache) tagVersions(ctx context.Context, tags []string) ([]string, error) {
+	versions := make([]string, len(tags))
+	for i, tag := range tags {
+		b, ok, err := qc.cache.Get(ctx, tagKey(tag))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			b = []byte(newTagVersion())
+			if err := qc.cache.Set(ctx, tagKey(tag), b, tagTTL); err != nil {
+				return nil, err
+			}
+		}
+		versions[i] = string(b)
+	}
+	return versions, nil
+}
+
+func (qc *queryCache) invalidate(ctx context.Context, tags []string) error {
+	for _, tag := range tags {
+		if err := qc.cache.Set(ctx, tagKey(tag), []byte(newTagVersion()), tagTTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InvalidatesTags makes an Exec invalidate the cache tags of the results
+// its write changes (see CachedDB.Tags) once it succeeds, or once its
+// transaction commits. A failing cache leaves the results until their ttl;
+// call InvalidateTags to see the error.
+func InvalidatesTags(tags ...string) CallOption {
+	return callOptionFunc(func(c *callConfig) { c.invalidates = append(c.invalidates, tags...) })
+}
+
+// invalidateWritten invalidates the tags the call in ctx was passed with
+// InvalidatesTags.
+func (db *DB) invalidateWritten(ctx context.Context) {
+	if cfg := callConfigFrom(ctx); cfg != nil && len(cfg.invalidates) > 0 {
+		db.InvalidateTags(ctx, cfg.invalidates...)
+	}
+}
+
+// InvalidateTags drops the cached results carrying any of tags. In a
+// transaction they are dropped after it commits, so a concurrent read
+// cannot cache the old data again in between; errors then are not
+// reported. With WithCacheBroadcast the tags are also sent to the other
+// instances.
+func (db *DB) InvalidateTags(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	if db.tx != nil {
+		ctx = context.WithoutCancel(ctx)
+		db.AfterCommit(func() { db.invalidateTags(ctx, tags) })
+		return nil
+	}
+	if err := db.invalidateTags(ctx, tags); err != nil {
+		return fmt.Errorf("InvalidateTags(): %w", err)
+	}
+	return nil
+}
+
+func (db *DB) invalidateTags(ctx context.Context, tags []string) error {
+	qc := db.cache
+	err := qc.invalidate(ctx, tags)
+	if qc.channel != "" {
+		// On the pool: a transaction's connection may be busy or done.
+		_, nerr := db.db.ExecContext(ctx, `SELECT pg_notify($1, t) FROM unnest($2::text[]) AS t`, qc.channel, pq.Array(tags))
+		if err == nil {
+			err = nerr
+		}
+	}
+	return err
+}
+
+// ListenCacheInvalidations receives the tags other instances invalidate
+// (see WithCacheBroadcast) and drops them from db's cache, until ctx is
+// done or the connection fails. Run it in a goroutine and restart it on
+// error; tags sent while it is not listening stay cached until their ttl.
+// It needs a DB opened with OpenPgx.
+func (db *DB) ListenCacheInvalidations(ctx context.Context) error {
+	qc := db.cache
+	if qc.channel == "" {
+		return errors.New("ListenCacheInvalidations(): no channel, see WithCacheBroadcast")
+	}
+	if db.pgxPool == nil {
+		return fmt.Errorf("ListenCacheInvalidations(): %w", errNotPgx)
+	}
+	pc, err := db.pgxPool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("ListenCacheInvalidations(): %w", err)
+	}
+	// The listening connection is not returned to the pool.
+	conn := pc.Hijack()
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(ctx, "LISTEN "+pq.QuoteIdentifier(qc.channel)); err != nil {
+		return fmt.Errorf("ListenCacheInvalidations(): %w", err)
+	}
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("ListenCacheInvalidations(): %w", err)
+		}
+		qc.invalidate(ctx, []string{n.Payload})
+	}
+}
+
+// memoryCache is an in-process LRU Cache.
+type memoryCache struct {
+	max int
+
+	mu      sync.Mutex
+	lru     *list.List // of *memoryEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryCache returns an in-process Cache holding up to maxEntries
+// results, evicting the least recently used.
+func NewMemoryCache(maxEntries int) Cache {
+	if maxEntries <= 0 {
+		maxEntries = 1000
+	}
+	return &memoryCache{max: maxEntries, lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *memoryCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*memoryEntry)
+	if time.Now().After(e.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.lru.MoveToFront(el)
+	return e.value, true, nil
+}
+
+func (c *memoryCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := &memoryEntry{key: key, value: value, expires: time.Now().Add(ttl)}
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return nil
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.max {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+func (c *memoryCache) Delete(_ context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := c.entries[key]; ok {
+			c.lru.Remove(el)
+			delete(c.entries, key)
+		}
+	}
+	return nil
+}
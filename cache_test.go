@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(2)
+	set := func(key string) {
+		if err := c.Set(ctx, key, []byte(key), time.Minute); err != nil {
+			t.Fatalf("Set(%s): %v", key, err)
+		}
+	}
+	has := func(key string) bool {
+		v, ok, err := c.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", key, err)
+		}
+		if ok && string(v) != key {
+			t.Fatalf("Get(%s) = %q", key, v)
+		}
+		return ok
+	}
+
+	set("a")
+	set("b")
+	has("a") // a is now more recently used than b
+	set("c")
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if got := has(key); got != want {
+			t.Errorf("after evicting: has(%s) = %v, want %v", key, got, want)
+		}
+	}
+
+	// Overwriting an entry neither grows the cache nor evicts another.
+	set("c")
+	for key, want := range map[string]bool{"a": true, "c": true} {
+		if got := has(key); got != want {
+			t.Errorf("after overwriting: has(%s) = %v, want %v", key, got, want)
+		}
+	}
+
+	if err := c.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	set("d")
+	for key, want := range map[string]bool{"a": false, "c": true, "d": true} {
+		if got := has(key); got != want {
+			t.Errorf("after deleting: has(%s) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(2)
+	c.Set(ctx, "a", []byte("a"), -time.Second)
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Error("expired entry returned")
+	}
+	if n := len(c.(*memoryCache).entries); n != 0 {
+		t.Errorf("%d entries left after expiry, want 0", n)
+	}
+}
@@ -0,0 +1,59 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkrypt0987/database/fakedb"
+)
+
+type country struct {
+	Code string `db:"code"`
+	Name string `db:"name"`
+}
+
+func TestCachedReadThrough(t *testing.T) {
+	f := fakedb.New()
+	f.On(`^SELECT`).Return([]string{"code", "name"}, []interface{}{"NL", "Netherlands"}, []interface{}{"PT", "Portugal"})
+	db := f.DB(t)
+	ctx := context.Background()
+	cached := db.Cached(time.Minute).Tags("countries")
+	read := func() []country {
+		var cs []country
+		if err := cached.Select(ctx, &cs, "SELECT code, name FROM countries"); err != nil {
+			t.Fatal(err)
+		}
+		return cs
+	}
+
+	if cs := read(); len(cs) != 2 || cs[1] != (country{"PT", "Portugal"}) {
+		t.Fatalf("Select = %+v", cs)
+	}
+	if cs := read(); len(cs) != 2 {
+		t.Fatalf("cached Select = %+v", cs)
+	}
+	if n := len(f.Calls()); n != 1 {
+		t.Errorf("%d queries for two reads, want 1", n)
+	}
+
+	if err := db.InvalidateTags(ctx, "countries"); err != nil {
+		t.Fatal(err)
+	}
+	read()
+	if n := len(f.Calls()); n != 2 {
+		t.Errorf("%d queries after invalidating, want 2", n)
+	}
+
+	// Other arguments are other keys.
+	var c country
+	if err := cached.Get(ctx, &c, "SELECT code, name FROM countries WHERE code = $1", "NL"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cached.Get(ctx, &c, "SELECT code, name FROM countries WHERE code = $1", "PT"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(f.Calls()); n != 4 {
+		t.Errorf("%d queries after two distinct Gets, want 4", n)
+	}
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// CallOption configures a single Exec, Query, QueryRow, Get or Select call.
+// It is passed among the query arguments and removed before the query is
+// sent:
+//
+//	db.Exec(ctx, `UPDATE ...`, id, database.WithTimeout(2*time.Second))
+type CallOption interface {
+	applyCall(*callConfig)
+}
+
+type callOptionFunc func(*callConfig)
+
+func (f callOptionFunc) applyCall(c *callConfig) { f(c) }
+
+type callConfig struct {
+	statementTimeout time.Duration
+	readOnly         bool
+	maxStaleness     time.Duration
+	// lock and lockWait are the row locking clause, see SelectForUpdate.
+	lock     string
+	lockWait string
+	// invalidates are the cache tags of InvalidatesTags.
+	invalidates []string
+}
+
+// WithTimeout sets statement_timeout for the one statement, so the server
+// aborts it after d. The session's own setting is restored afterwards.
+func WithTimeout(d time.Duration) CallOption {
+	return callOptionFunc(func(c *callConfig) { c.statementTimeout = d })
+}
+
+// ReadOnly marks a read that a Cluster may send to a replica. A plain DB
+// ignores it.
+func ReadOnly() CallOption {
+	return callOptionFunc(func(c *callConfig) { c.readOnly = true })
+}
+
+// WithMaxStaleness marks a read that a Cluster may send to a replica lagging
+// the primary by at most d. If no replica is fresh enough the read goes to
+// the primary. A plain DB ignores it.
+func WithMaxStaleness(d time.Duration) CallOption {
+	return callOptionFunc(func(c *callConfig) {
+		c.readOnly = true
+		c.maxStaleness = d
+	})
+}
+
+// peekCallOptions returns the configuration of the CallOptions in args
+// without removing them.
+func peekCallOptions(args []interface{}) callConfig {
+	var cfg callConfig
+	for _, a := range args {
+		if o, ok := a.(CallOption); ok {
+			o.applyCall(&cfg)
+		}
+	}
+	return cfg
+}
+
+type callConfigKey struct{}
+
+// withCallOptions removes the CallOptions from args and records them in the
+// returned context.
+func withCallOptions(ctx context.Context, args []interface{}) (context.Context, []interface{}) {
+	n := 0
+	for _, a := range args {
+		if _, ok := a.(CallOption); ok {
+			n++
+		}
+	}
+	if n == 0 {
+		return ctx, args
+	}
+	cfg := callConfig{}
+	if prev, ok := ctx.Value(callConfigKey{}).(*callConfig); ok {
+		cfg = *prev
+	}
+	rest := make([]interface{}, 0, len(args)-n)
+	for _, a := range args {
+		if o, ok := a.(CallOption); ok {
+			o.applyCall(&cfg)
+		} else {
+			rest = append(rest, a)
+		}
+	}
+	return context.WithValue(ctx, callConfigKey{}, &cfg), rest
+}
+
+func callConfigFrom(ctx context.Context) *callConfig {
+	cfg, _ := ctx.Value(callConfigKey{}).(*callConfig)
+	return cfg
+}
+
+// applyCallTimeout sets the statement_timeout requested for the statement
+// about to run, or restores the session's setting after an earlier call
+// changed it. The restore is deferred to the next statement or to
+// ResetSession because Query's rows may still be read after Query returns.
+func (c *wrappedConn) applyCallTimeout(ctx context.Context) error {
+	cfg := callConfigFrom(ctx)
+	if cfg == nil || cfg.statementTimeout <= 0 {
+		if c.timeoutSet {
+			return c.resetCallTimeout(ctx)
+		}
+		return nil
+	}
+	ex, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return fmt.Errorf("database: WithTimeout: driver does not implement driver.ExecerContext")
+	}
+	ms := cfg.statementTimeout.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	set := "SET"
+	if c.db.pgBouncer {
+		if !c.inTx {
+			return fmt.Errorf("%w: WithTimeout outside a transaction", ErrPgBouncerUnsupported)
+		}
+		set = "SET LOCAL"
+	}
+	if _, err := ex.ExecContext(ctx, fmt.Sprintf("%s statement_timeout = %d", set, ms), nil); err != nil {
+		return err
+	}
+	c.timeoutSet = true
+	return nil
+}
+
+func (c *wrappedConn) resetCallTimeout(ctx context.Context) error {
+	ex, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil
+	}
+	reset := "RESET statement_timeout"
+	if c.db.pgBouncer {
+		reset = "SET LOCAL statement_timeout TO DEFAULT"
+	}
+	if _, err := ex.ExecContext(ctx, reset, nil); err != nil {
+		return err
+	}
+	c.timeoutSet = false
+	return nil
+}
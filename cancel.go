@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+	"time"
+)
+
+// WithCancelBackend makes a statement whose context is done before it
+// returns also be cancelled server side with pg_cancel_backend, issued from
+// another pooled connection, so the server stops the work rather than the
+// client merely abandoning it.
+func WithCancelBackend() Option {
+	return func(db *DB) {
+		db.cancelBackend = true
+	}
+}
+
+// backendPID asks a new driver connection for its server process ID.
+func backendPID(ctx context.Context, conn driver.Conn) int64 {
+	v, err := connValue(ctx, conn, "SELECT pg_backend_pid()")
+	if err != nil {
+		return 0
+	}
+	pid, _ := v.(int64)
+	return pid
+}
+
+// watchCancel cancels the connection's backend if ctx is done before the
+// returned stop function is called. stop waits for an in-progress cancel, so
+// it cannot hit the next statement on the connection.
+func (c *wrappedConn) watchCancel(ctx context.Context) (stop func()) {
+	if !c.db.cancelBackend || c.pid == 0 || ctx.Done() == nil {
+		return func() {}
+	}
+	var mu sync.Mutex
+	finished := false
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			mu.Lock()
+			defer mu.Unlock()
+			if !finished {
+				c.db.cancelPID(c.pid)
+			}
+		case <-done:
+		}
+	}()
+	return func() {
+		mu.Lock()
+		finished = true
+		mu.Unlock()
+		close(done)
+		<-exited
+	}
+}
+
+func (db *DB) cancelPID(pid int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	db.db.ExecContext(ctx, "SELECT pg_cancel_backend($1)", pid)
+}
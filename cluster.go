@@ -0,0 +1,278 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type ClusterConfig struct {
+	// Driver is the database/sql driver name for every node.
+	Driver   string
+	Primary  string
+	Replicas []string
+	// CheckInterval is how often replicas marked down are probed again and
+	// the lag of the others is measured. Defaults to 5 seconds.
+	CheckInterval time.Duration
+	// MaxStaleness is the replication lag beyond which a replica is skipped
+	// by reads that don't set WithMaxStaleness. Zero means no bound.
+	MaxStaleness time.Duration
+}
+
+// Cluster routes writes to a primary and reads marked ReadOnly, or run with
+// ReadOnlyTransaction, to its replicas in round-robin order. Replicas that
+// fail with connection errors are skipped until a probe succeeds; with no
+// replica available reads go to the primary.
+type Cluster struct {
+	primary  *DB
+	replicas []*replica
+	next     uint32
+	cfg      ClusterConfig
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type replica struct {
+	db   *DB
+	dsn  string
+	down atomic.Bool
+	// lag is the last measured replication lag in nanoseconds, -1 if unknown.
+	lag atomic.Int64
+}
+
+// replicaLagQuery measures how far a replica's replay is behind the primary.
+// A replica that has replayed everything it received is not lagging, even if
+// the primary has been idle since the last replayed transaction.
+const replicaLagQuery = `SELECT CASE
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END`
+
+var _ Querier = (*Cluster)(nil)
+
+// OpenCluster opens one pool per node. Replicas that cannot be reached at
+// startup are marked down instead of failing the call.
+func OpenCluster(cfg ClusterConfig, opts ...Option) (*Cluster, error) {
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = 5 * time.Second
+	}
+	primary, err := Open(cfg.Driver, cfg.Primary, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("OpenCluster(): primary: %w", err)
+	}
+	c := &Cluster{primary: primary, cfg: cfg, stop: make(chan struct{}), done: make(chan struct{})}
+	for _, dsn := range cfg.Replicas {
+		r := &replica{dsn: dsn}
+		r.lag.Store(-1)
+		if r.db, err = Open(cfg.Driver, dsn, opts...); err != nil {
+			r.down.Store(true)
+		}
+		c.replicas = append(c.replicas, r)
+	}
+	c.check(opts)
+	go c.probe(opts)
+	return c, nil
+}
+
+// Primary returns the primary's DB.
+func (c *Cluster) Primary() *DB {
+	return c.primary
+}
+
+// Replica returns the next available replica within the cluster's
+// MaxStaleness, or the primary if there is none.
+func (c *Cluster) Replica() *DB {
+	return c.replica(c.cfg.MaxStaleness)
+}
+
+// replica returns the next available replica lagging by at most maxStaleness
+// (no bound if zero), or the primary.
+func (c *Cluster) replica(maxStaleness time.Duration) *DB {
+	n := len(c.replicas)
+	for i := 0; i < n; i++ {
+		r := c.replicas[int(atomic.AddUint32(&c.next, 1))%n]
+		if r.down.Load() {
+			continue
+		}
+		if maxStaleness > 0 {
+			if lag := r.lag.Load(); lag < 0 || time.Duration(lag) > maxStaleness {
+				continue
+			}
+		}
+		return r.db
+	}
+	return c.primary
+}
+
+// Lag returns the last measured replication lag of each replica, in the
+// order of ClusterConfig.Replicas; -1 if it is down or not yet measured.
+func (c *Cluster) Lag() []time.Duration {
+	lags := make([]time.Duration, len(c.replicas))
+	for i, r := range c.replicas {
+		lags[i] = -1
+		if !r.down.Load() {
+			lags[i] = time.Duration(r.lag.Load())
+		}
+	}
+	return lags
+}
+
+func (c *Cluster) Close() error {
+	close(c.stop)
+	<-c.done
+	errs := []error{c.primary.Close()}
+	for _, r := range c.replicas {
+		if r.db != nil {
+			errs = append(errs, r.db.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// route picks the DB for a call with the given arguments.
+func (c *Cluster) route(args []interface{}) *DB {
+	cfg := peekCallOptions(args)
+	if cfg.readOnly {
+		if cfg.maxStaleness > 0 {
+			return c.replica(cfg.maxStaleness)
+		}
+		return c.Replica()
+	}
+	return c.primary
+}
+
+// observe marks the replica behind db down if err is a connection error.
+// Errors of Transaction callbacks are the caller's and are ignored.
+func (c *Cluster) observe(db *DB, err error) {
+	if db == c.primary || !replicaDown(guardError(err)) {
+		return
+	}
+	for _, r := range c.replicas {
+		// r.db only changes while r is down.
+		if !r.down.Load() && r.db == db {
+			r.down.Store(true)
+		}
+	}
+}
+
+func (c *Cluster) Exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	return c.primary.Exec(ctx, query, args...)
+}
+
+func (c *Cluster) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	db := c.route(args)
+	rows, err := db.Query(ctx, query, args...)
+	c.observe(db, err)
+	return rows, err
+}
+
+func (c *Cluster) QueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	db := c.route(args)
+	row := db.QueryRow(ctx, query, args...)
+	c.observe(db, row.Err())
+	return row
+}
+
+func (c *Cluster) Get(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	db := c.route(args)
+	err := db.Get(ctx, dest, query, args...)
+	c.observe(db, err)
+	return err
+}
+
+func (c *Cluster) Select(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	db := c.route(args)
+	err := db.Select(ctx, dest, query, args...)
+	c.observe(db, err)
+	return err
+}
+
+// Transaction runs f in a transaction on the primary.
+func (c *Cluster) Transaction(ctx context.Context, iso sql.IsolationLevel, f func(*DB) error) error {
+	return c.primary.Transaction(ctx, iso, f)
+}
+
+// ReadOnlyTransaction runs f in a read-only transaction on a replica.
+func (c *Cluster) ReadOnlyTransaction(ctx context.Context, iso sql.IsolationLevel, f func(*DB) error) error {
+	db := c.Replica()
+	err := db.ReadOnlyTransaction(ctx, iso, f)
+	c.observe(db, err)
+	return err
+}
+
+// probe runs check every CheckInterval until Close.
+func (c *Cluster) probe(opts []Option) {
+	defer close(c.done)
+	t := time.NewTicker(c.cfg.CheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-t.C:
+		}
+		c.check(opts)
+	}
+}
+
+// check reconnects the replicas marked down and measures the lag of all.
+func (c *Cluster) check(opts []Option) {
+	var wg sync.WaitGroup
+	for _, r := range c.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			c.checkReplica(r, opts)
+		}(r)
+	}
+	wg.Wait()
+}
+
+func (c *Cluster) checkReplica(r *replica, opts []Option) {
+	down := r.down.Load()
+	if down && r.db == nil {
+		db, err := Open(c.cfg.Driver, r.dsn, opts...)
+		if err != nil {
+			return
+		}
+		r.db = db
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.CheckInterval)
+	defer cancel()
+	var secs float64
+	if err := r.db.db.QueryRowContext(ctx, replicaLagQuery).Scan(&secs); err != nil {
+		r.lag.Store(-1)
+		if down {
+			return
+		}
+		if replicaDown(err) {
+			r.down.Store(true)
+		}
+		return
+	}
+	r.lag.Store(int64(secs * float64(time.Second)))
+	r.down.Store(false)
+}
+
+// replicaDown reports whether err means the replica cannot be reached: the
+// connection failed or the server is shutting down or starting up.
+func replicaDown(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch code := SQLState(err); {
+	case code == "57P01", // admin_shutdown
+		code == "57P02", // crash_shutdown
+		code == "57P03", // cannot_connect_now
+		len(code) == 5 && code[:2] == "08":
+		return true
+	case code != "":
+		return false
+	}
+	return isConnError(err)
+}
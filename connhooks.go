@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+)
+
+// SessionConn is a pooled connection as seen by the connection hooks.
+type SessionConn struct {
+	c *wrappedConn
+}
+
+// Exec runs a statement on the connection, e.g. a session-level SET.
+func (s SessionConn) Exec(ctx context.Context, query string, args ...interface{}) error {
+	ex, ok := s.c.Conn.(driver.ExecerContext)
+	if !ok {
+		return errors.New("database: driver does not implement driver.ExecerContext")
+	}
+	nvs := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		nvs[i] = driver.NamedValue{Ordinal: i + 1, Value: a}
+	}
+	_, err := ex.ExecContext(ctx, query, nvs)
+	return err
+}
+
+// Raw returns the driver's connection.
+func (s SessionConn) Raw() driver.Conn {
+	return s.c.Conn
+}
+
+// WithOnConnect runs f on every new connection before it joins the pool,
+// e.g. to set session GUCs or load extensions. An error discards the
+// connection and fails the operation that needed it.
+func WithOnConnect(f func(ctx context.Context, conn SessionConn) error) Option {
+	return func(db *DB) {
+		db.onConnect = append(db.onConnect, f)
+	}
+}
+
+// WithOnAcquire runs f when an operation checks a connection out of the
+// pool, before its first statement, with the operation's context. An error
+// fails the operation.
+func WithOnAcquire(f func(ctx context.Context, conn SessionConn) error) Option {
+	return func(db *DB) {
+		db.onAcquire = append(db.onAcquire, f)
+	}
+}
+
+// WithOnRelease runs f when a connection is returned to the pool. An error
+// discards the connection instead.
+func WithOnRelease(f func(conn SessionConn) error) Option {
+	return func(db *DB) {
+		db.onRelease = append(db.onRelease, f)
+	}
+}
+
+func (c *wrappedConn) connected(ctx context.Context) error {
+	for _, f := range c.db.onConnect {
+		if err := f(ctx, SessionConn{c}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acquire runs the acquire hooks once per checkout.
+func (c *wrappedConn) acquire(ctx context.Context) error {
+	if c.acquired {
+		return nil
+	}
+	c.acquired = true
+	for _, f := range c.db.onAcquire {
+		if err := f(ctx, SessionConn{c}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// release runs the release hooks if the connection was used since its
+// checkout, reporting whether it may go back to the pool.
+func (c *wrappedConn) release() bool {
+	if !c.acquired {
+		return true
+	}
+	c.acquired = false
+	for _, f := range c.db.onRelease {
+		if err := f(SessionConn{c}); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+)
+
+// CredentialSource supplies the user and password for new connections, e.g.
+// from Vault or AWS Secrets Manager. It is consulted for every connection,
+// so it should cache credentials that are expensive to obtain.
+type CredentialSource interface {
+	GetCredentials(ctx context.Context) (user, password string, err error)
+}
+
+// CredentialRotator is implemented by a CredentialSource that knows when its
+// credentials change. Each receive from Rotated retires the pooled
+// connections, as RotateCredentials does.
+type CredentialRotator interface {
+	Rotated() <-chan struct{}
+}
+
+// CredentialsProvider is a CredentialSource function.
+type CredentialsProvider func(ctx context.Context) (user, password string, err error)
+
+func (p CredentialsProvider) GetCredentials(ctx context.Context) (string, string, error) {
+	return p(ctx)
+}
+
+// WithCredentials makes Open and OpenPgx connect with the credentials from
+// src instead of those in the DSN, e.g. short-lived tokens or dynamic
+// secrets. It has no effect with OpenDB.
+func WithCredentials(src CredentialSource) Option {
+	return func(db *DB) {
+		db.credentials = src
+	}
+}
+
+// RotateCredentials retires the pooled connections after the credentials
+// changed, so idle ones are replaced by connections made with the new
+// credentials and busy ones are closed when released rather than reused.
+func (db *DB) RotateCredentials() {
+	db.retireConns()
+}
+
+// watchRotation retires the pool whenever a CredentialRotator source
+// reports a rotation.
+func (db *DB) watchRotation() {
+	r, ok := db.credentials.(CredentialRotator)
+	if !ok {
+		return
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	var once sync.Once
+	db.stops = append(db.stops, func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+		})
+	})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-r.Rotated():
+				db.RotateCredentials()
+			}
+		}
+	}()
+}
+
+// connector returns the connector for a single-host dsn.
+func (db *DB) connector(drv driver.Driver, dsn string) driver.Connector {
+	if db.credentials == nil {
+		return dsnConnector(drv, dsn)
+	}
+	return &credConnector{drv: drv, dsn: dsn, credentials: db.credentials}
+}
+
+// credConnector adds the current credentials to the DSN of every
+// connection.
+type credConnector struct {
+	drv         driver.Driver
+	dsn         string
+	credentials CredentialSource
+}
+
+func (c *credConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	user, password, err := c.credentials.GetCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dsn := c.dsn
+	if user != "" {
+		dsn = dsnWithParam(dsn, "user", user)
+	}
+	dsn = dsnWithParam(dsn, "password", password)
+	return dsnConnector(c.drv, dsn).Connect(ctx)
+}
+
+func (c *credConnector) Driver() driver.Driver { return c.drv }
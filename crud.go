@@ -0,0 +1,398 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// CRUDOption overrides what Insert, Update, DeleteByID and FindByID derive
+// from the model type.
+type CRUDOption func(*crudConfig)
+
+type crudConfig struct {
+	table       string
+	unscoped    bool
+	invalidates []string
+}
+
+// CRUDTable uses table instead of the model's table name (see Tabler).
+func CRUDTable(table string) CRUDOption {
+	return func(c *crudConfig) {
+		c.table = table
+	}
+}
+
+// Unscoped makes the helpers include soft-deleted rows, and DeleteByID
+// delete rows for good, for a model with a `softdelete` field.
+func Unscoped() CRUDOption {
+	return func(c *crudConfig) {
+		c.unscoped = true
+	}
+}
+
+// CRUDInvalidates makes Insert, Update and DeleteByID invalidate cache tags
+// once they succeed, as InvalidatesTags does for Exec. It needs q to be a
+// *DB.
+func CRUDInvalidates(tags ...string) CRUDOption {
+	return func(c *crudConfig) {
+		c.invalidates = append(c.invalidates, tags...)
+	}
+}
+
+// CompositeKey is the id of a row with a composite key, one value per key
+// column in field order.
+type CompositeKey []interface{}
+
+// keyArgs returns the key values of id.
+func keyArgs(id interface{}) []interface{} {
+	if k, ok := id.(CompositeKey); ok {
+		return k
+	}
+	return []interface{}{id}
+}
+
+// crudModel is the table and columns of a model type. The key is the
+// fields tagged `pk`, or else the "id" column; fields tagged `auto` are
+// set by the database (serials, defaults) and only read back. A timestamp
+// field tagged `softdelete`, e.g. a *time.Time deleted_at, makes DeleteByID
+// set it rather than delete the row, and the helpers skip rows where it is
+// set unless Unscoped is given. Audit fields are maintained by Insert and
+// Update: `createdat` and `updatedat` are set to CURRENT_TIMESTAMP, and `createdby` and
+// `updatedby` to the actor from WithActor.
+type crudModel struct {
+	// d quotes the identifiers and numbers the placeholders.
+	d      Dialect
+	table  string
+	fields []field
+	key    []field
+	// deleted is the `softdelete` column, quoted; "" with Unscoped.
+	deleted     string
+	invalidates []string
+}
+
+func crudModelOf[T any](q Querier, opts []CRUDOption) (*crudModel, error) {
+	var zero T
+	t := reflect.TypeOf(zero)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("model %s is not a struct", reflect.TypeOf(&zero).Elem())
+	}
+	cfg := crudConfig{table: tableName(&zero)}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	d := dialectOf(q)
+	m := &crudModel{d: d, table: d.QuoteIdent(cfg.table), fields: structFields(t), invalidates: cfg.invalidates}
+	for _, f := range m.fields {
+		if f.opts["pk"] {
+			m.key = append(m.key, f)
+		}
+		if f.opts["softdelete"] && !cfg.unscoped {
+			m.deleted = d.QuoteIdent(f.column)
+		}
+	}
+	if len(m.key) == 0 {
+		for _, f := range m.fields {
+			if f.column == "id" {
+				m.key = append(m.key, f)
+			}
+		}
+	}
+	return m, nil
+}
+
+// dialectOf returns the dialect of q, Postgres unless q is a DB (or wraps
+// one) with another.
+func dialectOf(q Querier) Dialect {
+	if d, ok := q.(interface{ Dialect() Dialect }); ok {
+		return d.Dialect()
+	}
+	return Postgres
+}
+
+// columns returns the quoted columns of fs.
+func (m *crudModel) columns(fs []field) string {
+	cols := make([]string, len(fs))
+	for i, f := range fs {
+		cols[i] = m.d.QuoteIdent(f.column)
+	}
+	return strings.Join(cols, ", ")
+}
+
+// where returns the condition matching the key, its placeholders starting
+// at the n-th.
+func (m *crudModel) where(n int) string {
+	conds := make([]string, len(m.key))
+	for i, f := range m.key {
+		conds[i] = m.d.QuoteIdent(f.column) + " = " + m.d.Placeholder(n+i)
+	}
+	if m.deleted != "" {
+		conds = append(conds, m.deleted+" IS NULL")
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// version returns the field tagged `version`.
+func (m *crudModel) version() (field, bool) {
+	for _, f := range m.fields {
+		if f.opts["version"] {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+func (m *crudModel) checkKey(ids []interface{}) error {
+	if len(m.key) == 0 {
+		return fmt.Errorf("%s has no pk field or id column", m.table)
+	}
+	if ids != nil && len(ids) != len(m.key) {
+		return fmt.Errorf("%s has %d key column(s), got %d value(s)", m.table, len(m.key), len(ids))
+	}
+	return nil
+}
+
+// written invalidates the model's CRUDInvalidates tags after a write.
+func (m *crudModel) written(ctx context.Context, q Querier) {
+	if db, ok := q.(*DB); ok {
+		db.InvalidateTags(ctx, m.invalidates...)
+	}
+}
+
+// reread sets v from the row with v's key, for a dialect without
+// RETURNING.
+func (m *crudModel) reread(ctx context.Context, q Querier, v reflect.Value) error {
+	ids := make([]interface{}, len(m.key))
+	for i, f := range m.key {
+		ids[i] = v.FieldByIndex(f.index).Interface()
+	}
+	query := "SELECT " + m.columns(m.fields) + " FROM " + m.table + " WHERE " + m.where(1)
+	return queryInto(ctx, q, v, query, ids)
+}
+
+// queryInto runs query and scans its single row into v.
+func queryInto(ctx context.Context, q Querier, v reflect.Value, query string, args []interface{}) error {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	if err := scanInto(rows, v); err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// Insert inserts v into its table, leaving out the `auto` fields, and sets
+// v from the inserted row as RETURNING reports it. With a dialect without
+// RETURNING, such as MySQL, the row is read back by its key, which then
+// must not be `auto`.
+func Insert[T any](ctx context.Context, q Querier, v *T, opts ...CRUDOption) error {
+	m, err := crudModelOf[T](q, opts)
+	if err != nil {
+		return fmt.Errorf("Insert(): %w", err)
+	}
+	rv := reflect.ValueOf(v).Elem()
+	var cols []field
+	var args []interface{}
+	var params []string
+	for _, f := range m.fields {
+		if f.opts["auto"] {
+			continue
+		}
+		cols = append(cols, f)
+		if f.opts["createdat"] || f.opts["updatedat"] {
+			params = append(params, "CURRENT_TIMESTAMP")
+			continue
+		}
+		args = append(args, fieldValue(ctx, rv, f))
+		params = append(params, m.d.Placeholder(len(args)))
+	}
+	query := "INSERT INTO " + m.table + " DEFAULT VALUES"
+	if len(cols) > 0 {
+		query = "INSERT INTO " + m.table + " (" + m.columns(cols) + ") VALUES (" + strings.Join(params, ", ") + ")"
+	}
+	if m.d.Returning() {
+		query += " RETURNING " + m.columns(m.fields)
+		if err := queryInto(ctx, q, rv, query, args); err != nil {
+			return fmt.Errorf("Insert(): %w", err)
+		}
+		m.written(ctx, q)
+		return nil
+	}
+	if err := m.checkKey(nil); err != nil {
+		return fmt.Errorf("Insert(): %w", err)
+	}
+	for _, f := range m.key {
+		if f.opts["auto"] {
+			return fmt.Errorf("Insert(): %s cannot return the generated key %s of %s", m.d.Name(), f.column, m.table)
+		}
+	}
+	if _, err := q.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("Insert(): %w", err)
+	}
+	m.written(ctx, q)
+	if err := m.reread(ctx, q, rv); err != nil {
+		return fmt.Errorf("Insert(): %w", err)
+	}
+	return nil
+}
+
+// Update writes the fields of v other than the key and `auto` fields to the
+// row with v's key, and sets v from the updated row. It returns
+// sql.ErrNoRows if there is no such row.
+func Update[T any](ctx context.Context, q Querier, v *T, opts ...CRUDOption) error {
+	if err := update[T](ctx, q, v, false, opts); err != nil {
+		if err == sql.ErrNoRows {
+			return err
+		}
+		return fmt.Errorf("Update(): %w", err)
+	}
+	return nil
+}
+
+// ErrStaleRow is returned by UpdateVersioned when the row was changed or
+// deleted since it was read.
+var ErrStaleRow = errors.New("database: row was modified concurrently")
+
+// UpdateVersioned is Update with optimistic locking on the field tagged
+// `version`, an integer: the row is only updated if its version still
+// matches v's, and the version is incremented. It returns ErrStaleRow if
+// the row was changed or deleted since v was read.
+func UpdateVersioned[T any](ctx context.Context, q Querier, v *T, opts ...CRUDOption) error {
+	if err := update[T](ctx, q, v, true, opts); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrStaleRow
+		}
+		return fmt.Errorf("UpdateVersioned(): %w", err)
+	}
+	return nil
+}
+
+func update[T any](ctx context.Context, q Querier, v *T, versioned bool, opts []CRUDOption) error {
+	m, err := crudModelOf[T](q, opts)
+	if err != nil {
+		return err
+	}
+	if err := m.checkKey(nil); err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(v).Elem()
+	match := m.key
+	skip := map[string]bool{}
+	for _, f := range m.key {
+		skip[f.column] = true
+	}
+	var sets []string
+	if versioned {
+		version, ok := m.version()
+		if !ok {
+			return fmt.Errorf("%s has no version field", m.table)
+		}
+		match = append(append([]field(nil), m.key...), version)
+		skip[version.column] = true
+		col := m.d.QuoteIdent(version.column)
+		sets = append(sets, col+" = "+col+" + 1")
+	}
+	var args []interface{}
+	for _, f := range m.fields {
+		if skip[f.column] || f.opts["auto"] || f.opts["softdelete"] || f.opts["createdat"] || f.opts["createdby"] {
+			continue
+		}
+		if f.opts["updatedat"] {
+			sets = append(sets, m.d.QuoteIdent(f.column)+" = CURRENT_TIMESTAMP")
+			continue
+		}
+		args = append(args, fieldValue(ctx, rv, f))
+		sets = append(sets, m.d.QuoteIdent(f.column)+" = "+m.d.Placeholder(len(args)))
+	}
+	if len(sets) == 0 {
+		return fmt.Errorf("%s has no columns to update", m.table)
+	}
+	conds := make([]string, len(match))
+	for i, f := range match {
+		args = append(args, rv.FieldByIndex(f.index).Interface())
+		conds[i] = m.d.QuoteIdent(f.column) + " = " + m.d.Placeholder(len(args))
+	}
+	if m.deleted != "" {
+		conds = append(conds, m.deleted+" IS NULL")
+	}
+	query := "UPDATE " + m.table + " SET " + strings.Join(sets, ", ") + " WHERE " + strings.Join(conds, " AND ")
+	if m.d.Returning() {
+		if err := queryInto(ctx, q, rv, query+" RETURNING "+m.columns(m.fields), args); err != nil {
+			return err
+		}
+		m.written(ctx, q)
+		return nil
+	}
+	// MySQL counts the rows changed, not matched, so only a versioned
+	// update, which always changes the version, can tell a missing row by
+	// the count; the read back tells it otherwise.
+	n, err := q.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if versioned && n == 0 {
+		return sql.ErrNoRows
+	}
+	m.written(ctx, q)
+	return m.reread(ctx, q, rv)
+}
+
+// DeleteByID deletes the T row whose key is id, a CompositeKey for a
+// composite key, or soft-deletes it for a model with a `softdelete` field.
+// It returns sql.ErrNoRows if there is no such row.
+func DeleteByID[T any](ctx context.Context, q Querier, id interface{}, opts ...CRUDOption) error {
+	ids := keyArgs(id)
+	m, err := crudModelOf[T](q, opts)
+	if err == nil {
+		err = m.checkKey(ids)
+	}
+	if err != nil {
+		return fmt.Errorf("DeleteByID(): %w", err)
+	}
+	query := "DELETE FROM " + m.table + " WHERE " + m.where(1)
+	if m.deleted != "" {
+		query = "UPDATE " + m.table + " SET " + m.deleted + " = CURRENT_TIMESTAMP WHERE " + m.where(1)
+	}
+	n, err := q.Exec(ctx, query, ids...)
+	if err != nil {
+		return fmt.Errorf("DeleteByID(): %w", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	m.written(ctx, q)
+	return nil
+}
+
+// FindByID returns the T row whose key is id, a CompositeKey for a
+// composite key, or sql.ErrNoRows.
+func FindByID[T any](ctx context.Context, q Querier, id interface{}, opts ...CRUDOption) (*T, error) {
+	ids := keyArgs(id)
+	m, err := crudModelOf[T](q, opts)
+	if err == nil {
+		err = m.checkKey(ids)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("FindByID(): %w", err)
+	}
+	v := new(T)
+	query := "SELECT " + m.columns(m.fields) + " FROM " + m.table + " WHERE " + m.where(1)
+	if err := queryInto(ctx, q, reflect.ValueOf(v).Elem(), query, ids); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("FindByID(): %w", err)
+	}
+	return v, nil
+}
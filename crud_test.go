@@ -0,0 +1,168 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkrypt0987/database"
+	"github.com/pkrypt0987/database/fakedb"
+)
+
+type account struct {
+	ID      int64  `db:"id,pk,auto"`
+	Name    string `db:"name"`
+	Version int64  `db:"version,version"`
+}
+
+type membership struct {
+	OrgID     int64      `db:"org_id,pk"`
+	UserID    int64      `db:"user_id,pk"`
+	Role      string     `db:"role"`
+	DeletedAt *time.Time `db:"deleted_at,softdelete"`
+}
+
+var accountColumns = []string{"id", "name", "version"}
+
+func TestInsert(t *testing.T) {
+	for _, c := range []struct {
+		dialect database.Dialect
+		query   string
+	}{
+		{database.Postgres, `INSERT INTO "account" ("name", "version") VALUES ($1, $2) RETURNING "id", "name", "version"`},
+		{database.SQLite, `INSERT INTO "account" ("name", "version") VALUES (?, ?) RETURNING "id", "name", "version"`},
+	} {
+		f := fakedb.New()
+		f.On(`^INSERT`).Return(accountColumns, []interface{}{int64(7), "acme", int64(1)})
+		db := f.DB(t, database.WithDialect(c.dialect))
+		a := account{Name: "acme", Version: 1}
+		if err := database.Insert(context.Background(), db, &a); err != nil {
+			t.Fatalf("%s: %v", c.dialect.Name(), err)
+		}
+		if a.ID != 7 {
+			t.Errorf("%s: ID = %d, want 7 from RETURNING", c.dialect.Name(), a.ID)
+		}
+		want := []fakedb.Call{{Query: c.query, Args: []interface{}{"acme", int64(1)}}}
+		if got := f.Calls(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: calls\n got %v\nwant %v", c.dialect.Name(), got, want)
+		}
+	}
+}
+
+func TestInsertWithoutReturning(t *testing.T) {
+	f := fakedb.New()
+	f.On(`^INSERT`).ReturnRowsAffected(1)
+	f.On(`^SELECT`).Return([]string{"org_id", "user_id", "role", "deleted_at"}, []interface{}{int64(1), int64(2), "admin", nil})
+	db := f.DB(t, database.WithDialect(database.MySQL))
+	m := membership{OrgID: 1, UserID: 2, Role: "admin"}
+	if err := database.Insert(context.Background(), db, &m); err != nil {
+		t.Fatal(err)
+	}
+	want := []fakedb.Call{
+		{Query: "INSERT INTO `membership` (`org_id`, `user_id`, `role`, `deleted_at`) VALUES (?, ?, ?, ?)", Args: []interface{}{int64(1), int64(2), "admin", (*time.Time)(nil)}},
+		{Query: "SELECT `org_id`, `user_id`, `role`, `deleted_at` FROM `membership` WHERE `org_id` = ? AND `user_id` = ? AND `deleted_at` IS NULL", Args: []interface{}{int64(1), int64(2)}},
+	}
+	if got := f.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls\n got %v\nwant %v", got, want)
+	}
+
+	// A generated key cannot be read back without RETURNING.
+	err := database.Insert(context.Background(), db, &account{Name: "acme"})
+	if err == nil {
+		t.Error("Insert of an auto key with MySQL succeeded")
+	}
+}
+
+func TestUpdateVersioned(t *testing.T) {
+	f := fakedb.New()
+	f.On(`^UPDATE`).Return(accountColumns, []interface{}{int64(7), "acme", int64(4)}).Once()
+	f.On(`^UPDATE`).Return(accountColumns)
+	db := f.DB(t)
+	a := account{ID: 7, Name: "acme", Version: 3}
+	if err := database.UpdateVersioned(context.Background(), db, &a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Version != 4 {
+		t.Errorf("Version = %d, want 4", a.Version)
+	}
+	want := fakedb.Call{
+		Query: `UPDATE "account" SET "version" = "version" + 1, "name" = $1 WHERE "id" = $2 AND "version" = $3 RETURNING "id", "name", "version"`,
+		Args:  []interface{}{"acme", int64(7), int64(3)},
+	}
+	if got := f.Calls()[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("call\n got %v\nwant %v", got, want)
+	}
+
+	// No row matched: someone else bumped the version.
+	if err := database.UpdateVersioned(context.Background(), db, &a); err != database.ErrStaleRow {
+		t.Errorf("stale update: err = %v, want ErrStaleRow", err)
+	}
+}
+
+func TestUpdateVersionedWithoutReturning(t *testing.T) {
+	f := fakedb.New()
+	f.On(`^UPDATE`).ReturnRowsAffected(0)
+	db := f.DB(t, database.WithDialect(database.MySQL))
+	a := account{ID: 7, Name: "acme", Version: 3}
+	if err := database.UpdateVersioned(context.Background(), db, &a); err != database.ErrStaleRow {
+		t.Errorf("err = %v, want ErrStaleRow", err)
+	}
+}
+
+func TestUpdateNoRow(t *testing.T) {
+	f := fakedb.New()
+	f.On(`^UPDATE`).Return(accountColumns)
+	db := f.DB(t)
+	if err := database.Update(context.Background(), db, &account{ID: 7}); err != sql.ErrNoRows {
+		t.Errorf("err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestDeleteByID(t *testing.T) {
+	f := fakedb.New()
+	f.On(`^UPDATE`).ReturnRowsAffected(1).Once()
+	f.On(`^(UPDATE|DELETE)`).ReturnRowsAffected(0)
+	db := f.DB(t)
+	ctx := context.Background()
+	id := database.CompositeKey{int64(1), int64(2)}
+	if err := database.DeleteByID[membership](ctx, db, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DeleteByID[membership](ctx, db, id); err != sql.ErrNoRows {
+		t.Errorf("second delete: err = %v, want sql.ErrNoRows", err)
+	}
+	if err := database.DeleteByID[membership](ctx, db, id, database.Unscoped()); err != sql.ErrNoRows {
+		t.Errorf("unscoped delete: err = %v, want sql.ErrNoRows", err)
+	}
+	if err := database.DeleteByID[membership](ctx, db, int64(1)); err == nil {
+		t.Error("delete with one of two key values succeeded")
+	}
+	want := []string{
+		`UPDATE "membership" SET "deleted_at" = CURRENT_TIMESTAMP WHERE "org_id" = $1 AND "user_id" = $2 AND "deleted_at" IS NULL`,
+		`UPDATE "membership" SET "deleted_at" = CURRENT_TIMESTAMP WHERE "org_id" = $1 AND "user_id" = $2 AND "deleted_at" IS NULL`,
+		`DELETE FROM "membership" WHERE "org_id" = $1 AND "user_id" = $2`,
+	}
+	if got := queries(f.Calls()); !reflect.DeepEqual(got, want) {
+		t.Errorf("queries\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestFindByID(t *testing.T) {
+	f := fakedb.New()
+	f.On(`WHERE "id" = \$1$`).Return(accountColumns, []interface{}{int64(7), "acme", int64(3)}).Once()
+	f.On(`^SELECT`).Return(accountColumns)
+	db := f.DB(t)
+	a, err := database.FindByID[account](context.Background(), db, int64(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *a != (account{ID: 7, Name: "acme", Version: 3}) {
+		t.Errorf("FindByID = %+v", *a)
+	}
+	if _, err := database.FindByID[account](context.Background(), db, int64(8)); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing row: err = %v, want sql.ErrNoRows", err)
+	}
+}
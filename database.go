@@ -6,14 +6,18 @@ package database
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"regexp"
+	"runtime/debug"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4/stdlib"
-	"github.com/lib/pq"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type DB struct {
@@ -21,67 +25,355 @@ type DB struct {
 	tx        *sql.Tx
 	conn      *sql.Conn
 	txOptions sql.TxOptions
+
+	// nested makes Transaction use a savepoint when already in a transaction;
+	// savepoints is the current savepoint depth.
+	nested     bool
+	savepoints int
+	// afterCommit is shared by a transaction DB and its savepoints, see
+	// AfterCommit.
+	afterCommit *[]func()
+
+	// stmtHooks run on the driver connection before every statement.
+	stmtHooks []stmtHook
+
+	// lc is shared by a DB and the transaction DBs derived from it.
+	lc *lifecycle
+	// guards admit top-level operations, in order; lc is the first.
+	guards  []guard
+	breaker *breaker
+	limiter *rateLimiter
+
+	bulkheads       bulkheads
+	defaultWorkload string
+	queryTimeout    time.Duration
+	cancelBackend   bool
+
+	// gen is the pool generation; connections from an older one are
+	// discarded instead of reused.
+	gen        *atomic.Int64
+	dnsRefresh time.Duration
+	// stops stop the background work started for the DB.
+	stops []func()
+	// failoverReset retires the pool on failover-class errors.
+	failoverReset  bool
+	requirePrimary bool
+	pgBouncer      bool
+	// pgxPool backs the DB when it was opened with OpenPgx.
+	pgxPool *pgxpool.Pool
+	// pgxSessions holds the *pgx.Conn sessions of the pgxPool the
+	// connection setup already ran on.
+	pgxSessions *sync.Map
+	dialect     Dialect
+
+	tenantSchema func(tenantID string) string
+	// searchPath is the tenant schema of a DB returned by ForTenant.
+	searchPath string
+	rlsTables  *regexp.Regexp
+	appName    string
+
+	onConnect []func(context.Context, SessionConn) error
+	onAcquire []func(context.Context, SessionConn) error
+	onRelease []func(SessionConn) error
+
+	warmupQueries []string
+	tls           *TLSConfig
+	credentials   CredentialSource
+	expandEnv     bool
+	masking       *MaskingPolicy
+	retryPolicies map[sql.IsolationLevel]RetryPolicy
+	recoverPanics bool
+	// onRollbackError are told of failed rollbacks, see WithOnRollbackError.
+	onRollbackError []func(ctx context.Context, err error)
+	// constraintFields map constraint names to field names, see
+	// WithConstraintFields.
+	constraintFields map[string]string
+	errMap           *errorMap
+	hooks            []Hook
+	interceptors     []Interceptor
+	stats            *queryStats
+	profilerLabels   bool
+	cache            *queryCache
+}
+
+// Open opens a pool for dataSourceName. A DSN listing several hosts, or
+// setting target_session_attrs, connects to the first host whose session
+// matches, as libpq does, and fails over to another on reconnect. A
+// password_file parameter names a file the password is read from for each
+// new connection.
+func Open(driverName, dataSourceName string, opts ...Option) (*DB, error) {
+	sqldb, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	// Reopen through a connector so the connections can be wrapped.
+	drv := sqldb.Driver()
+	sqldb.Close()
+	return newDB(opts).openDriver(driverName, drv, dataSourceName)
 }
 
-func Open(driverName, dataSourceName string) (*DB, error) {
-	db, err := sql.Open(driverName, dataSourceName)
+// openDriver opens the pool of db, applying its options to dataSourceName
+// before opening connections with drv.
+func (db *DB) openDriver(driverName string, drv driver.Driver, dataSourceName string) (*DB, error) {
+	dsn, err := db.prepareDSN(dataSourceName)
 	if err != nil {
 		return nil, err
 	}
+	if db.pgBouncer {
+		dsn = pgBouncerDSN(driverName, dsn)
+	}
+	if db.tls != nil {
+		if dsn, err = db.tls.applyDSN(driverName, dsn); err != nil {
+			return nil, err
+		}
+	}
+	connector := func(dsn string) driver.Connector { return db.connector(drv, dsn) }
+	c, err := hostConnector(drv, dsn, connector)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		c = connector(dsn)
+	}
+	if _, err := db.open(sql.OpenDB(db.wrapConnector(c))); err != nil {
+		return nil, err
+	}
+	db.startDNSRefresh(dsnHostnames(dsn))
+	db.watchRotation()
+	return db, nil
+}
+
+// OpenDB is like Open but uses a driver.Connector, e.g. one that dials
+// through a proxy or a fake driver for tests.
+func OpenDB(c driver.Connector, opts ...Option) (*DB, error) {
+	db := newDB(opts)
+	return db.open(sql.OpenDB(db.wrapConnector(c)))
+}
+
+func newDB(opts []Option) *DB {
+	db := &DB{lc: &lifecycle{}, gen: &atomic.Int64{}, errMap: &errorMap{}}
+	db.cache = &queryCache{cache: NewMemoryCache(1000), flights: make(map[string]*flight)}
+	db.guards = []guard{db.lc}
+	for _, opt := range opts {
+		opt(db)
+	}
+	return db
+}
 
+func (db *DB) open(sqldb *sql.DB) (*DB, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	if err := db.PingContext(ctx); err != nil {
+	if err := sqldb.PingContext(ctx); err != nil {
+		sqldb.Close()
 		return nil, err
 	}
 
-	db.SetMaxOpenConns(30)
-	db.SetMaxIdleConns(30)
-	db.SetConnMaxLifetime(5 * time.Minute)
-	return &DB{db: db}, nil
+	sqldb.SetMaxOpenConns(30)
+	sqldb.SetMaxIdleConns(30)
+	sqldb.SetConnMaxLifetime(5 * time.Minute)
+	db.db = sqldb
+	return db, nil
 }
 
 func (db *DB) Close() error {
-	return db.db.Close()
+	return db.close()
 }
 
-func (db *DB) Exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+// close stops the DB's background work and closes its pools.
+func (db *DB) close() error {
+	for _, stop := range db.stops {
+		stop()
+	}
+	err := db.db.Close()
+	if db.pgxPool != nil {
+		db.pgxPool.Close()
+	}
+	return err
+}
+
+func (db *DB) Exec(ctx context.Context, query string, args ...interface{}) (n int64, err error) {
+	db.profile(ctx, "Exec", query, func(ctx context.Context) {
+		c := &Call{Op: "Exec", Query: query, Args: args}
+		err = db.intercept(ctx, c, func(ctx context.Context, c *Call) error {
+			return db.hookQuery(ctx, "Exec", c.Query, func(ctx context.Context) (err error) {
+				c.RowsAffected, err = db.execute(ctx, c.Query, c.Args...)
+				return err
+			})
+		})
+		n = c.RowsAffected
+	})
+	return n, err
+}
+
+func (db *DB) execute(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	start := time.Now()
+	ctx, args = withCallOptions(ctx, args)
 	res, err := db.exec(ctx, query, args...)
 	if err != nil {
-		return 0, err
+		return 0, queryError(ctx, "Exec", query, start, db.maskError(db.mapError(err)))
 	}
 	n, err := res.RowsAffected()
 	if err != nil {
 		return 0, err
 	}
+	db.invalidateWritten(ctx)
 	return n, nil
 }
 
-func (db *DB) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+func (db *DB) exec(ctx context.Context, query string, args ...interface{}) (res sql.Result, err error) {
+	if db.pgBouncer && db.tx == nil {
+		if cfg := callConfigFrom(ctx); cfg != nil && cfg.statementTimeout > 0 {
+			// The SET LOCAL for the timeout needs a transaction to last for.
+			err = db.Transaction(ctx, sql.LevelDefault, func(tx *DB) error {
+				res, err = tx.exec(ctx, query, args...)
+				return err
+			})
+			return res, err
+		}
+	}
+	ctx = db.writeContext(ctx)
+	ctx, end, err := db.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { end(err) }()
+	ctx, cancel := db.statementContext(ctx)
+	defer cancel()
 	if db.tx != nil {
 		return db.tx.ExecContext(ctx, query, args...)
 	}
 	return db.db.ExecContext(ctx, query, args...)
 }
 
-func (db *DB) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+func (db *DB) Query(ctx context.Context, query string, args ...interface{}) (rows *sql.Rows, err error) {
+	db.profile(ctx, "Query", query, func(ctx context.Context) {
+		c := &Call{Op: "Query", Query: query, Args: args}
+		err = db.intercept(ctx, c, func(ctx context.Context, c *Call) error {
+			return db.hookQuery(ctx, "Query", c.Query, func(ctx context.Context) (err error) {
+				c.Rows, err = db.query(ctx, c.Query, c.Args...)
+				return err
+			})
+		})
+		if err == nil && c.Rows == nil {
+			err = errNoResult
+		}
+		rows = c.Rows
+	})
+	return rows, err
+}
+
+func (db *DB) query(ctx context.Context, query string, args ...interface{}) (rows *sql.Rows, err error) {
+	start := time.Now()
+	ctx, args = withCallOptions(ctx, args)
+	query = lockQuery(ctx, query)
+	ctx = db.queryWriteContext(ctx, query)
+	ctx, end, err := db.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The guards and the statement deadline hold until the rows are
+	// closed, since they hold the connection.
+	ctx, cancel := db.statementContext(ctx)
+	ctx, rel := withRowsRelease(ctx, func() {
+		cancel()
+		end(nil)
+	})
 	if db.tx != nil {
-		return db.tx.QueryContext(ctx, query, args...)
+		rows, err = db.tx.QueryContext(ctx, query, args...)
+	} else {
+		rows, err = db.db.QueryContext(ctx, query, args...)
+	}
+	if err != nil {
+		err = queryError(ctx, "Query", query, start, db.maskError(db.mapError(lockError(err))))
+		cancel()
+		end(err)
+		return nil, err
 	}
-	return db.db.QueryContext(ctx, query, args...)
+	rel.done()
+	return rows, nil
 }
 
 func (db *DB) QueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	c := &Call{Op: "QueryRow", Query: query, Args: args}
+	err := db.intercept(ctx, c, func(ctx context.Context, c *Call) error {
+		c.Row = db.queryRow(ctx, c.Query, c.Args...)
+		return nil
+	})
+	switch {
+	case err != nil:
+		return errRow(err)
+	case c.Row == nil:
+		return errRow(errNoResult)
+	}
+	return c.Row
+}
+
+func (db *DB) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, args = withCallOptions(ctx, args)
+	query = lockQuery(ctx, query)
+	ctx = db.queryWriteContext(ctx, query)
+	ctx, end, err := db.begin(ctx)
+	if err != nil {
+		return errRow(err)
+	}
+	ctx, cancel := db.statementContext(ctx)
+	ctx, rel := withRowsRelease(ctx, func() {
+		cancel()
+		end(nil)
+	})
+	var row *sql.Row
 	if db.tx != nil {
-		return db.tx.QueryRowContext(ctx, query, args...)
+		row = db.tx.QueryRowContext(ctx, query, args...)
+	} else {
+		row = db.db.QueryRowContext(ctx, query, args...)
 	}
-	return db.db.QueryRowContext(ctx, query, args...)
+	if err := row.Err(); err != nil {
+		cancel()
+		end(err)
+		return row
+	}
+	// The guards and the deadline hold until Scan closes the row.
+	rel.done()
+	return row
 }
 
 func (db *DB) Transaction(ctx context.Context, iso sql.IsolationLevel, f func(*DB) error) error {
-	opts := &sql.TxOptions{Isolation: iso}
-	if canRetry(iso) {
-		if err := db.transactionRetry(ctx, opts, f); err != nil {
+	return db.runTransaction(ctx, &sql.TxOptions{Isolation: iso}, f)
+}
+
+// ReadOnlyTransaction is like Transaction but starts a READ ONLY transaction.
+func (db *DB) ReadOnlyTransaction(ctx context.Context, iso sql.IsolationLevel, f func(*DB) error) error {
+	return db.runTransaction(ctx, &sql.TxOptions{Isolation: iso, ReadOnly: true}, f)
+}
+
+func (db *DB) runTransaction(ctx context.Context, opts *sql.TxOptions, f func(*DB) error) (err error) {
+	db.profile(ctx, "Transaction", "", func(ctx context.Context) {
+		err = db.hookTx(ctx, opts, func(ctx context.Context) error {
+			return db.runTx(ctx, opts, f)
+		})
+	})
+	return err
+}
+
+func (db *DB) runTx(ctx context.Context, opts *sql.TxOptions, f func(*DB) error) (err error) {
+	defer func() { err = db.maskError(db.mapError(err)) }()
+	iso := opts.Isolation
+	if db.tx != nil && db.nested {
+		if err := db.Savepoint(ctx, f); err != nil {
+			return fmt.Errorf("Transaction(%s): %w", iso, err)
+		}
+		return nil
+	}
+	if !opts.ReadOnly {
+		ctx = db.writeContext(ctx)
+	}
+	ctx, end, err := db.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Transaction(%s): %w", iso, err)
+	}
+	defer func() { end(guardError(err)) }()
+	if p, ok := db.retryPolicy(iso); ok && ctx.Value(noRetryKey{}) == nil {
+		if err := db.transactionRetry(ctx, opts, p, f); err != nil {
 			return fmt.Errorf("Transaction(%s): %w", iso, err)
 		}
 		return nil
@@ -92,46 +384,55 @@ func (db *DB) Transaction(ctx context.Context, iso sql.IsolationLevel, f func(*D
 	return nil
 }
 
-func canRetry(iso sql.IsolationLevel) bool {
-	return iso == sql.LevelRepeatableRead || iso == sql.LevelSerializable
-}
-
-// transactionRetry runs a transaction with the given isolation level and retries it if a serialization failure occurs.
-func (db *DB) transactionRetry(ctx context.Context, opts *sql.TxOptions, f func(*DB) error) error {
-	const maxRetries = 3
-	dur := 150 * time.Millisecond
-	for i := 0; i < maxRetries; i++ {
-		err := db.transaction(ctx, opts, f)
-		if isSerializationFailure(err) {
-			time.Sleep(dur)
-			dur *= 2
-			continue
+// transactionRetry runs a transaction with the given isolation level and retries it if a serialization failure occurs,
+// or another error the dialect considers retryable, as policy p allows. Once
+// it has retried, it returns a *RetryError.
+func (db *DB) transactionRetry(ctx context.Context, opts *sql.TxOptions, p RetryPolicy, f func(*DB) error) error {
+	start := time.Now()
+	dur := p.Backoff
+	var err error
+	for i := 0; i < p.MaxAttempts; i++ {
+		if cerr := ctx.Err(); cerr != nil {
+			if i == 0 {
+				return cerr
+			}
+			return &RetryError{Attempts: i, Elapsed: time.Since(start), Err: err, reason: cerr}
 		}
-		if err != nil {
-			if strings.Contains(err.Error(), serializationFailureCode) {
-				return fmt.Errorf("serialization failure: %w", err)
+		err = db.transaction(context.WithValue(ctx, attemptKey{}, i+1), opts, f)
+		if !db.Dialect().IsRetryable(err) {
+			if err != nil && strings.Contains(err.Error(), serializationFailureCode) {
+				err = fmt.Errorf("serialization failure: %w", err)
+			}
+			if err != nil && i > 0 {
+				return &RetryError{Attempts: i + 1, Elapsed: time.Since(start), Err: err}
 			}
+			return err
 		}
-		return err
+		if i+1 == p.MaxAttempts {
+			break
+		}
+		// Give up rather than sleep past the caller's deadline.
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < dur {
+			return &RetryError{Attempts: i + 1, Elapsed: time.Since(start), Err: err, reason: ErrRetryBudgetExhausted}
+		}
+		t := time.NewTimer(dur)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+		}
+		dur *= 2
 	}
-	return fmt.Errorf("transaction failed after %d retries", maxRetries)
+	return &RetryError{Attempts: p.MaxAttempts, Elapsed: time.Since(start), Err: err, reason: ErrRetryBudgetExhausted}
 }
 
 // serializationFailureCode is the SQLSTATE code for serialization failure.
 const serializationFailureCode = "40001"
 
 // isSerializationFailure returns true if the error is a serialization failure.
-// It works with both pq.Error and pgconn.PgError.
+// It works with lib/pq and both pgx versions.
 func isSerializationFailure(err error) bool {
-	var perr *pq.Error
-	if errors.As(err, &perr) && perr.Code == serializationFailureCode {
-		return true
-	}
-	var gerr *pgconn.PgError
-	if errors.As(err, &gerr) && gerr.Code == serializationFailureCode {
-		return true
-	}
-	return false
+	return SQLState(err) == serializationFailureCode
 }
 
 func (db *DB) transaction(ctx context.Context, opts *sql.TxOptions, f func(*DB) error) (err error) {
@@ -149,26 +450,99 @@ func (db *DB) transaction(ctx context.Context, opts *sql.TxOptions, f func(*DB)
 	if err != nil {
 		return fmt.Errorf("conn.BeginTx(): %w", err)
 	}
+	// returned stays false if f exits through runtime.Goexit (e.g. t.FailNow),
+	// which must not commit.
+	returned := false
+	var hooks []func()
+	rollback := func() {
+		rerr := tx.Rollback()
+		if rerr == nil || errors.Is(rerr, sql.ErrTxDone) {
+			return
+		}
+		rerr = fmt.Errorf("tx.Rollback(): %w", rerr)
+		// The session may still be in the transaction; it must not be reused.
+		conn.Raw(func(dc interface{}) error {
+			if wc, ok := dc.(*wrappedConn); ok {
+				wc.poisoned = true
+			}
+			return nil
+		})
+		for _, h := range db.onRollbackError {
+			h(ctx, rerr)
+		}
+		err = errors.Join(err, rerr)
+	}
 	defer func() {
 		if p := recover(); p != nil {
-			tx.Rollback()
-			panic(p)
-		} else if err != nil {
-			tx.Rollback()
+			if !db.recoverPanics {
+				rollback()
+				panic(p)
+			}
+			err = &PanicError{Value: p, Stack: debug.Stack()}
+			rollback()
+		} else if err != nil || !returned {
+			rollback()
 		} else {
 			if txErr := tx.Commit(); txErr != nil {
-				fmt.Println("tx.Commit(): ", txErr)
-				err = fmt.Errorf("tx.Commit(): %w", err)
+				err = fmt.Errorf("tx.Commit(): %w", txErr)
+			} else {
+				for _, f := range hooks {
+					f()
+				}
 			}
 		}
 	}()
 
-	dbtx := &DB{db: db.db}
+	dbtx := *db
 	dbtx.tx = tx
 	dbtx.conn = conn
 	dbtx.txOptions = *opts
-	if err := f(dbtx); err != nil {
-		return fmt.Errorf("call f(tx): %w", err)
+	dbtx.savepoints = 0
+	dbtx.afterCommit = &hooks
+	if err := dbtx.applyAppTag(ctx); err != nil {
+		return err
+	}
+	if err := dbtx.applyAuditContext(ctx); err != nil {
+		return err
+	}
+	err = f(&dbtx)
+	returned = true
+	if err != nil {
+		return &callbackError{err}
 	}
 	return nil
 }
+
+// callbackError is the error of a Transaction callback.
+type callbackError struct {
+	err error
+}
+
+func (e *callbackError) Error() string {
+	return "call f(tx): " + e.err.Error()
+}
+
+func (e *callbackError) Unwrap() error {
+	return e.err
+}
+
+// guardError returns the part of a Transaction's error the guards see,
+// without the errors of its callback, which are the caller's and say
+// nothing about the database.
+func guardError(err error) error {
+	switch e := err.(type) {
+	case nil, *callbackError, *PanicError:
+		return nil
+	case interface{ Unwrap() []error }:
+		var errs []error
+		for _, err := range e.Unwrap() {
+			if err := guardError(err); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	case interface{ Unwrap() error }:
+		return guardError(e.Unwrap())
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+// Package datadog traces the statements of a database.DB with dd-trace-go,
+// as spans named and tagged the way Datadog's APM expects of a database
+// client:
+//
+//	tracer.Start(tracer.WithService("orders"))
+//	defer tracer.Stop()
+//	db, err := database.Open("postgres", dsn, datadog.Tracing(datadog.Config{Service: "orders-postgres"}))
+//
+// Each Exec and Query, and so Get and Select, becomes a span of type "sql"
+// with the statement as its resource, child of the span in the call's
+// context. The tracing is an AfterQuery database.Hook, so it combines with
+// the DB's other hooks.
+package datadog
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkrypt0987/database"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// Config configures the spans of Tracing.
+type Config struct {
+	// Service is the service name of the spans. Defaults to "postgres", so
+	// the database shows as its own service in the service map.
+	Service string
+	// SpanName is the operation name of the spans. Defaults to
+	// "postgres.query".
+	SpanName string
+	// Tags are added to every span, e.g. {"db.name": "orders"}.
+	Tags map[string]interface{}
+}
+
+// Tracing returns the option that traces the DB's statements.
+func Tracing(cfg Config) database.Option {
+	if cfg.Service == "" {
+		cfg.Service = "postgres"
+	}
+	if cfg.SpanName == "" {
+		cfg.SpanName = "postgres.query"
+	}
+	return database.WithHook(database.HookFuncs{AfterQueryFunc: func(ctx context.Context, e database.QueryEvent) {
+		end := time.Now()
+		opts := []tracer.StartSpanOption{
+			tracer.ServiceName(cfg.Service),
+			tracer.ResourceName(e.Query),
+			tracer.SpanType(ext.SpanTypeSQL),
+			tracer.StartTime(end.Add(-e.Duration)),
+			tracer.Tag(ext.SpanKind, ext.SpanKindClient),
+			tracer.Tag(ext.DBSystem, ext.DBSystemPostgreSQL),
+			tracer.Tag(ext.Component, "pkrypt0987/database"),
+			tracer.Tag("sql.query_type", e.Op),
+			tracer.Tag("db.fingerprint", e.Fingerprint),
+		}
+		for k, v := range cfg.Tags {
+			opts = append(opts, tracer.Tag(k, v))
+		}
+		for k, v := range e.Labels {
+			opts = append(opts, tracer.Tag(k, v))
+		}
+		span, _ := tracer.StartSpanFromContext(ctx, cfg.SpanName, opts...)
+		span.Finish(tracer.FinishTime(end), tracer.WithError(e.Err))
+	}})
+}
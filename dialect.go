@@ -0,0 +1,162 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect describes the SQL differences between database engines that the
+// package's helpers depend on.
+type Dialect interface {
+	Name() string
+	// Placeholder returns the bind parameter for the n-th argument, from 1.
+	Placeholder(n int) string
+	// QuoteIdent quotes a possibly qualified identifier such as "public.users".
+	QuoteIdent(name string) string
+	// IsRetryable reports whether a transaction that failed with err may
+	// succeed if run again, e.g. after a serialization failure or deadlock.
+	IsRetryable(err error) bool
+	// Upsert returns an INSERT of columns into table that, on a conflict on
+	// the conflict columns, updates the update columns, or does nothing if
+	// update is empty.
+	Upsert(table string, columns, conflict, update []string) string
+	// AdvisoryLocks reports whether the engine has advisory locks.
+	AdvisoryLocks() bool
+	// Returning reports whether INSERT and UPDATE can return the written
+	// rows with RETURNING.
+	Returning() bool
+}
+
+var (
+	Postgres Dialect = postgresDialect{}
+	MySQL    Dialect = mysqlDialect{}
+	SQLite   Dialect = sqliteDialect{}
+)
+
+// WithDialect sets the dialect of the database. Defaults to Postgres.
+func WithDialect(d Dialect) Option {
+	return func(db *DB) {
+		db.dialect = d
+	}
+}
+
+// Dialect returns the database's dialect.
+func (db *DB) Dialect() Dialect {
+	if db.dialect == nil {
+		return Postgres
+	}
+	return db.dialect
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string                  { return "postgres" }
+func (postgresDialect) Placeholder(n int) string      { return fmt.Sprintf("$%d", n) }
+func (postgresDialect) QuoteIdent(name string) string { return quoteIdent(name) }
+func (postgresDialect) AdvisoryLocks() bool           { return true }
+func (postgresDialect) Returning() bool               { return true }
+
+func (postgresDialect) IsRetryable(err error) bool {
+	return isSerializationFailure(err) || SQLState(err) == "40P01" // deadlock_detected
+}
+
+func (d postgresDialect) Upsert(table string, columns, conflict, update []string) string {
+	return insertSQL(d, table, columns) + " ON CONFLICT (" + quoteList(d, conflict) + ") " + excludedSet(d, update, "EXCLUDED")
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string           { return "mysql" }
+func (mysqlDialect) Placeholder(int) string { return "?" }
+func (mysqlDialect) AdvisoryLocks() bool    { return true }
+func (mysqlDialect) Returning() bool        { return false }
+
+func (mysqlDialect) QuoteIdent(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = "`" + strings.ReplaceAll(p, "`", "``") + "`"
+	}
+	return strings.Join(parts, ".")
+}
+
+// IsRetryable matches deadlocks (1213) and lock wait timeouts (1205) by their
+// error text, to avoid depending on a MySQL driver.
+func (mysqlDialect) IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "Error 1213") || strings.Contains(msg, "Error 1205")
+}
+
+func (d mysqlDialect) Upsert(table string, columns, conflict, update []string) string {
+	if len(update) == 0 {
+		return "INSERT IGNORE" + strings.TrimPrefix(insertSQL(d, table, columns), "INSERT")
+	}
+	sets := make([]string, len(update))
+	for i, c := range update {
+		q := d.QuoteIdent(c)
+		sets[i] = q + " = VALUES(" + q + ")"
+	}
+	return insertSQL(d, table, columns) + " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string           { return "sqlite" }
+func (sqliteDialect) Placeholder(int) string { return "?" }
+func (sqliteDialect) AdvisoryLocks() bool    { return false }
+func (sqliteDialect) Returning() bool        { return true }
+
+func (sqliteDialect) QuoteIdent(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = `"` + strings.ReplaceAll(p, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
+// IsRetryable matches SQLITE_BUSY and SQLITE_LOCKED by their error text, to
+// avoid depending on a SQLite driver.
+func (sqliteDialect) IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "SQLITE_BUSY") ||
+		strings.Contains(msg, "database table is locked")
+}
+
+func (d sqliteDialect) Upsert(table string, columns, conflict, update []string) string {
+	return insertSQL(d, table, columns) + " ON CONFLICT (" + quoteList(d, conflict) + ") " + excludedSet(d, update, "excluded")
+}
+
+func insertSQL(d Dialect, table string, columns []string) string {
+	ph := make([]string, len(columns))
+	for i := range columns {
+		ph[i] = d.Placeholder(i + 1)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", d.QuoteIdent(table), quoteList(d, columns), strings.Join(ph, ", "))
+}
+
+func quoteList(d Dialect, names []string) string {
+	qs := make([]string, len(names))
+	for i, n := range names {
+		qs[i] = d.QuoteIdent(n)
+	}
+	return strings.Join(qs, ", ")
+}
+
+// excludedSet is the DO clause of ON CONFLICT for the Postgres-style
+// dialects.
+func excludedSet(d Dialect, update []string, excluded string) string {
+	if len(update) == 0 {
+		return "DO NOTHING"
+	}
+	sets := make([]string, len(update))
+	for i, c := range update {
+		q := d.QuoteIdent(c)
+		sets[i] = q + " = " + excluded + "." + q
+	}
+	return "DO UPDATE SET " + strings.Join(sets, ", ")
+}
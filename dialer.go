@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DialFunc opens the network connection to the server.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// OpenWithDialer is like Open with the "postgres" driver but dials every
+// connection with dial, e.g. through a tunnel or a cloud provider's
+// connector library, instead of over plain TCP.
+func OpenWithDialer(dataSourceName string, dial DialFunc, opts ...Option) (*DB, error) {
+	if _, err := pq.NewConnector(dataSourceName); err != nil {
+		return nil, err
+	}
+	return newDB(opts).openDriver("postgres", dialDriver(dial), dataSourceName)
+}
+
+// dialDriver is lib/pq's driver dialing with a DialFunc.
+type dialDriver DialFunc
+
+func (d dialDriver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+func (d dialDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	c, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	c.Dialer(pqDialer(d))
+	return c, nil
+}
+
+// pqDialer adapts a DialFunc to lib/pq's dialer interfaces.
+type pqDialer DialFunc
+
+func (d pqDialer) Dial(network, address string) (net.Conn, error) {
+	return d(context.Background(), network, address)
+}
+
+func (d pqDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d(ctx, network, address)
+}
+
+func (d pqDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d(ctx, network, address)
+}
+
+// OpenCloudSQL opens a Cloud SQL for PostgreSQL instance, given by its
+// connection name ("project:region:instance"), dialing through dial, which
+// is typically the Cloud SQL Go connector's Dial:
+//
+//	d, err := cloudsqlconn.NewDialer(ctx, cloudsqlconn.WithIAMAuthN())
+//	db, err := database.OpenCloudSQL("proj:us-central1:main", "user=svc@proj.iam dbname=app",
+//		func(ctx context.Context, instance string) (net.Conn, error) { return d.Dial(ctx, instance) })
+//
+// The connector encrypts and authorizes the connection itself, so TLS is
+// disabled in the DSN, WithTLS is an error and no auth proxy sidecar is
+// needed.
+func OpenCloudSQL(instance, dataSourceName string, dial func(ctx context.Context, instance string) (net.Conn, error), opts ...Option) (*DB, error) {
+	db := newDB(opts)
+	if db.tls != nil {
+		return nil, fmt.Errorf("OpenCloudSQL(%s): WithTLS cannot be used, the connector encrypts the connection", instance)
+	}
+	dsn := dsnWithParam(dataSourceName, "sslmode", "disable")
+	db, err := db.openDriver("postgres", dialDriver(func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dial(ctx, instance)
+	}), dsn)
+	if err != nil {
+		return nil, fmt.Errorf("OpenCloudSQL(%s): %w", instance, err)
+	}
+	return db, nil
+}
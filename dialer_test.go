@@ -0,0 +1,46 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/pkrypt0987/database"
+)
+
+type credentialFunc func(ctx context.Context) (string, string, error)
+
+func (f credentialFunc) GetCredentials(ctx context.Context) (string, string, error) { return f(ctx) }
+
+func TestOpenWithDialerOptions(t *testing.T) {
+	errDial := errors.New("no route")
+	var addrs []string
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		addrs = append(addrs, address)
+		return nil, errDial
+	}
+	asked := 0
+	creds := credentialFunc(func(context.Context) (string, string, error) {
+		asked++
+		return "svc", "hunter2", nil
+	})
+	if _, err := database.OpenWithDialer("host=db.internal port=6432 dbname=app", dial, database.WithCredentials(creds)); err == nil {
+		t.Fatal("OpenWithDialer succeeded without a server")
+	}
+	if asked == 0 || len(addrs) == 0 || addrs[0] != "db.internal:6432" {
+		t.Errorf("credentials asked %d times, dialed %q; want the credentials used and the DSN host dialed", asked, addrs)
+	}
+
+	addrs = nil
+	_, err := database.OpenWithDialer("host=db.internal dbname=app", dial, database.WithTLS(database.TLSConfig{Mode: "verify-full", ServerName: "db"}))
+	if err == nil || len(addrs) != 0 {
+		t.Errorf("unsupported TLS option: err = %v after dialing %q, want an error before dialing", err, addrs)
+	}
+	_, err = database.OpenCloudSQL("proj:region:main", "dbname=app", func(context.Context, string) (net.Conn, error) {
+		return nil, errDial
+	}, database.WithTLS(database.TLSConfig{Mode: "require"}))
+	if err == nil || errors.Is(err, errDial) {
+		t.Errorf("OpenCloudSQL with WithTLS: err = %v, want it rejected before dialing", err)
+	}
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// DiffQuery is one side of a Diff.
+type DiffQuery struct {
+	DB    *DB
+	Query string
+	Args  []interface{}
+}
+
+// RowDiff is a row that differs between the two sides of a Diff. Old is
+// nil for an added row and New for a removed one.
+type RowDiff struct {
+	Key map[string]interface{}
+	Old map[string]interface{}
+	New map[string]interface{}
+	// Changed are the columns whose values differ, in column order.
+	Changed []string
+}
+
+// DiffResult is the outcome of a Diff. Removed and Changed are in the
+// order of the old rows, Added in that of the new ones.
+type DiffResult struct {
+	Added   []RowDiff
+	Removed []RowDiff
+	Changed []RowDiff
+}
+
+// Equal reports whether both sides had the same rows.
+func (r *DiffResult) Equal() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Changed) == 0
+}
+
+// Diff runs oldQuery and newQuery, e.g. a query and its rewrite, or the
+// same query on the primary and a replica, and reports the rows added,
+// removed and changed, matching rows by keyColumns. Both results are held
+// in memory. It fails if a key occurs twice on one side.
+func Diff(ctx context.Context, oldQuery, newQuery DiffQuery, keyColumns ...string) (*DiffResult, error) {
+	if len(keyColumns) == 0 {
+		return nil, fmt.Errorf("Diff(): no key columns")
+	}
+	oldRows, err := diffRows(ctx, oldQuery, keyColumns)
+	if err != nil {
+		return nil, fmt.Errorf("Diff(): old: %w", err)
+	}
+	newRows, err := diffRows(ctx, newQuery, keyColumns)
+	if err != nil {
+		return nil, fmt.Errorf("Diff(): new: %w", err)
+	}
+	res := &DiffResult{}
+	for _, o := range oldRows.rows {
+		n, ok := newRows.byKey[o.key]
+		if !ok {
+			res.Removed = append(res.Removed, RowDiff{Key: o.keyValues, Old: o.values})
+			continue
+		}
+		var changed []string
+		for _, c := range oldRows.columns {
+			nv, ok := n.values[c]
+			if !ok || !diffEqual(o.values[c], nv) {
+				changed = append(changed, c)
+			}
+		}
+		for _, c := range newRows.columns {
+			if _, ok := o.values[c]; !ok {
+				changed = append(changed, c)
+			}
+		}
+		if changed != nil {
+			res.Changed = append(res.Changed, RowDiff{Key: o.keyValues, Old: o.values, New: n.values, Changed: changed})
+		}
+	}
+	for _, n := range newRows.rows {
+		if _, ok := oldRows.byKey[n.key]; !ok {
+			res.Added = append(res.Added, RowDiff{Key: n.keyValues, New: n.values})
+		}
+	}
+	return res, nil
+}
+
+type diffRow struct {
+	key       string
+	keyValues map[string]interface{}
+	values    map[string]interface{}
+}
+
+type diffSide struct {
+	columns []string
+	rows    []*diffRow
+	byKey   map[string]*diffRow
+}
+
+func diffRows(ctx context.Context, q DiffQuery, keyColumns []string) (*diffSide, error) {
+	side := &diffSide{byKey: map[string]*diffRow{}}
+	_, err := q.DB.exportRows(ctx, q.Query, q.Args, func(cols []*sql.ColumnType) error {
+		for _, c := range cols {
+			side.columns = append(side.columns, c.Name())
+		}
+		for _, k := range keyColumns {
+			if !contains(side.columns, k) {
+				return fmt.Errorf("no key column %s", k)
+			}
+		}
+		return nil
+	}, func(_ []*sql.ColumnType, vals []interface{}) error {
+		r := &diffRow{keyValues: map[string]interface{}{}, values: map[string]interface{}{}}
+		for i, v := range vals {
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			r.values[side.columns[i]] = v
+		}
+		key := make([]interface{}, len(keyColumns))
+		for i, k := range keyColumns {
+			r.keyValues[k] = r.values[k]
+			key[i] = r.values[k]
+		}
+		b, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		r.key = string(b)
+		if _, dup := side.byKey[r.key]; dup {
+			return fmt.Errorf("duplicate key %s", r.key)
+		}
+		side.byKey[r.key] = r
+		side.rows = append(side.rows, r)
+		return nil
+	})
+	return side, err
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func diffEqual(a, b interface{}) bool {
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		return ok && at.Equal(bt)
+	}
+	return reflect.DeepEqual(a, b)
+}
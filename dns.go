@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithDNSRefresh re-resolves the DSN's host names every interval and, when
+// the addresses of any of them change, retires the pooled connections so new
+// ones are dialed to the current endpoint. This picks up RDS/Aurora endpoint
+// flips and Kubernetes service changes without waiting for the connections'
+// max lifetime. It has no effect with OpenDB, which has no DSN.
+func WithDNSRefresh(interval time.Duration) Option {
+	return func(db *DB) {
+		db.dnsRefresh = interval
+	}
+}
+
+// startDNSRefresh starts re-resolving hosts in the background.
+func (db *DB) startDNSRefresh(hosts []string) {
+	var names []string
+	for _, h := range hosts {
+		if h != "" && !strings.HasPrefix(h, "/") && net.ParseIP(h) == nil {
+			names = append(names, h)
+		}
+	}
+	if db.dnsRefresh <= 0 || len(names) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	var once sync.Once
+	db.stops = append(db.stops, func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	})
+	go func() {
+		defer close(done)
+		known := make(map[string]string)
+		resolve(ctx, names, known)
+		t := time.NewTicker(db.dnsRefresh)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			if resolve(ctx, names, known) {
+				db.retireConns()
+			}
+		}
+	}()
+}
+
+// resolve looks up names, recording their sorted addresses in known, and
+// reports whether a previously known name now resolves differently. Names
+// that fail to resolve keep their last addresses.
+func resolve(ctx context.Context, names []string, known map[string]string) bool {
+	changed := false
+	for _, name := range names {
+		lctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		addrs, err := net.DefaultResolver.LookupHost(lctx, name)
+		cancel()
+		if err != nil || len(addrs) == 0 {
+			continue
+		}
+		sort.Strings(addrs)
+		joined := strings.Join(addrs, ",")
+		if prev, ok := known[name]; ok && prev != joined {
+			changed = true
+		}
+		known[name] = joined
+	}
+	return changed
+}
+
+// dsnHostnames returns the host names in a DSN, one per listed host.
+func dsnHostnames(dsn string) []string {
+	dsns, _, err := splitHosts(dsn)
+	if err != nil {
+		return nil
+	}
+	var hosts []string
+	for _, d := range dsns {
+		if strings.HasPrefix(d, "postgres://") || strings.HasPrefix(d, "postgresql://") {
+			if u, err := url.Parse(d); err == nil {
+				hosts = append(hosts, u.Hostname())
+			}
+			continue
+		}
+		for _, kv := range splitKeywords(d) {
+			if k, v, _ := strings.Cut(kv, "="); strings.TrimSpace(k) == "host" {
+				hosts = append(hosts, unquote(v))
+			}
+		}
+	}
+	return hosts
+}
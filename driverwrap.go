@@ -0,0 +1,332 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// stmtHook runs in the driver connection before a statement is sent. A
+// non-nil error is returned to the caller instead of running the statement.
+type stmtHook func(ctx context.Context, query string) error
+
+func (db *DB) wrapConnector(c driver.Connector) driver.Connector {
+	return &wrappedConnector{Connector: c, db: db}
+}
+
+// dsnConnector returns a connector for dsn, like sql.Open does internally.
+func dsnConnector(drv driver.Driver, dsn string) driver.Connector {
+	if dc, ok := drv.(driver.DriverContext); ok {
+		if c, err := dc.OpenConnector(dsn); err == nil {
+			return c
+		}
+	}
+	return &dsnConn{drv: drv, dsn: dsn}
+}
+
+// connValue runs a single-value query on a driver connection that is not
+// yet in the pool.
+func connValue(ctx context.Context, conn driver.Conn, query string) (driver.Value, error) {
+	q, ok := conn.(driver.QueryerContext)
+	if !ok {
+		return nil, errors.New("database: driver does not implement driver.QueryerContext")
+	}
+	rows, err := q.QueryContext(ctx, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, len(rows.Columns()))
+	if err := rows.Next(dest); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("database: %s returned no rows", query)
+		}
+		return nil, err
+	}
+	if len(dest) == 0 {
+		return nil, fmt.Errorf("database: %s returned no columns", query)
+	}
+	return dest[0], nil
+}
+
+type dsnConn struct {
+	drv driver.Driver
+	dsn string
+}
+
+func (c *dsnConn) Connect(context.Context) (driver.Conn, error) { return c.drv.Open(c.dsn) }
+func (c *dsnConn) Driver() driver.Driver                        { return c.drv }
+
+type wrappedConnector struct {
+	driver.Connector
+	db *DB
+}
+
+func (c *wrappedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	wc := &wrappedConn{Conn: conn, db: c.db, gen: c.db.gen.Load()}
+	pc, seen := c.db.pgxSession(conn)
+	if pc != nil {
+		wc.pooled = true
+		if c.db.cancelBackend && !c.db.pgBouncer {
+			wc.pid = int64(pc.PgConn().PID())
+		}
+		if seen {
+			return wc, nil
+		}
+	}
+	if err := c.db.setApplicationName(ctx, conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if pc == nil && c.db.cancelBackend && !c.db.pgBouncer {
+		wc.pid = backendPID(ctx, conn)
+	}
+	if err := wc.connected(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if pc != nil {
+		c.db.pgxSessions.Store(pc, struct{}{})
+	}
+	return wc, nil
+}
+
+// wrappedConn forwards to the driver connection, running the DB's hooks
+// around it. Optional interfaces the driver lacks report driver.ErrSkip so
+// database/sql falls back as it would without the wrapper.
+type wrappedConn struct {
+	driver.Conn
+	db *DB
+	// pid is the server process ID, known with WithCancelBackend.
+	pid int64
+	// timeoutSet is true while a per-call statement_timeout is in effect.
+	timeoutSet bool
+	// gen is the pool generation the connection was made in.
+	gen int64
+	// primaryChecked is true once WithRequirePrimary has verified the
+	// connection since it was checked out.
+	primaryChecked bool
+	// inTx is true while a transaction is open on the connection.
+	inTx bool
+	// searchPath is the tenant schema in the session's search_path, "" for
+	// the default.
+	searchPath string
+	// rlsSet is true once SetRLSContext ran in the open transaction.
+	rlsSet bool
+	// acquired is true once the acquire hooks ran for the current checkout.
+	acquired bool
+	// poisoned is set when a rollback failed, leaving the session in an
+	// unknown state, or a statement hook reported the connection dropped;
+	// the pool discards the connection.
+	poisoned bool
+	// pooled is true when closing the connection hands its session back to
+	// a pgxpool rather than ending it.
+	pooled bool
+}
+
+// retireConns makes the pool discard its current connections as they are
+// next checked out or returned, instead of reusing them.
+func (db *DB) retireConns() {
+	db.gen.Add(1)
+}
+
+func (c *wrappedConn) retired() bool {
+	return c.gen != c.db.gen.Load()
+}
+
+func (c *wrappedConn) before(ctx context.Context, query string) error {
+	if err := c.acquire(ctx); err != nil {
+		return err
+	}
+	if err := c.checkRLS(ctx, query); err != nil {
+		return err
+	}
+	if err := c.applySearchPath(ctx); err != nil {
+		return err
+	}
+	if err := c.applyCallTimeout(ctx); err != nil {
+		return err
+	}
+	for _, h := range c.db.stmtHooks {
+		if err := h(ctx, query); err != nil {
+			// A hook reporting a dropped connection (FaultConnDrop) leaves it
+			// as unusable as a real drop would.
+			c.poisoned = c.poisoned || isConnError(err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *wrappedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ex, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.before(ctx, query); err != nil {
+		return nil, err
+	}
+	if err := c.verifyPrimary(ctx); err != nil {
+		return nil, err
+	}
+	defer c.watchCancel(ctx)()
+	res, err := ex.ExecContext(ctx, query, args)
+	c.observe(err)
+	return res, err
+}
+
+func (c *wrappedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.before(ctx, query); err != nil {
+		return nil, err
+	}
+	if err := c.verifyPrimary(ctx); err != nil {
+		return nil, err
+	}
+	defer c.watchCancel(ctx)()
+	rows, err := q.QueryContext(ctx, query, args)
+	c.observe(err)
+	if err != nil {
+		return nil, err
+	}
+	return wrapRows(ctx, rows), nil
+}
+
+func (c *wrappedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := c.before(ctx, query); err != nil {
+		return nil, err
+	}
+	if err := c.verifyPrimary(ctx); err != nil {
+		return nil, err
+	}
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *wrappedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := c.acquire(ctx); err != nil {
+		return nil, err
+	}
+	if err := c.verifyPrimary(ctx); err != nil {
+		return nil, err
+	}
+	if err := c.applySearchPath(ctx); err != nil {
+		return nil, err
+	}
+	tx, err := c.beginTx(ctx, opts)
+	c.observe(err)
+	if err != nil {
+		return nil, err
+	}
+	c.inTx = true
+	return &wrappedTx{Tx: tx, c: c}, nil
+}
+
+func (c *wrappedConn) beginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != driver.IsolationLevel(0) || opts.ReadOnly {
+		return nil, errors.New("database: driver does not support non-default transaction options")
+	}
+	return c.Conn.Begin()
+}
+
+// wrappedTx tracks the end of a transaction on a wrappedConn.
+type wrappedTx struct {
+	driver.Tx
+	c *wrappedConn
+}
+
+func (t *wrappedTx) Commit() error {
+	t.end()
+	return t.Tx.Commit()
+}
+
+func (t *wrappedTx) Rollback() error {
+	t.end()
+	return t.Tx.Rollback()
+}
+
+func (t *wrappedTx) end() {
+	t.c.inTx = false
+	t.c.rlsSet = false
+	if t.c.db.pgBouncer {
+		// SET LOCAL ends with the transaction.
+		t.c.timeoutSet = false
+	}
+}
+
+func (c *wrappedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *wrappedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if ch, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return ch.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c *wrappedConn) ResetSession(ctx context.Context) error {
+	if c.retired() {
+		return driver.ErrBadConn
+	}
+	c.primaryChecked = false
+	if err := c.restoreSession(ctx); err != nil {
+		return driver.ErrBadConn
+	}
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// Close restores the session first if the driver hands it on to a
+// pgxpool. Other connections end with their session, which is often why
+// they are closed, so nothing is sent on them.
+func (c *wrappedConn) Close() error {
+	if c.pooled {
+		c.releasePooled()
+	}
+	return c.Conn.Close()
+}
+
+// restoreSession undoes the per-call statement_timeout and tenant
+// search_path an earlier operation left on the session.
+func (c *wrappedConn) restoreSession(ctx context.Context) error {
+	if c.timeoutSet {
+		if err := c.resetCallTimeout(ctx); err != nil {
+			return err
+		}
+	}
+	if c.searchPath != "" {
+		return c.applySearchPath(ctx)
+	}
+	return nil
+}
+
+// IsValid is called as the connection goes back to the pool.
+func (c *wrappedConn) IsValid() bool {
+	if c.poisoned || c.retired() || !c.release() {
+		return false
+	}
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
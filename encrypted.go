@@ -0,0 +1,280 @@
+package database
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// KeyProvider supplies the AES keys (16, 24 or 32 bytes) EncryptedString
+// and EncryptedBytes use, e.g. from a KMS. Every key keeps its ID so values
+// written before a rotation can still be decrypted.
+type KeyProvider interface {
+	// CurrentKey returns the key new values are encrypted with.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key with the given ID.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider holding its keys in memory.
+type StaticKeys struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+func (k StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := k.Key(k.Current)
+	return k.Current, key, err
+}
+
+func (k StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("database: unknown encryption key %q", id)
+	}
+	return key, nil
+}
+
+var (
+	keysMu sync.RWMutex
+	keys   KeyProvider
+)
+
+// SetKeyProvider sets the KeyProvider of EncryptedString and
+// EncryptedBytes. It must be called before they are read or written.
+func SetKeyProvider(p KeyProvider) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	keys = p
+}
+
+func keyProvider() (KeyProvider, error) {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	if keys == nil {
+		return nil, errors.New("database: no KeyProvider set, see SetKeyProvider")
+	}
+	return keys, nil
+}
+
+// EncryptedString is a string stored AES-GCM encrypted, in a text or bytea
+// column, as "v1:<key ID>:<base64 nonce and ciphertext>". NULL scans as
+// "".
+type EncryptedString string
+
+func (s EncryptedString) Value() (driver.Value, error) {
+	return encrypt([]byte(s))
+}
+
+func (s *EncryptedString) Scan(src interface{}) error {
+	if src == nil {
+		*s = ""
+		return nil
+	}
+	b, err := decryptValue(src)
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(b)
+	return nil
+}
+
+// EncryptedBytes is EncryptedString for binary values. A nil value is stored
+// as NULL.
+type EncryptedBytes []byte
+
+func (b EncryptedBytes) Value() (driver.Value, error) {
+	if b == nil {
+		return nil, nil
+	}
+	return encrypt(b)
+}
+
+func (b *EncryptedBytes) Scan(src interface{}) error {
+	if src == nil {
+		*b = nil
+		return nil
+	}
+	v, err := decryptValue(src)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+func encrypt(plain []byte) (string, error) {
+	p, err := keyProvider()
+	if err != nil {
+		return "", err
+	}
+	id, key, err := p.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	return seal(id, key, plain)
+}
+
+func seal(id string, key, plain []byte) (string, error) {
+	if strings.ContainsAny(id, ":\\") {
+		return "", fmt.Errorf("database: encryption key ID %q contains ':' or '\\'", id)
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plain, []byte(id))
+	return "v1:" + id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func decryptValue(src interface{}) ([]byte, error) {
+	var s string
+	switch v := src.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return nil, fmt.Errorf("database: cannot decrypt %T", src)
+	}
+	_, plain, err := decrypt(s)
+	return plain, err
+}
+
+// decrypt returns the key ID and plaintext of an encrypted value.
+func decrypt(s string) (string, []byte, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 || parts[0] != "v1" {
+		return "", nil, errors.New("database: value is not encrypted")
+	}
+	id := parts[1]
+	sealed, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, fmt.Errorf("database: encrypted value: %w", err)
+	}
+	p, err := keyProvider()
+	if err != nil {
+		return "", nil, err
+	}
+	key, err := p.Key(id)
+	if err != nil {
+		return "", nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", nil, errors.New("database: encrypted value is truncated")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return "", nil, fmt.Errorf("database: decrypting with key %q: %w", id, err)
+	}
+	return id, plain, nil
+}
+
+// Reencrypt re-encrypts with the current key the values of an encrypted
+// column that were written with older keys, batchSize rows per transaction,
+// walking the table in keyColumn order. It returns the number of rows
+// rewritten; once it completes the old keys are no longer needed.
+func Reencrypt(ctx context.Context, db *DB, table, keyColumn, column string, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	p, err := keyProvider()
+	if err != nil {
+		return 0, err
+	}
+	id, key, err := p.CurrentKey()
+	if err != nil {
+		return 0, err
+	}
+	d := db.Dialect()
+	t, k, c := d.QuoteIdent(table), d.QuoteIdent(keyColumn), d.QuoteIdent(column)
+	var total int64
+	var last interface{}
+	for {
+		n := 0
+		err := db.Transaction(ctx, sql.LevelDefault, func(tx *DB) error {
+			query := fmt.Sprintf(`SELECT %s, %s FROM %s WHERE %s IS NOT NULL ORDER BY %s LIMIT %d FOR UPDATE`, k, c, t, c, k, batchSize)
+			args := []interface{}{}
+			if last != nil {
+				query = fmt.Sprintf(`SELECT %s, %s FROM %s WHERE %s IS NOT NULL AND %s > %s ORDER BY %s LIMIT %d FOR UPDATE`, k, c, t, c, k, d.Placeholder(1), k, batchSize)
+				args = append(args, last)
+			}
+			rows, err := tx.Query(ctx, query, args...)
+			if err != nil {
+				return err
+			}
+			type stale struct {
+				key   interface{}
+				plain []byte
+			}
+			var rewrite []stale
+			for rows.Next() {
+				var rowKey interface{}
+				var value []byte
+				if err := rows.Scan(&rowKey, &value); err != nil {
+					rows.Close()
+					return err
+				}
+				if b, ok := rowKey.([]byte); ok {
+					rowKey = string(b)
+				}
+				n++
+				last = rowKey
+				valueID, plain, err := decrypt(string(value))
+				if err != nil {
+					rows.Close()
+					return fmt.Errorf("%s %v: %w", keyColumn, rowKey, err)
+				}
+				if valueID != id {
+					rewrite = append(rewrite, stale{rowKey, plain})
+				}
+			}
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			rows.Close()
+			for _, r := range rewrite {
+				v, err := seal(id, key, r.plain)
+				if err != nil {
+					return err
+				}
+				if _, err := tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET %s = %s WHERE %s = %s`, t, c, d.Placeholder(1), k, d.Placeholder(2)), v, r.key); err != nil {
+					return err
+				}
+				total++
+			}
+			return nil
+		})
+		if err != nil {
+			return total, fmt.Errorf("Reencrypt(%s.%s): %w", table, column, err)
+		}
+		if n < batchSize {
+			return total, nil
+		}
+	}
+}
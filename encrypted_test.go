@@ -0,0 +1,109 @@
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pkrypt0987/database"
+	"github.com/pkrypt0987/database/fakedb"
+)
+
+func setKeys(t *testing.T, current string) {
+	t.Helper()
+	database.SetKeyProvider(database.StaticKeys{Current: current, Keys: map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 16),
+		"k2": bytes.Repeat([]byte{2}, 32),
+	}})
+	t.Cleanup(func() { database.SetKeyProvider(nil) })
+}
+
+func TestEncryptedStringRotation(t *testing.T) {
+	setKeys(t, "k1")
+	old, err := database.EncryptedString("s3cret").Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := old.(string); !strings.HasPrefix(s, "v1:k1:") || strings.Contains(s, "s3cret") {
+		t.Fatalf("stored value %q", s)
+	}
+
+	// Values written before a rotation still read back.
+	setKeys(t, "k2")
+	var s database.EncryptedString
+	if err := s.Scan([]byte(old.(string))); err != nil || s != "s3cret" {
+		t.Fatalf("Scan = %q, %v", s, err)
+	}
+	v, _ := database.EncryptedString("s3cret").Value()
+	if !strings.HasPrefix(v.(string), "v1:k2:") {
+		t.Errorf("new value %q not written with the current key", v)
+	}
+
+	// The key ID is authenticated: relabelling a value breaks it.
+	forged := strings.Replace(old.(string), "v1:k1:", "v1:k2:", 1)
+	if err := s.Scan(forged); err == nil {
+		t.Error("value with a swapped key ID decrypted")
+	}
+	if err := s.Scan("plain"); err == nil {
+		t.Error("unencrypted value scanned")
+	}
+	if err := s.Scan(nil); err != nil || s != "" {
+		t.Errorf("Scan(nil) = %q, %v", s, err)
+	}
+}
+
+func TestEncryptedBytesNil(t *testing.T) {
+	setKeys(t, "k1")
+	if v, err := database.EncryptedBytes(nil).Value(); v != nil || err != nil {
+		t.Errorf("Value of nil = %v, %v; want NULL", v, err)
+	}
+	v, err := database.EncryptedBytes{0, 1, 2}.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b database.EncryptedBytes
+	if err := b.Scan(v); err != nil || !bytes.Equal(b, []byte{0, 1, 2}) {
+		t.Errorf("Scan = %v, %v", b, err)
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	setKeys(t, "k1")
+	old, _ := database.EncryptedString("a").Value()
+	setKeys(t, "k2")
+	current, _ := database.EncryptedString("b").Value()
+
+	f := fakedb.New()
+	f.On(`^SELECT`).Return([]string{"id", "ssn"}, []interface{}{int64(1), []byte(old.(string))}, []interface{}{int64(2), []byte(current.(string))}).Once()
+	f.On(`^SELECT`).Return([]string{"id", "ssn"})
+	f.On(`^UPDATE`).ReturnRowsAffected(1)
+	db := f.DB(t)
+	n, err := database.Reencrypt(context.Background(), db, "people", "id", "ssn", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("rewrote %d rows, want only the one with the old key", n)
+	}
+	var updates, selects []fakedb.Call
+	for _, c := range f.Calls() {
+		switch {
+		case strings.HasPrefix(c.Query, "UPDATE"):
+			updates = append(updates, c)
+		case strings.HasPrefix(c.Query, "SELECT"):
+			selects = append(selects, c)
+		}
+	}
+	if len(updates) != 1 || updates[0].Query != `UPDATE "people" SET "ssn" = $1 WHERE "id" = $2` || updates[0].Args[1] != int64(1) {
+		t.Fatalf("updates = %v", updates)
+	}
+	var s database.EncryptedString
+	if err := s.Scan(updates[0].Args[0]); err != nil || s != "a" || !strings.HasPrefix(updates[0].Args[0].(string), "v1:k2:") {
+		t.Errorf("rewritten value %v decrypts to %q, %v", updates[0].Args[0], s, err)
+	}
+	// A full batch makes it read the next one, after the last key seen.
+	if len(selects) != 2 || len(selects[1].Args) != 1 || selects[1].Args[0] != int64(2) {
+		t.Errorf("selects = %v", selects)
+	}
+}
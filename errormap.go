@@ -0,0 +1,50 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// errorMap is shared by a DB and its transaction DBs.
+type errorMap struct {
+	mu sync.RWMutex
+	m  map[string]error
+}
+
+// MapError makes Exec, Query, Get, Select and Transaction return errors
+// matching domainErr for server errors of the constraint or SQLSTATE code
+// key, e.g.
+//
+//	db.MapError("users_email_key", ErrEmailTaken)
+//	db.MapError("23503", ErrNotFound)
+//
+// so handlers check errors.Is(err, ErrEmailTaken) instead of inspecting
+// database errors. A constraint mapping wins over a code one. The returned
+// errors still unwrap to the driver's error.
+func (db *DB) MapError(key string, domainErr error) {
+	db.errMap.mu.Lock()
+	defer db.errMap.mu.Unlock()
+	if db.errMap.m == nil {
+		db.errMap.m = map[string]error{}
+	}
+	db.errMap.m[key] = domainErr
+}
+
+// mapError wraps err in the domain error MapError registered for it.
+func (db *DB) mapError(err error) error {
+	v, ok := serverError(err)
+	if !ok {
+		return err
+	}
+	db.errMap.mu.RLock()
+	domainErr, ok := db.errMap.m[v.Constraint]
+	if !ok || v.Constraint == "" {
+		domainErr, ok = db.errMap.m[v.Code]
+	}
+	db.errMap.mu.RUnlock()
+	if !ok || errors.Is(err, domainErr) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", domainErr, err)
+}
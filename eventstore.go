@@ -0,0 +1,182 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrVersionConflict is returned by AppendEvents when the stream is not at
+// the expected version, because another writer appended first.
+var ErrVersionConflict = errors.New("database: event stream version conflict")
+
+// Event is one event of a stream. Version is the event's position in the
+// stream, starting at 1, and RecordedAt is set by the store.
+type Event struct {
+	StreamID   string
+	Version    int64
+	Type       string
+	Data       json.RawMessage
+	Metadata   map[string]string
+	RecordedAt time.Time
+}
+
+// Snapshot is the state of a stream's aggregate after Version.
+type Snapshot struct {
+	Version int64
+	Data    json.RawMessage
+}
+
+// EventStore stores event streams in a table, and snapshots of them in its
+// "_snapshots" table. It joins a transaction in the context (see
+// NewContext), so events can be appended together with other writes.
+type EventStore struct {
+	db        *DB
+	table     string
+	snapshots string
+}
+
+// NewEventStore returns an EventStore on table, "events" if empty.
+func NewEventStore(db *DB, table string) *EventStore {
+	if table == "" {
+		table = "events"
+	}
+	return &EventStore{db: db, table: quoteIdent(table), snapshots: quoteIdent(table + "_snapshots")}
+}
+
+// Install creates the event and snapshot tables if they do not exist.
+func (s *EventStore) Install(ctx context.Context) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS ` + s.table + ` (
+			stream_id text NOT NULL,
+			version bigint NOT NULL,
+			type text NOT NULL,
+			data jsonb NOT NULL,
+			metadata jsonb NOT NULL DEFAULT '{}',
+			recorded_at timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY (stream_id, version)
+		)`,
+		`CREATE TABLE IF NOT EXISTS ` + s.snapshots + ` (
+			stream_id text PRIMARY KEY,
+			version bigint NOT NULL,
+			data jsonb NOT NULL
+		)`,
+	}
+	return s.db.RunInTx(ctx, func(ctx context.Context) error {
+		for _, stmt := range stmts {
+			if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("EventStore.Install(): %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// AppendEvents appends events to stream, which must be at expectedVersion
+// (0 for a new stream), and returns the stream's new version. It returns
+// ErrVersionConflict if the stream has moved on, in which case nothing is
+// appended and the caller should reload and retry.
+func (s *EventStore) AppendEvents(ctx context.Context, stream string, expectedVersion int64, events ...Event) (int64, error) {
+	version := expectedVersion
+	err := s.db.RunInTx(ctx, func(ctx context.Context) error {
+		var current int64
+		if err := s.db.QueryRowContext(ctx, `SELECT coalesce(max(version), 0) FROM `+s.table+` WHERE stream_id = $1`, stream).Scan(&current); err != nil {
+			return err
+		}
+		if current != expectedVersion {
+			return ErrVersionConflict
+		}
+		for _, e := range events {
+			version++
+			meta, err := json.Marshal(e.Metadata)
+			if err != nil {
+				return err
+			}
+			if e.Metadata == nil {
+				meta = []byte("{}")
+			}
+			_, err = s.db.ExecContext(ctx, `INSERT INTO `+s.table+` (stream_id, version, type, data, metadata) VALUES ($1, $2, $3, $4, $5)`,
+				stream, version, e.Type, []byte(e.Data), meta)
+			if SQLState(err) == "23505" {
+				// A concurrent writer inserted the same version first.
+				return ErrVersionConflict
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, ErrVersionConflict) {
+		return 0, ErrVersionConflict
+	}
+	if err != nil {
+		return 0, fmt.Errorf("EventStore.AppendEvents(%s): %w", stream, err)
+	}
+	return version, nil
+}
+
+// LoadStream returns the latest snapshot of stream, nil if there is none,
+// and the events after it in order.
+func (s *EventStore) LoadStream(ctx context.Context, stream string) (*Snapshot, []Event, error) {
+	var snap *Snapshot
+	var sn Snapshot
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `SELECT version, data FROM `+s.snapshots+` WHERE stream_id = $1`, stream).Scan(&sn.Version, &data)
+	switch {
+	case err == nil:
+		sn.Data = json.RawMessage(data)
+		snap = &sn
+	case err != sql.ErrNoRows:
+		return nil, nil, fmt.Errorf("EventStore.LoadStream(%s): %w", stream, err)
+	}
+	events, err := s.LoadEvents(ctx, stream, sn.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snap, events, nil
+}
+
+// LoadEvents returns the events of stream after version afterVersion, in
+// order.
+func (s *EventStore) LoadEvents(ctx context.Context, stream string, afterVersion int64) ([]Event, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT version, type, data, metadata, recorded_at FROM `+s.table+
+		` WHERE stream_id = $1 AND version > $2 ORDER BY version`, stream, afterVersion)
+	if err != nil {
+		return nil, fmt.Errorf("EventStore.LoadEvents(%s): %w", stream, err)
+	}
+	defer rows.Close()
+	var events []Event
+	for rows.Next() {
+		e := Event{StreamID: stream}
+		var data, meta []byte
+		if err := rows.Scan(&e.Version, &e.Type, &data, &meta, &e.RecordedAt); err != nil {
+			return nil, fmt.Errorf("EventStore.LoadEvents(%s): %w", stream, err)
+		}
+		e.Data = json.RawMessage(data)
+		if err := json.Unmarshal(meta, &e.Metadata); err != nil {
+			return nil, fmt.Errorf("EventStore.LoadEvents(%s): metadata of version %d: %w", stream, e.Version, err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("EventStore.LoadEvents(%s): %w", stream, err)
+	}
+	return events, nil
+}
+
+// SaveSnapshot stores the state of stream's aggregate after snap.Version,
+// replacing an older snapshot, so LoadStream need not replay the events up
+// to it.
+func (s *EventStore) SaveSnapshot(ctx context.Context, stream string, snap Snapshot) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO `+s.snapshots+` AS s (stream_id, version, data) VALUES ($1, $2, $3)
+		ON CONFLICT (stream_id) DO UPDATE SET version = excluded.version, data = excluded.data
+		WHERE s.version < excluded.version`, stream, snap.Version, []byte(snap.Data))
+	if err != nil {
+		return fmt.Errorf("EventStore.SaveSnapshot(%s): %w", stream, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package database_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkrypt0987/database"
+	"github.com/pkrypt0987/database/fakedb"
+)
+
+func TestAppendEvents(t *testing.T) {
+	f := fakedb.New()
+	f.On(`^SELECT coalesce`).Return([]string{"max"}, []interface{}{int64(2)})
+	f.On(`^INSERT`).ReturnRowsAffected(1)
+	s := database.NewEventStore(f.DB(t), "")
+	ctx := context.Background()
+
+	v, err := s.AppendEvents(ctx, "order-1", 2,
+		database.Event{Type: "Shipped", Data: json.RawMessage(`{}`)},
+		database.Event{Type: "Delivered", Data: json.RawMessage(`{}`), Metadata: map[string]string{"by": "courier"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 4 {
+		t.Errorf("version = %d, want 4", v)
+	}
+	var versions []interface{}
+	var metadata []string
+	for _, c := range f.Calls() {
+		if len(c.Args) == 5 {
+			versions = append(versions, c.Args[1])
+			metadata = append(metadata, string(c.Args[4].([]byte)))
+		}
+	}
+	if !reflect.DeepEqual(versions, []interface{}{int64(3), int64(4)}) {
+		t.Errorf("inserted versions %v, want 3 and 4", versions)
+	}
+	if !reflect.DeepEqual(metadata, []string{`{}`, `{"by":"courier"}`}) {
+		t.Errorf("inserted metadata %q", metadata)
+	}
+
+	// The stream moved on since version 1 was read.
+	if _, err := s.AppendEvents(ctx, "order-1", 1, database.Event{Type: "Cancelled", Data: json.RawMessage(`{}`)}); err != database.ErrVersionConflict {
+		t.Errorf("stale append: err = %v, want ErrVersionConflict", err)
+	}
+}
+
+func TestAppendEventsConcurrentWriter(t *testing.T) {
+	f := fakedb.New()
+	f.On(`^SELECT coalesce`).Return([]string{"max"}, []interface{}{int64(0)})
+	f.On(`^INSERT`).ReturnError(&pq.Error{Code: "23505", Constraint: "events_pkey"})
+	s := database.NewEventStore(f.DB(t), "")
+	_, err := s.AppendEvents(context.Background(), "order-1", 0, database.Event{Type: "Placed", Data: json.RawMessage(`{}`)})
+	if err != database.ErrVersionConflict {
+		t.Errorf("err = %v, want ErrVersionConflict", err)
+	}
+	if calls := f.Calls(); calls[len(calls)-1].Query != "ROLLBACK" {
+		t.Errorf("last query %q, want the append rolled back", calls[len(calls)-1].Query)
+	}
+}
+
+func TestLoadStream(t *testing.T) {
+	f := fakedb.New()
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	f.On(`_snapshots`).Return([]string{"version", "data"}, []interface{}{int64(10), []byte(`{"total":3}`)})
+	f.On(`^SELECT version, type`).Return([]string{"version", "type", "data", "metadata", "recorded_at"},
+		[]interface{}{int64(11), "Shipped", []byte(`{}`), []byte(`{"by":"ops"}`), at})
+	s := database.NewEventStore(f.DB(t), "orders")
+	snap, events, err := s.LoadStream(context.Background(), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap == nil || snap.Version != 10 || string(snap.Data) != `{"total":3}` {
+		t.Errorf("snapshot = %+v", snap)
+	}
+	want := []database.Event{{StreamID: "order-1", Version: 11, Type: "Shipped", Data: json.RawMessage(`{}`), Metadata: map[string]string{"by": "ops"}, RecordedAt: at}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+	if args := f.Calls()[1].Args; !reflect.DeepEqual(args, []interface{}{"order-1", int64(10)}) {
+		t.Errorf("events loaded with %v, want those after the snapshot", args)
+	}
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Stmt is one statement of ExecMany.
+type Stmt struct {
+	Query string
+	Args  []interface{}
+}
+
+// StmtResult is the outcome of one statement of ExecMany.
+type StmtResult struct {
+	RowsAffected int64
+	Err          error
+	// Ran is false for statements left out after an earlier one failed.
+	Ran bool
+}
+
+// ExecManyMode says what ExecMany does when a statement fails.
+type ExecManyMode int
+
+const (
+	// StopOnError stops at the first failing statement and rolls back all
+	// of them; in the caller's transaction the failure aborts it.
+	StopOnError ExecManyMode = iota
+	// CollectErrors runs every statement, each in its own savepoint, so a
+	// failing one is rolled back on its own and the others are committed.
+	CollectErrors
+)
+
+// ExecMany runs stmts in one transaction, or in the caller's if db is one,
+// and returns the result of each, e.g. for bulk maintenance endpoints
+// reporting per statement. With StopOnError err is the first statement's
+// error; with CollectErrors err is set only if the transaction itself
+// failed, and the failures are in the results.
+func (db *DB) ExecMany(ctx context.Context, stmts []Stmt, mode ExecManyMode) (results []StmtResult, err error) {
+	run := func(tx *DB) error {
+		results = make([]StmtResult, len(stmts))
+		for i, s := range stmts {
+			r := &results[i]
+			r.Ran = true
+			if mode == StopOnError {
+				r.RowsAffected, r.Err = tx.Exec(ctx, s.Query, s.Args...)
+				if r.Err != nil {
+					return fmt.Errorf("statement %d: %w", i, r.Err)
+				}
+				continue
+			}
+			var stmtErr error
+			err := tx.Savepoint(ctx, func(sp *DB) error {
+				r.RowsAffected, stmtErr = sp.Exec(ctx, s.Query, s.Args...)
+				return stmtErr
+			})
+			if stmtErr != nil {
+				r.RowsAffected, r.Err = 0, stmtErr
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("statement %d: %w", i, err)
+			}
+		}
+		return nil
+	}
+	if db.tx != nil {
+		err = run(db)
+	} else {
+		err = db.Transaction(ctx, sql.LevelDefault, run)
+	}
+	if err != nil {
+		return results, fmt.Errorf("ExecMany(): %w", err)
+	}
+	return results, nil
+}
@@ -0,0 +1,245 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVOptions configures ExportCSV. The zero value writes a header row and
+// comma-separated values, with NULL as an empty field.
+type CSVOptions struct {
+	// NoHeader leaves out the header row of column names.
+	NoHeader bool
+	// Header replaces the column names in the header row.
+	Header []string
+	// Comma is the field delimiter. Defaults to ','.
+	Comma rune
+	// Null is written for NULL values.
+	Null string
+	// UseCRLF ends lines with \r\n, as RFC 4180 has it, rather than \n.
+	UseCRLF bool
+	// TimeFormat formats timestamps. Defaults to time.RFC3339Nano.
+	TimeFormat string
+}
+
+// ExportCSV runs query and writes its rows to w as CSV while they are
+// read, so results of any size can be exported, e.g. for a download
+// endpoint. It returns the number of rows written. bytea values are
+// written in PostgreSQL's hex format.
+func (db *DB) ExportCSV(ctx context.Context, w io.Writer, query string, args []interface{}, opts CSVOptions) (int64, error) {
+	if opts.TimeFormat == "" {
+		opts.TimeFormat = time.RFC3339Nano
+	}
+	cw := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		cw.Comma = opts.Comma
+	}
+	cw.UseCRLF = opts.UseCRLF
+	var record []string
+	n, err := db.exportRows(ctx, query, args, func(cols []*sql.ColumnType) error {
+		record = make([]string, len(cols))
+		if opts.NoHeader {
+			return nil
+		}
+		header := opts.Header
+		if header == nil {
+			header = make([]string, len(cols))
+			for i, c := range cols {
+				header[i] = c.Name()
+			}
+		}
+		return cw.Write(header)
+	}, func(cols []*sql.ColumnType, vals []interface{}) error {
+		for i, v := range vals {
+			record[i] = csvField(v, cols[i].DatabaseTypeName(), opts)
+		}
+		return cw.Write(record)
+	})
+	if err == nil {
+		cw.Flush()
+		err = cw.Error()
+	}
+	if err != nil {
+		return n, fmt.Errorf("ExportCSV(): %w", err)
+	}
+	return n, nil
+}
+
+func csvField(v interface{}, typ string, opts CSVOptions) string {
+	switch v := v.(type) {
+	case nil:
+		return opts.Null
+	case []byte:
+		if typ == "BYTEA" {
+			return `\x` + hex.EncodeToString(v)
+		}
+		return string(v)
+	case string:
+		return v
+	case time.Time:
+		return v.Format(opts.TimeFormat)
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// JSONFormat is the output format of ExportJSON.
+type JSONFormat int
+
+const (
+	// JSONArray writes one JSON array of row objects.
+	JSONArray JSONFormat = iota
+	// NDJSON writes one row object per line.
+	NDJSON
+)
+
+// ExportJSON runs query and writes its rows to w as JSON objects keyed by
+// column name, in column order, while they are read. It returns the number
+// of rows written. Numerics are written as JSON numbers with all their
+// digits, json and jsonb values as they are, timestamps in RFC 3339 and
+// bytea values in base64; NaN and infinite numbers become strings.
+func (db *DB) ExportJSON(ctx context.Context, w io.Writer, query string, args []interface{}, format JSONFormat) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var keys [][]byte
+	first := true
+	n, err := db.exportRows(ctx, query, args, func(cols []*sql.ColumnType) error {
+		keys = make([][]byte, len(cols))
+		for i, c := range cols {
+			k, err := json.Marshal(c.Name())
+			if err != nil {
+				return err
+			}
+			keys[i] = k
+		}
+		if format == JSONArray {
+			return bw.WriteByte('[')
+		}
+		return nil
+	}, func(cols []*sql.ColumnType, vals []interface{}) error {
+		if format == JSONArray && !first {
+			bw.WriteByte(',')
+		}
+		first = false
+		bw.WriteByte('{')
+		for i, v := range vals {
+			if i > 0 {
+				bw.WriteByte(',')
+			}
+			b, err := jsonValue(v, cols[i].DatabaseTypeName())
+			if err != nil {
+				return fmt.Errorf("column %s: %w", cols[i].Name(), err)
+			}
+			bw.Write(keys[i])
+			bw.WriteByte(':')
+			bw.Write(b)
+		}
+		bw.WriteByte('}')
+		if format == NDJSON {
+			bw.WriteByte('\n')
+		}
+		return nil
+	})
+	if err == nil && format == JSONArray {
+		err = bw.WriteByte(']')
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		return n, fmt.Errorf("ExportJSON(): %w", err)
+	}
+	return n, nil
+}
+
+func jsonValue(v interface{}, typ string) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		switch typ {
+		case "BYTEA":
+			return json.Marshal(v)
+		case "JSON", "JSONB":
+			return v, nil
+		case "NUMERIC":
+			return jsonNumber(string(v))
+		}
+		return json.Marshal(string(v))
+	case string:
+		switch typ {
+		case "JSON", "JSONB":
+			return []byte(v), nil
+		case "NUMERIC":
+			return jsonNumber(v)
+		}
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return json.Marshal(strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return json.Marshal(strconv.FormatFloat(float64(v), 'g', -1, 32))
+		}
+	}
+	return json.Marshal(v)
+}
+
+// jsonNumber returns a numeric's text as a JSON number, or as a string if
+// it is NaN or infinite.
+func jsonNumber(s string) ([]byte, error) {
+	if s == "NaN" || strings.HasSuffix(s, "Infinity") {
+		return json.Marshal(s)
+	}
+	return []byte(s), nil
+}
+
+// exportRows runs query, calls start with its columns, then row for every
+// row with its values as the driver returns them, and returns the number
+// of rows.
+func (db *DB) exportRows(ctx context.Context, query string, args []interface{}, start func([]*sql.ColumnType) error, row func([]*sql.ColumnType, []interface{}) error) (int64, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	if err := start(cols); err != nil {
+		return 0, err
+	}
+	vals := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		if err := row(cols, vals); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	return n, rows.Close()
+}
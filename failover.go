@@ -0,0 +1,63 @@
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// WithFailoverReset makes a failover-class error on a pooled connection
+// retire the whole pool, so the remaining connections to the old primary are
+// discarded at their next checkout instead of each failing a caller in turn.
+// New connections go to the new primary, which with a multi-host DSN is the
+// first host matching target_session_attrs.
+func WithFailoverReset() Option {
+	return func(db *DB) {
+		db.failoverReset = true
+	}
+}
+
+// isFailover reports whether err suggests the server behind the connection
+// is no longer a usable primary: it became read-only, is shutting down or
+// restarting, or the connection was reset.
+func isFailover(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrNotPrimary) {
+		return true
+	}
+	switch code := SQLState(err); {
+	case code == "25006", // read_only_sql_transaction
+		code == "57P01", // admin_shutdown
+		code == "57P02", // crash_shutdown
+		code == "57P03", // cannot_connect_now
+		len(code) == 5 && code[:2] == "08":
+		return true
+	case code != "":
+		return false
+	}
+	return isConnError(err)
+}
+
+// isConnError reports whether err is a failure of the connection rather
+// than of a statement: it broke, was reset or could not be made.
+func isConnError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var nerr *net.OpError
+	return errors.As(err, &nerr)
+}
+
+// observe retires the pool after a failover-class error. Only the first
+// error from a generation retires it, so the burst of errors that follows a
+// failover does not also discard the new connections.
+func (c *wrappedConn) observe(err error) {
+	if c.db.failoverReset && isFailover(err) {
+		c.db.gen.CompareAndSwap(c.gen, c.gen+1)
+	}
+}
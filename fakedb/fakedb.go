@@ -0,0 +1,245 @@
+// Package fakedb provides an in-memory database for unit tests. It is a
+// database/sql driver whose results are programmed per query pattern, so
+// the *database.DB it returns satisfies database.Querier exactly like a real
+// one, including Get, Select and Transaction.
+//
+//	f := fakedb.New()
+//	f.On(`SELECT .* FROM users`).Return([]string{"id", "name"}, []interface{}{1, "alice"})
+//	f.On(`INSERT INTO users`).ReturnRowsAffected(1)
+//	repo := NewRepo(f.DB(t))
+package fakedb
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/pkrypt0987/database"
+)
+
+// Call is a statement received by the fake. Transactions are recorded as
+// calls with the queries "BEGIN", "COMMIT" and "ROLLBACK". Commits succeed
+// unless a rule matching "COMMIT" returns an error.
+type Call struct {
+	Query string
+	Args  []interface{}
+}
+
+// Rule is a programmed response for queries matching a pattern.
+type Rule struct {
+	re           *regexp.Regexp
+	once         bool
+	columns      []string
+	rows         [][]interface{}
+	rowsAffected int64
+	err          error
+}
+
+// Return makes matching queries return the given rows.
+func (r *Rule) Return(columns []string, rows ...[]interface{}) *Rule {
+	r.columns = columns
+	r.rows = rows
+	return r
+}
+
+// ReturnRowsAffected makes matching statements report n affected rows.
+func (r *Rule) ReturnRowsAffected(n int64) *Rule {
+	r.rowsAffected = n
+	return r
+}
+
+// ReturnError makes matching queries fail with err.
+func (r *Rule) ReturnError(err error) *Rule {
+	r.err = err
+	return r
+}
+
+// Once makes the rule match a single query only.
+func (r *Rule) Once() *Rule {
+	r.once = true
+	return r
+}
+
+// Fake is an in-memory database. It is safe for concurrent use.
+type Fake struct {
+	mu    sync.Mutex
+	rules []*Rule
+	calls []Call
+}
+
+func New() *Fake {
+	return &Fake{}
+}
+
+// On registers a rule for queries matching the regular expression pattern.
+// Rules are tried in registration order; queries that match no rule fail.
+func (f *Fake) On(pattern string) *Rule {
+	r := &Rule{re: regexp.MustCompile(pattern)}
+	f.mu.Lock()
+	f.rules = append(f.rules, r)
+	f.mu.Unlock()
+	return r
+}
+
+// DB returns a DB backed by the fake, closed when the test ends.
+func (f *Fake) DB(t testing.TB, opts ...database.Option) *database.DB {
+	t.Helper()
+	db, err := database.OpenDB(connector{f}, opts...)
+	if err != nil {
+		t.Fatalf("fakedb: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// Driver returns the fake as a database/sql driver, for code that opens
+// databases by driver name; see sql.Register. The DSN is ignored.
+func (f *Fake) Driver() driver.Driver {
+	return drv{f}
+}
+
+// Calls returns the statements received so far.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Reset forgets all rules and recorded calls.
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = nil
+	f.calls = nil
+}
+
+func (f *Fake) record(query string, args []driver.NamedValue) {
+	vs := make([]interface{}, len(args))
+	for i, a := range args {
+		vs[i] = a.Value
+	}
+	f.mu.Lock()
+	f.calls = append(f.calls, Call{Query: query, Args: vs})
+	f.mu.Unlock()
+}
+
+func (f *Fake) match(query string, args []driver.NamedValue) (*Rule, error) {
+	f.record(query, args)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, r := range f.rules {
+		if !r.re.MatchString(query) {
+			continue
+		}
+		if r.once {
+			f.rules = append(f.rules[:i:i], f.rules[i+1:]...)
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("%w %q", errNoRule, query)
+}
+
+var errNoRule = errors.New("fakedb: no rule matches query")
+
+type connector struct{ f *Fake }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return &conn{f: c.f}, nil }
+func (c connector) Driver() driver.Driver                        { return drv{c.f} }
+
+type drv struct{ f *Fake }
+
+func (d drv) Open(string) (driver.Conn, error) { return &conn{f: d.f}, nil }
+
+type conn struct{ f *Fake }
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("fakedb: prepared statements are not supported")
+}
+
+func (c *conn) Close() error { return nil }
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.f.record("BEGIN", nil)
+	return tx{c.f}, nil
+}
+
+func (c *conn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r, err := c.f.match(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return result(r.rowsAffected), nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r, err := c.f.match(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{columns: r.columns, rows: r.rows}, nil
+}
+
+type tx struct{ f *Fake }
+
+func (t tx) Commit() error {
+	if _, err := t.f.match("COMMIT", nil); err != nil && !errors.Is(err, errNoRule) {
+		return err
+	}
+	return nil
+}
+
+func (t tx) Rollback() error {
+	t.f.record("ROLLBACK", nil)
+	return nil
+}
+
+type result int64
+
+func (r result) LastInsertId() (int64, error) {
+	return 0, fmt.Errorf("fakedb: LastInsertId is not supported")
+}
+
+func (r result) RowsAffected() (int64, error) { return int64(r), nil }
+
+type rows struct {
+	columns []string
+	rows    [][]interface{}
+	pos     int
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	row := r.rows[r.pos]
+	r.pos++
+	for i := range dest {
+		if i >= len(row) {
+			dest[i] = nil
+			continue
+		}
+		v, err := driver.DefaultParameterConverter.ConvertValue(row[i])
+		if err != nil {
+			return fmt.Errorf("fakedb: column %d: %w", i, err)
+		}
+		dest[i] = v
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"regexp"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type FaultKind int
+
+const (
+	// FaultSerialization fails the statement with SQLSTATE 40001, which
+	// Transaction retries for repeatable read and serializable isolation.
+	FaultSerialization FaultKind = iota
+	// FaultConnDrop fails the statement with a *net.OpError wrapping
+	// ECONNRESET, as if the connection had been dropped, and keeps the
+	// connection out of the pool. Unlike driver.ErrBadConn, which
+	// database/sql retries on another connection, the error reaches the
+	// caller.
+	FaultConnDrop
+	// FaultLatency delays the statement by Fault.Latency, or by a duration
+	// sampled from Fault.Distribution if set.
+	FaultLatency
+)
+
+// Fault describes a failure injected into statements matching Match (all
+// statements if Match is nil) with the given probability in [0, 1].
+type Fault struct {
+	Match        *regexp.Regexp
+	Kind         FaultKind
+	Probability  float64
+	Latency      time.Duration
+	Distribution LatencyDistribution
+}
+
+// LatencyDistribution samples a delay using the injector's seeded source.
+type LatencyDistribution func(r *rand.Rand) time.Duration
+
+// FixedLatency always delays by d.
+func FixedLatency(d time.Duration) LatencyDistribution {
+	return func(*rand.Rand) time.Duration { return d }
+}
+
+// UniformLatency delays by a duration uniformly distributed in [min, max).
+func UniformLatency(min, max time.Duration) LatencyDistribution {
+	return func(r *rand.Rand) time.Duration {
+		if max <= min {
+			return min
+		}
+		return min + time.Duration(r.Int63n(int64(max-min)))
+	}
+}
+
+// NormalLatency delays by a normally distributed duration, never negative.
+func NormalLatency(mean, stddev time.Duration) LatencyDistribution {
+	return func(r *rand.Rand) time.Duration {
+		d := time.Duration(r.NormFloat64()*float64(stddev)) + mean
+		if d < 0 {
+			return 0
+		}
+		return d
+	}
+}
+
+// WithLatency delays every statement matching match (all if nil) by a
+// duration sampled from dist. The same seed yields the same sequence of
+// delays for the same sequence of statements.
+func WithLatency(seed int64, match *regexp.Regexp, dist LatencyDistribution) Option {
+	return WithFaultInjector(NewFaultInjector(seed, Fault{
+		Match:        match,
+		Kind:         FaultLatency,
+		Probability:  1,
+		Distribution: dist,
+	}))
+}
+
+// FaultInjector injects faults into statements to exercise retry and error
+// handling paths. It is meant for tests and staging, never production.
+type FaultInjector struct {
+	mu       sync.Mutex
+	rand     *rand.Rand
+	faults   []Fault
+	disabled bool
+}
+
+// NewFaultInjector returns an enabled injector. The seed makes the sequence
+// of injected faults reproducible.
+func NewFaultInjector(seed int64, faults ...Fault) *FaultInjector {
+	return &FaultInjector{rand: rand.New(rand.NewSource(seed)), faults: faults}
+}
+
+// SetEnabled turns fault injection on or off, e.g. to set up fixtures before
+// the chaos starts.
+func (fi *FaultInjector) SetEnabled(enabled bool) {
+	fi.mu.Lock()
+	fi.disabled = !enabled
+	fi.mu.Unlock()
+}
+
+// WithFaultInjector makes every statement pass through fi.
+func WithFaultInjector(fi *FaultInjector) Option {
+	return func(db *DB) {
+		db.stmtHooks = append(db.stmtHooks, fi.inject)
+	}
+}
+
+func (fi *FaultInjector) inject(ctx context.Context, query string) error {
+	var delay time.Duration
+	var err error
+	fi.mu.Lock()
+	if !fi.disabled {
+		for _, f := range fi.faults {
+			if f.Match != nil && !f.Match.MatchString(query) {
+				continue
+			}
+			if fi.rand.Float64() >= f.Probability {
+				continue
+			}
+			switch f.Kind {
+			case FaultLatency:
+				if f.Distribution != nil {
+					delay += f.Distribution(fi.rand)
+				} else {
+					delay += f.Latency
+				}
+			case FaultSerialization:
+				err = &pq.Error{Code: serializationFailureCode, Severity: "ERROR", Message: "could not serialize access (injected fault)"}
+			case FaultConnDrop:
+				err = &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+	fi.mu.Unlock()
+
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
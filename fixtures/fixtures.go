@@ -0,0 +1,223 @@
+// Package fixtures loads test rows from YAML or JSON files.
+//
+// A fixture file maps table names to lists of rows:
+//
+//	users:
+//	  - id: 1
+//	    email: alice@example.com
+//	    created_at: "{{ now }}"
+//	  - id: 2
+//	    email: bob@example.com
+//	    token: "{{ uuid }}"
+//
+// The string values "{{ now }}" and "{{ uuid }}" are replaced with the
+// current time and a random UUID. Nested maps and lists are stored as JSON.
+package fixtures
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkrypt0987/database"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadFixtures reads every file matching patterns in fsys, truncates the
+// tables they mention and inserts their rows in a single transaction.
+// Tables are filled so that referenced tables come before the tables whose
+// foreign keys point at them.
+func LoadFixtures(ctx context.Context, db *database.DB, fsys fs.FS, patterns ...string) error {
+	rows := make(map[string][]map[string]interface{})
+	for _, pattern := range patterns {
+		files, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return fmt.Errorf("LoadFixtures(): %w", err)
+		}
+		for _, file := range files {
+			if err := readFile(fsys, file, rows); err != nil {
+				return fmt.Errorf("LoadFixtures(): %s: %w", file, err)
+			}
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	schema, err := db.Schema(ctx)
+	if err != nil {
+		return fmt.Errorf("LoadFixtures(): %w", err)
+	}
+	tables := insertOrder(schema, rows)
+
+	err = db.Transaction(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		quoted := make([]string, len(tables))
+		for i, t := range tables {
+			quoted[i] = quoteQualified(t)
+		}
+		if _, err := tx.Exec(ctx, "TRUNCATE "+strings.Join(quoted, ", ")+" RESTART IDENTITY CASCADE"); err != nil {
+			return err
+		}
+		for i, t := range tables {
+			for _, row := range rows[t] {
+				if err := insert(ctx, tx, quoted[i], row); err != nil {
+					return fmt.Errorf("table %s: %w", t, err)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("LoadFixtures(): %w", err)
+	}
+	return nil
+}
+
+func readFile(fsys fs.FS, file string, rows map[string][]map[string]interface{}) error {
+	b, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return err
+	}
+	var data map[string][]map[string]interface{}
+	switch path.Ext(file) {
+	case ".json":
+		err = json.Unmarshal(b, &data)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &data)
+	default:
+		return fmt.Errorf("unsupported fixture format %q", path.Ext(file))
+	}
+	if err != nil {
+		return err
+	}
+	for table, rs := range data {
+		rows[table] = append(rows[table], rs...)
+	}
+	return nil
+}
+
+// insertOrder sorts the fixture tables so that foreign key targets come
+// first. Tables in a reference cycle keep alphabetical order.
+func insertOrder(schema *database.Schema, rows map[string][]map[string]interface{}) []string {
+	var names []string
+	for t := range rows {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+
+	byTable := make(map[*database.Table]string)
+	for _, n := range names {
+		if t := schema.Table(n); t != nil {
+			byTable[t] = n
+		}
+	}
+	deps := make(map[string][]string)
+	for _, n := range names {
+		t := schema.Table(n)
+		if t == nil {
+			continue
+		}
+		for _, fk := range t.ForeignKeys {
+			ref := schema.Table(fk.RefSchema + "." + fk.RefTable)
+			if dep, ok := byTable[ref]; ok && dep != n {
+				deps[n] = append(deps[n], dep)
+			}
+		}
+	}
+
+	var order []string
+	state := make(map[string]int) // 1 = visiting, 2 = done
+	var visit func(n string)
+	visit = func(n string) {
+		if state[n] != 0 {
+			return
+		}
+		state[n] = 1
+		for _, d := range deps[n] {
+			visit(d)
+		}
+		state[n] = 2
+		order = append(order, n)
+	}
+	for _, n := range names {
+		visit(n)
+	}
+	return order
+}
+
+func insert(ctx context.Context, tx *database.DB, table string, row map[string]interface{}) error {
+	cols := make([]string, 0, len(row))
+	for c := range row {
+		cols = append(cols, c)
+	}
+	sort.Strings(cols)
+	quoted := make([]string, len(cols))
+	params := make([]string, len(cols))
+	args := make([]interface{}, len(cols))
+	for i, c := range cols {
+		v, err := value(row[c])
+		if err != nil {
+			return fmt.Errorf("column %s: %w", c, err)
+		}
+		quoted[i] = pq.QuoteIdentifier(c)
+		params[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = v
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(quoted, ", "), strings.Join(params, ", "))
+	_, err := tx.Exec(ctx, query, args...)
+	return err
+}
+
+var templateRe = regexp.MustCompile(`^\{\{\s*(\w+)\s*\}\}$`)
+
+// value converts a decoded fixture value into a query argument.
+func value(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		m := templateRe.FindStringSubmatch(v)
+		if m == nil {
+			return v, nil
+		}
+		switch m[1] {
+		case "now":
+			return time.Now(), nil
+		case "uuid":
+			return newUUID()
+		}
+		return nil, fmt.Errorf("unknown template %q", v)
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+	return v, nil
+}
+
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+func quoteQualified(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = pq.QuoteIdentifier(p)
+	}
+	return strings.Join(parts, ".")
+}
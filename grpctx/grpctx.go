@@ -0,0 +1,89 @@
+// Package grpctx provides gRPC server interceptors that run each RPC in a
+// transaction, like database.DB.TxMiddleware does for HTTP:
+//
+//	srv := grpc.NewServer(
+//		grpc.UnaryInterceptor(grpctx.UnaryServerInterceptor(db)),
+//		grpc.StreamInterceptor(grpctx.StreamServerInterceptor(db)),
+//	)
+//
+// Handlers reach the transaction through database.FromContext, or
+// InContext and RunInTx on the DB, with the RPC's context.
+package grpctx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/pkrypt0987/database"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor runs each unary RPC in a transaction that commits
+// if the handler returns no error and rolls back if it returns one or
+// panics. If the transaction cannot begin the RPC fails with Unavailable,
+// and if it cannot commit with Aborted.
+func UnaryServerInterceptor(db *database.DB) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var resp interface{}
+		err := run(ctx, db, func(ctx context.Context) error {
+			var err error
+			resp, err = handler(ctx, req)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming RPCs; the
+// transaction lasts until the handler returns.
+func StreamServerInterceptor(db *database.DB) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return run(ss.Context(), db, func(ctx context.Context) error {
+			return handler(srv, &stream{ServerStream: ss, ctx: ctx})
+		})
+	}
+}
+
+// handlerError carries the handler's error through Transaction so it is
+// returned to the client unwrapped. Like errRollback for TxMiddleware it
+// only rolls the transaction back: a failed RPC is not a database failure
+// and does not count against the DB's circuit breaker.
+type handlerError struct{ err error }
+
+func (e *handlerError) Error() string { return e.err.Error() }
+
+func run(ctx context.Context, db *database.DB, f func(ctx context.Context) error) error {
+	ran := false
+	err := db.Transaction(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		ran = true
+		if err := f(database.NewContext(ctx, tx)); err != nil {
+			return &handlerError{err}
+		}
+		return nil
+	})
+	var herr *handlerError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &herr):
+		return herr.err
+	case !ran:
+		return status.Errorf(codes.Unavailable, "begin transaction: %v", err)
+	default:
+		return status.Errorf(codes.Aborted, "commit transaction: %v", err)
+	}
+}
+
+// stream is a ServerStream whose context carries the transaction.
+type stream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *stream) Context() context.Context { return s.ctx }
@@ -0,0 +1,34 @@
+package grpctx
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/pkrypt0987/database"
+	"github.com/pkrypt0987/database/fakedb"
+	"google.golang.org/grpc"
+)
+
+func TestHandlerErrorIsNotABreakerFailure(t *testing.T) {
+	f := fakedb.New()
+	db := f.DB(t, database.WithCircuitBreaker(database.BreakerConfig{FailureThreshold: 1}))
+	intercept := UnaryServerInterceptor(db)
+	// A handler failing with a network error of its own, e.g. from a
+	// downstream call, must not open the circuit.
+	herr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	for i := 0; i < 3; i++ {
+		ran := false
+		_, err := intercept(context.Background(), nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			ran = true
+			return nil, herr
+		})
+		if !ran {
+			t.Fatalf("RPC %d: handler not run: %v", i, err)
+		}
+		if err != herr {
+			t.Fatalf("RPC %d: got error %v, want the handler's", i, err)
+		}
+	}
+}
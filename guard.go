@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"errors"
+)
+
+// guard admits or rejects a top-level operation. enter returns the context
+// to run the operation with and a function to call with its result.
+type guard interface {
+	enter(ctx context.Context) (context.Context, func(err error), error)
+}
+
+// errNotRun is passed to the exit functions of guards that admitted an
+// operation that a later guard rejected.
+var errNotRun = errors.New("database: operation not run")
+
+// begin runs db's guards for an operation and returns the context to run it
+// with and a function to call with its result when it ends. Statements
+// inside a transaction belong to the transaction's operation and are not
+// guarded again.
+func (db *DB) begin(ctx context.Context) (context.Context, func(error), error) {
+	if db.tx != nil {
+		return ctx, func(error) {}, nil
+	}
+	if db.defaultWorkload != "" && workloadFrom(ctx) == "" {
+		ctx = WithWorkload(ctx, db.defaultWorkload)
+	}
+	if db.searchPath != "" {
+		ctx = context.WithValue(ctx, searchPathKey{}, db.searchPath)
+	}
+	exits := make([]func(error), 0, len(db.guards))
+	end := func(err error) {
+		for i := len(exits) - 1; i >= 0; i-- {
+			exits[i](err)
+		}
+	}
+	for _, g := range db.guards {
+		var exit func(error)
+		var err error
+		ctx, exit, err = g.enter(ctx)
+		if err != nil {
+			end(errNotRun)
+			return ctx, nil, err
+		}
+		exits = append(exits, exit)
+	}
+	return ctx, end, nil
+}
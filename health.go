@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HealthReport is the result of HealthCheck, suitable for serving from a
+// health endpoint as JSON.
+type HealthReport struct {
+	Healthy bool          `json:"healthy"`
+	Latency time.Duration `json:"latency_ns"`
+	Pool    PoolHealth    `json:"pool"`
+	// InRecovery is set when the role was checked.
+	InRecovery *bool         `json:"in_recovery,omitempty"`
+	Checks     []HealthProbe `json:"checks"`
+}
+
+type PoolHealth struct {
+	MaxOpen      int           `json:"max_open"`
+	Open         int           `json:"open"`
+	InUse        int           `json:"in_use"`
+	Idle         int           `json:"idle"`
+	WaitCount    int64         `json:"wait_count"`
+	WaitDuration time.Duration `json:"wait_duration_ns"`
+	// Saturation is InUse / MaxOpen, or 0 if the pool is unbounded.
+	Saturation float64 `json:"saturation"`
+}
+
+// HealthProbe is the outcome of one check.
+type HealthProbe struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type healthConfig struct {
+	sentinel      string
+	role          string
+	maxLatency    time.Duration
+	maxSaturation float64
+}
+
+// HealthOption adds a check to HealthCheck.
+type HealthOption func(*healthConfig)
+
+// HealthSentinel checks that table exists and is readable.
+func HealthSentinel(table string) HealthOption {
+	return func(c *healthConfig) { c.sentinel = table }
+}
+
+// HealthRequirePrimary checks that the server is not in recovery.
+func HealthRequirePrimary() HealthOption {
+	return func(c *healthConfig) { c.role = "primary" }
+}
+
+// HealthRequireReplica checks that the server is in recovery.
+func HealthRequireReplica() HealthOption {
+	return func(c *healthConfig) { c.role = "replica" }
+}
+
+// HealthMaxLatency fails the check if the SELECT 1 round trip exceeds d.
+func HealthMaxLatency(d time.Duration) HealthOption {
+	return func(c *healthConfig) { c.maxLatency = d }
+}
+
+// HealthMaxSaturation fails the check if the share of pool connections in
+// use exceeds f. The default, 1, never fails: a fully used pool is busy
+// rather than unhealthy.
+func HealthMaxSaturation(f float64) HealthOption {
+	return func(c *healthConfig) { c.maxSaturation = f }
+}
+
+// HealthCheck runs SELECT 1, measures its round trip, inspects the pool and
+// runs any optional checks. The returned error is non-nil when any check
+// failed and summarizes the failures.
+func (db *DB) HealthCheck(ctx context.Context, opts ...HealthOption) (*HealthReport, error) {
+	cfg := healthConfig{maxSaturation: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	r := &HealthReport{Healthy: true}
+	probe := func(name string, err error) {
+		p := HealthProbe{Name: name, OK: err == nil}
+		if err != nil {
+			p.Error = err.Error()
+			r.Healthy = false
+		}
+		r.Checks = append(r.Checks, p)
+	}
+
+	start := time.Now()
+	var one int
+	err := db.db.QueryRowContext(ctx, `SELECT 1`).Scan(&one)
+	r.Latency = time.Since(start)
+	probe("select", err)
+	if err == nil && cfg.maxLatency > 0 && r.Latency > cfg.maxLatency {
+		probe("latency", fmt.Errorf("round trip %s exceeds %s", r.Latency, cfg.maxLatency))
+	}
+
+	s := db.db.Stats()
+	r.Pool = PoolHealth{
+		MaxOpen:      s.MaxOpenConnections,
+		Open:         s.OpenConnections,
+		InUse:        s.InUse,
+		Idle:         s.Idle,
+		WaitCount:    s.WaitCount,
+		WaitDuration: s.WaitDuration,
+	}
+	if s.MaxOpenConnections > 0 {
+		r.Pool.Saturation = float64(s.InUse) / float64(s.MaxOpenConnections)
+	}
+	var satErr error
+	if r.Pool.Saturation > cfg.maxSaturation {
+		satErr = fmt.Errorf("pool saturation %.2f exceeds %.2f", r.Pool.Saturation, cfg.maxSaturation)
+	}
+	probe("pool", satErr)
+
+	if cfg.sentinel != "" {
+		rows, err := db.db.QueryContext(ctx, `SELECT 1 FROM `+quoteIdent(cfg.sentinel)+` LIMIT 1`)
+		if err == nil {
+			err = rows.Close()
+		}
+		probe("sentinel", err)
+	}
+	if cfg.role != "" {
+		var inRecovery bool
+		err := db.db.QueryRowContext(ctx, `SELECT pg_is_in_recovery()`).Scan(&inRecovery)
+		if err == nil {
+			r.InRecovery = &inRecovery
+			if cfg.role == "primary" && inRecovery {
+				err = errors.New("server is a replica, want primary")
+			} else if cfg.role == "replica" && !inRecovery {
+				err = errors.New("server is a primary, want replica")
+			}
+		}
+		probe("role", err)
+	}
+
+	if r.Healthy {
+		return r, nil
+	}
+	var failed []string
+	for _, p := range r.Checks {
+		if !p.OK {
+			failed = append(failed, p.Name+": "+p.Error)
+		}
+	}
+	return r, fmt.Errorf("HealthCheck(): %s", strings.Join(failed, "; "))
+}
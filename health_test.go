@@ -0,0 +1,33 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkrypt0987/database"
+	"github.com/pkrypt0987/database/fakedb"
+)
+
+func TestHealthCheckSaturation(t *testing.T) {
+	f := fakedb.New()
+	f.On(`^SELECT 1$`).Return([]string{"?column?"}, []interface{}{int64(1)})
+	db := f.DB(t)
+	ctx := context.Background()
+
+	// Nothing is in use after the probe, so the pool is at the threshold
+	// without exceeding it.
+	r, err := db.HealthCheck(ctx, database.HealthMaxSaturation(0))
+	if err != nil || !r.Healthy {
+		t.Errorf("HealthCheck = %+v, %v; want healthy", r, err)
+	}
+
+	rows, err := db.Query(ctx, "SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	r, err = db.HealthCheck(ctx, database.HealthMaxSaturation(0))
+	if err == nil || r.Healthy || r.Pool.InUse != 1 {
+		t.Errorf("HealthCheck with a connection in use = %+v, %v; want a saturation failure", r, err)
+	}
+}
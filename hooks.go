@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Hook is run around every Exec, Query and Transaction of a DB, and so
+// Get, Select and the helpers built on them, for cross-cutting concerns
+// such as metrics, tracing or tenancy checks. Embed HookFuncs to implement
+// only some of the methods.
+//
+// Hooks run in the order WithHook registered them, like middleware: the
+// Before methods in order, each receiving the context the previous one
+// returned, and the After methods in reverse order. An error from a Before
+// method fails the call without running it, and only the hooks whose
+// Before method ran have their After method called, with the error.
+type Hook interface {
+	// BeforeQuery runs before an Exec or Query. e has no Duration or Err.
+	BeforeQuery(ctx context.Context, e QueryEvent) (context.Context, error)
+	// AfterQuery runs when an Exec or Query returns, with the context its
+	// BeforeQuery returned.
+	AfterQuery(ctx context.Context, e QueryEvent)
+	// BeforeTx runs before a Transaction, or the savepoint of a nested one.
+	BeforeTx(ctx context.Context, opts *sql.TxOptions) (context.Context, error)
+	// AfterTx runs when a Transaction returns, with its error.
+	AfterTx(ctx context.Context, opts *sql.TxOptions, err error)
+}
+
+// HookFuncs is a Hook whose methods call the functions set, and do
+// nothing if unset.
+type HookFuncs struct {
+	BeforeQueryFunc func(ctx context.Context, e QueryEvent) (context.Context, error)
+	AfterQueryFunc  func(ctx context.Context, e QueryEvent)
+	BeforeTxFunc    func(ctx context.Context, opts *sql.TxOptions) (context.Context, error)
+	AfterTxFunc     func(ctx context.Context, opts *sql.TxOptions, err error)
+}
+
+func (h HookFuncs) BeforeQuery(ctx context.Context, e QueryEvent) (context.Context, error) {
+	if h.BeforeQueryFunc == nil {
+		return ctx, nil
+	}
+	return h.BeforeQueryFunc(ctx, e)
+}
+
+func (h HookFuncs) AfterQuery(ctx context.Context, e QueryEvent) {
+	if h.AfterQueryFunc != nil {
+		h.AfterQueryFunc(ctx, e)
+	}
+}
+
+func (h HookFuncs) BeforeTx(ctx context.Context, opts *sql.TxOptions) (context.Context, error) {
+	if h.BeforeTxFunc == nil {
+		return ctx, nil
+	}
+	return h.BeforeTxFunc(ctx, opts)
+}
+
+func (h HookFuncs) AfterTx(ctx context.Context, opts *sql.TxOptions, err error) {
+	if h.AfterTxFunc != nil {
+		h.AfterTxFunc(ctx, opts, err)
+	}
+}
+
+// WithHook adds hooks after the ones already registered:
+//
+//	db, err := database.Open("postgres", dsn,
+//		database.WithHook(metrics),
+//		database.WithHook(tracing, tenancyCheck),
+//	)
+func WithHook(hooks ...Hook) Option {
+	return func(db *DB) {
+		db.hooks = append(db.hooks, hooks...)
+	}
+}
+
+// hookQuery runs f, the body of an Exec or Query, inside the query hooks.
+func (db *DB) hookQuery(ctx context.Context, op, query string, f func(ctx context.Context) error) error {
+	if len(db.hooks) == 0 {
+		return f(ctx)
+	}
+	e := QueryEvent{Op: op, Query: query, Fingerprint: Fingerprint(query), Labels: Labels(ctx)}
+	start := time.Now()
+	ctxs := make([]context.Context, 0, len(db.hooks))
+	var err error
+	for _, h := range db.hooks {
+		if ctx, err = h.BeforeQuery(ctx, e); err != nil {
+			break
+		}
+		ctxs = append(ctxs, ctx)
+	}
+	if err == nil {
+		err = f(ctx)
+	}
+	e.Duration, e.Err = time.Since(start), err
+	for i := len(ctxs) - 1; i >= 0; i-- {
+		db.hooks[i].AfterQuery(ctxs[i], e)
+	}
+	return err
+}
+
+// hookTx runs f, the body of a Transaction, inside the transaction hooks.
+func (db *DB) hookTx(ctx context.Context, opts *sql.TxOptions, f func(ctx context.Context) error) error {
+	if len(db.hooks) == 0 {
+		return f(ctx)
+	}
+	ctxs := make([]context.Context, 0, len(db.hooks))
+	var err error
+	for _, h := range db.hooks {
+		if ctx, err = h.BeforeTx(ctx, opts); err != nil {
+			break
+		}
+		ctxs = append(ctxs, ctx)
+	}
+	if err == nil {
+		err = f(ctx)
+	}
+	for i := len(ctxs) - 1; i >= 0; i-- {
+		db.hooks[i].AfterTx(ctxs[i], opts, err)
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+)
+
+// noRetryKey marks the context of a transaction that must run once whatever
+// the RetryPolicy, because its callback has effects outside the database.
+type noRetryKey struct{}
+
+// errRollback makes a transaction roll back without it being a failure.
+var errRollback = errors.New("database: rollback")
+
+// TxMiddleware runs each request in a transaction, available to the handler
+// through FromContext, InContext or RunInTx on the request's context. The
+// transaction commits if the handler responds with a 1xx, 2xx or 3xx status
+// and rolls back on a 4xx or 5xx status or a panic, so a request rejected
+// halfway through leaves nothing behind.
+//
+// The response is written before the commit, so if the commit fails the
+// response is aborted with http.ErrAbortHandler rather than completed as a
+// success. If the transaction cannot begin, the request fails with 503.
+// The transaction is never retried, whatever the RetryPolicy, as the handler
+// has already written to the response.
+func (db *DB) TxMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ran := false
+		ctx := context.WithValue(r.Context(), noRetryKey{}, true)
+		err := db.Transaction(ctx, sql.LevelDefault, func(tx *DB) error {
+			ran = true
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r.WithContext(NewContext(r.Context(), tx)))
+			if sw.status >= 400 {
+				return errRollback
+			}
+			return nil
+		})
+		switch {
+		case err == nil || errors.Is(err, errRollback):
+		case !ran:
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		default:
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
+
+// statusWriter records the status of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader && status >= 200 {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,57 @@
+package database_test
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkrypt0987/database"
+	"github.com/pkrypt0987/database/fakedb"
+)
+
+func TestTxMiddleware(t *testing.T) {
+	f := fakedb.New()
+	f.On(`^UPDATE`).ReturnRowsAffected(1)
+	db := f.DB(t)
+	status := http.StatusOK
+	h := db.TxMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tx, ok := database.FromContext(r.Context())
+		if !ok {
+			t.Fatal("no transaction in the request context")
+		}
+		if _, err := tx.Exec(r.Context(), "UPDATE t SET x = 1"); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(status)
+	}))
+	for _, status = range []int{http.StatusOK, http.StatusConflict} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+	}
+	want := []string{"BEGIN", "UPDATE t SET x = 1", "COMMIT", "BEGIN", "UPDATE t SET x = 1", "ROLLBACK"}
+	if got := queries(f.Calls()); !reflect.DeepEqual(got, want) {
+		t.Errorf("queries\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestTxMiddlewareNotRetried(t *testing.T) {
+	f := fakedb.New()
+	f.On(`^COMMIT$`).ReturnError(errSerialization)
+	db := f.DB(t, database.WithRetryPolicy(sql.LevelDefault, database.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+	runs := 0
+	h := db.TxMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		runs++
+		w.Write([]byte("done"))
+	}))
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("panic %v, want http.ErrAbortHandler for the failed commit", p)
+		}
+		if runs != 1 {
+			t.Errorf("handler ran %d times, want 1", runs)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+}
@@ -0,0 +1,17 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// quoteIdent quotes a possibly schema-qualified identifier such as
+// "public.users".
+func quoteIdent(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = pq.QuoteIdentifier(p)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// Call is a statement as seen by the interceptors. They may rewrite its
+// Query and Args before calling next, or short-circuit the call by not
+// calling next and setting its result themselves.
+type Call struct {
+	// Op is "Exec", "Query", "QueryRow", "Get" or "Select".
+	Op    string
+	Query string
+	// Args are the statement's arguments, without its CallOptions.
+	Args []interface{}
+	// Dest is the destination of a Get or Select. A short-circuiting
+	// interceptor fills it.
+	Dest interface{}
+
+	// RowsAffected is the result of an Exec.
+	RowsAffected int64
+	// Rows is the result of a Query, and Row of a QueryRow. A
+	// short-circuiting interceptor sets them, e.g. from a Query on another
+	// DB.
+	Rows *sql.Rows
+	Row  *sql.Row
+}
+
+// Next runs the rest of an interceptor chain and then the call.
+type Next func(ctx context.Context, c *Call) error
+
+// Interceptor is run around Exec, Query, QueryRow, Get and Select, for
+// shadow reads, query hints, caching layers and the like:
+//
+//	hints := func(ctx context.Context, c *database.Call, next database.Next) error {
+//		c.Query = "/*+ IndexScan(orders) */ " + c.Query
+//		return next(ctx, c)
+//	}
+//
+// Interceptors run in the order WithInterceptor registered them, each
+// around the ones after it, before the hooks, which see the statement as
+// rewritten. Statements run with the context an interceptor receives,
+// including the Query of a Get or Select and the interceptor's own, are not
+// intercepted again.
+type Interceptor func(ctx context.Context, c *Call, next Next) error
+
+// WithInterceptor adds interceptors after the ones already registered.
+func WithInterceptor(interceptors ...Interceptor) Option {
+	return func(db *DB) {
+		db.interceptors = append(db.interceptors, interceptors...)
+	}
+}
+
+// errNoResult is the error of a Query or QueryRow short-circuited by an
+// interceptor that set no result.
+var errNoResult = errors.New("database: interceptor set no result")
+
+type interceptedKey struct{}
+
+// intercept runs call, the body of c's Op, inside the interceptors.
+func (db *DB) intercept(ctx context.Context, c *Call, call Next) error {
+	if len(db.interceptors) == 0 || ctx.Value(interceptedKey{}) != nil {
+		return call(ctx, c)
+	}
+	ctx, c.Args = withCallOptions(ctx, c.Args)
+	next := call
+	for i := len(db.interceptors) - 1; i >= 0; i-- {
+		ic, inner := db.interceptors[i], next
+		next = func(ctx context.Context, c *Call) error {
+			return ic(ctx, c, inner)
+		}
+	}
+	return next(context.WithValue(ctx, interceptedKey{}, true), c)
+}
@@ -0,0 +1,27 @@
+package database
+
+import "context"
+
+type labelsKey struct{}
+
+// WithLabel returns a copy of ctx carrying the label key=value, e.g.
+// WithLabel(ctx, "op", "create_order"), which the QueryEvents and
+// QueryErrors of the statements run with it carry, for per-endpoint
+// dashboards and logs without parsing query text. Labels accumulate; a
+// key set again is replaced.
+func WithLabel(ctx context.Context, key, value string) context.Context {
+	prev := Labels(ctx)
+	labels := make(map[string]string, len(prev)+1)
+	for k, v := range prev {
+		labels[k] = v
+	}
+	labels[key] = value
+	return context.WithValue(ctx, labelsKey{}, labels)
+}
+
+// Labels returns the labels WithLabel stored in ctx. The map must not be
+// modified.
+func Labels(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(labelsKey{}).(map[string]string)
+	return labels
+}
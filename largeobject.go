@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// LargeObjectMode is the access mode of an opened large object.
+type LargeObjectMode int32
+
+const (
+	LargeObjectWrite     LargeObjectMode = 0x20000
+	LargeObjectRead      LargeObjectMode = 0x40000
+	LargeObjectReadWrite                 = LargeObjectRead | LargeObjectWrite
+)
+
+// maxLargeObjectChunk bounds the bytes read or written by one round trip.
+const maxLargeObjectChunk = 1 << 20
+
+// LargeObject is an open large object, for blobs too big to read and
+// write as bytea values in one piece. It is bound to the transaction that
+// opened it and to the context it was opened with, and is closed when the
+// transaction ends.
+type LargeObject struct {
+	tx  *DB
+	ctx context.Context
+	oid uint32
+	fd  int32
+}
+
+// CreateLargeObject creates an empty large object and opens it for reading
+// and writing. Store its OID to open it again. It must be called on a
+// transaction.
+func (db *DB) CreateLargeObject(ctx context.Context) (*LargeObject, error) {
+	if db.tx == nil {
+		return nil, errors.New("CreateLargeObject(): not in a transaction")
+	}
+	var oid int64
+	if err := db.QueryRow(ctx, `SELECT lo_create(0)`).Scan(&oid); err != nil {
+		return nil, fmt.Errorf("CreateLargeObject(): %w", err)
+	}
+	lo, err := db.openLargeObject(ctx, uint32(oid), LargeObjectReadWrite)
+	if err != nil {
+		return nil, fmt.Errorf("CreateLargeObject(): %w", err)
+	}
+	return lo, nil
+}
+
+// OpenLargeObject opens the large object oid. It must be called on a
+// transaction.
+func (db *DB) OpenLargeObject(ctx context.Context, oid uint32, mode LargeObjectMode) (*LargeObject, error) {
+	if db.tx == nil {
+		return nil, fmt.Errorf("OpenLargeObject(%d): not in a transaction", oid)
+	}
+	lo, err := db.openLargeObject(ctx, oid, mode)
+	if err != nil {
+		return nil, fmt.Errorf("OpenLargeObject(%d): %w", oid, err)
+	}
+	return lo, nil
+}
+
+func (db *DB) openLargeObject(ctx context.Context, oid uint32, mode LargeObjectMode) (*LargeObject, error) {
+	lo := &LargeObject{tx: db, ctx: ctx, oid: oid}
+	if err := db.QueryRow(ctx, `SELECT lo_open($1, $2)`, int64(oid), int32(mode)).Scan(&lo.fd); err != nil {
+		return nil, err
+	}
+	return lo, nil
+}
+
+// DeleteLargeObject deletes the large object oid.
+func (db *DB) DeleteLargeObject(ctx context.Context, oid uint32) error {
+	if _, err := db.Exec(ctx, `SELECT lo_unlink($1)`, int64(oid)); err != nil {
+		return fmt.Errorf("DeleteLargeObject(%d): %w", oid, err)
+	}
+	return nil
+}
+
+// OID returns the large object's OID.
+func (lo *LargeObject) OID() uint32 {
+	return lo.oid
+}
+
+// Read reads up to len(p) bytes, at most 1MB, from the current position.
+func (lo *LargeObject) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n := len(p)
+	if n > maxLargeObjectChunk {
+		n = maxLargeObjectChunk
+	}
+	var b []byte
+	if err := lo.tx.QueryRow(lo.ctx, `SELECT loread($1, $2)`, lo.fd, n).Scan(&b); err != nil {
+		return 0, fmt.Errorf("LargeObject.Read(%d): %w", lo.oid, err)
+	}
+	if len(b) == 0 {
+		return 0, io.EOF
+	}
+	return copy(p, b), nil
+}
+
+// Write writes p at the current position, in chunks of at most 1MB.
+func (lo *LargeObject) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := p[written:]
+		if len(chunk) > maxLargeObjectChunk {
+			chunk = chunk[:maxLargeObjectChunk]
+		}
+		var n int
+		if err := lo.tx.QueryRow(lo.ctx, `SELECT lowrite($1, $2)`, lo.fd, chunk).Scan(&n); err != nil {
+			return written, fmt.Errorf("LargeObject.Write(%d): %w", lo.oid, err)
+		}
+		written += n
+		if n < len(chunk) {
+			return written, io.ErrShortWrite
+		}
+	}
+	return written, nil
+}
+
+// Seek sets the position for the next Read or Write, as io.Seeker.
+func (lo *LargeObject) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	if err := lo.tx.QueryRow(lo.ctx, `SELECT lo_lseek64($1, $2, $3)`, lo.fd, offset, whence).Scan(&pos); err != nil {
+		return 0, fmt.Errorf("LargeObject.Seek(%d): %w", lo.oid, err)
+	}
+	return pos, nil
+}
+
+// Truncate truncates the large object to size bytes.
+func (lo *LargeObject) Truncate(size int64) error {
+	if _, err := lo.tx.Exec(lo.ctx, `SELECT lo_truncate64($1, $2)`, lo.fd, size); err != nil {
+		return fmt.Errorf("LargeObject.Truncate(%d): %w", lo.oid, err)
+	}
+	return nil
+}
+
+// Close closes the large object. The transaction's end closes it too.
+func (lo *LargeObject) Close() error {
+	if _, err := lo.tx.Exec(lo.ctx, `SELECT lo_close($1)`, lo.fd); err != nil {
+		return fmt.Errorf("LargeObject.Close(%d): %w", lo.oid, err)
+	}
+	return nil
+}
+
+var _ io.ReadWriteSeeker = (*LargeObject)(nil)
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrRowLocked is returned by Query, Get and Select, wrapping the server's
+// error, when a row lock could not be taken: another transaction holds it
+// and NoWait was given, or lock_timeout expired.
+var ErrRowLocked = errors.New("database: row is locked")
+
+// SelectForUpdate appends FOR UPDATE to the query of a Query, QueryRow, Get
+// or Select call, locking the selected rows until the transaction ends.
+func SelectForUpdate() CallOption {
+	return callOptionFunc(func(c *callConfig) { c.lock = "FOR UPDATE" })
+}
+
+// SelectForShare appends FOR SHARE, locking the selected rows against
+// updates and deletes but not against other FOR SHARE readers.
+func SelectForShare() CallOption {
+	return callOptionFunc(func(c *callConfig) { c.lock = "FOR SHARE" })
+}
+
+// NoWait makes SelectForUpdate or SelectForShare fail with ErrRowLocked
+// instead of waiting for a row another transaction has locked.
+func NoWait() CallOption {
+	return callOptionFunc(func(c *callConfig) { c.lockWait = "NOWAIT" })
+}
+
+// SkipLocked makes SelectForUpdate or SelectForShare leave out the rows
+// another transaction has locked, e.g. for job queues.
+func SkipLocked() CallOption {
+	return callOptionFunc(func(c *callConfig) { c.lockWait = "SKIP LOCKED" })
+}
+
+// lockQuery appends the locking clause requested for the call to query.
+func lockQuery(ctx context.Context, query string) string {
+	cfg := callConfigFrom(ctx)
+	if cfg == nil || cfg.lock == "" {
+		return query
+	}
+	query = strings.TrimRight(query, " \t\r\n;") + " " + cfg.lock
+	if cfg.lockWait != "" {
+		query += " " + cfg.lockWait
+	}
+	return query
+}
+
+// lockError wraps a lock_not_available error in ErrRowLocked.
+func lockError(err error) error {
+	if err != nil && SQLState(err) == "55P03" {
+		return fmt.Errorf("%w: %w", ErrRowLocked, err)
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DatabaseConfig is how a Manager opens one of its databases.
+type DatabaseConfig struct {
+	Driver string
+	DSN    string
+	// Options are applied after the Manager's common options.
+	Options []Option
+}
+
+// Manager holds several named databases, e.g. "core", "analytics" and
+// "audit", with common health checks and shutdown.
+type Manager struct {
+	dbs map[string]*DB
+}
+
+// OpenManager opens every database in configs with opts followed by its own
+// options. If one fails to open, the ones already opened are closed.
+func OpenManager(configs map[string]DatabaseConfig, opts ...Option) (*Manager, error) {
+	m := &Manager{dbs: make(map[string]*DB, len(configs))}
+	for name, cfg := range configs {
+		dbOpts := append(append([]Option(nil), opts...), cfg.Options...)
+		db, err := Open(cfg.Driver, cfg.DSN, dbOpts...)
+		if err != nil {
+			m.Close()
+			return nil, fmt.Errorf("OpenManager(): %s: %w", name, err)
+		}
+		m.dbs[name] = db
+	}
+	return m, nil
+}
+
+// DB returns the named database, or nil if there is none.
+func (m *Manager) DB(name string) *DB {
+	return m.dbs[name]
+}
+
+// Lookup returns the named database and whether it exists.
+func (m *Manager) Lookup(name string) (*DB, bool) {
+	db, ok := m.dbs[name]
+	return db, ok
+}
+
+// Names returns the names of the databases, sorted.
+func (m *Manager) Names() []string {
+	names := make([]string, 0, len(m.dbs))
+	for name := range m.dbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HealthCheck checks every database concurrently. The error joins the
+// failures, each prefixed with its database's name.
+func (m *Manager) HealthCheck(ctx context.Context, opts ...HealthOption) (map[string]*HealthReport, error) {
+	var mu sync.Mutex
+	reports := make(map[string]*HealthReport, len(m.dbs))
+	err := m.each(func(name string, db *DB) error {
+		r, err := db.HealthCheck(ctx, opts...)
+		mu.Lock()
+		reports[name] = r
+		mu.Unlock()
+		return err
+	})
+	if err != nil {
+		return reports, fmt.Errorf("Manager.HealthCheck(): %w", err)
+	}
+	return reports, nil
+}
+
+// Shutdown shuts every database down concurrently, see DB.Shutdown.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	if err := m.each(func(_ string, db *DB) error { return db.Shutdown(ctx) }); err != nil {
+		return fmt.Errorf("Manager.Shutdown(): %w", err)
+	}
+	return nil
+}
+
+func (m *Manager) Close() error {
+	return m.each(func(_ string, db *DB) error { return db.Close() })
+}
+
+// each runs f for every database concurrently and joins the errors in name
+// order.
+func (m *Manager) each(f func(name string, db *DB) error) error {
+	names := m.Names()
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			if err := f(name, m.dbs[name]); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", name, err)
+			}
+		}(i, name)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
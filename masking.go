@@ -0,0 +1,163 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaskingPolicy says which values are personal data to be kept out of
+// logs, error messages and trace attributes.
+type MaskingPolicy struct {
+	// Params are names of sql.Named arguments whose values are masked.
+	Params []string
+	// Columns mask the arguments compared with or inserted into these
+	// columns, e.g. "email" masks $2 in "WHERE email = $2", and their
+	// values in "Key (email)=(...)" error details.
+	Columns []string
+	// Patterns mask their matches anywhere, e.g. e-mail addresses or card
+	// numbers.
+	Patterns []*regexp.Regexp
+	// Mask replaces masked values. Defaults to "***".
+	Mask string
+}
+
+// WithMasking masks the values policy selects in the errors Exec, Query,
+// Get, Select and Transaction return, and in MaskQuery and MaskArgs for the
+// application's own logs and traces. Masked errors still unwrap to the
+// driver's error.
+func WithMasking(policy MaskingPolicy) Option {
+	if policy.Mask == "" {
+		policy.Mask = "***"
+	}
+	return func(db *DB) {
+		db.masking = &policy
+	}
+}
+
+// MaskQuery returns query with the policy's patterns masked, e.g. literals
+// spliced into it.
+func (db *DB) MaskQuery(query string) string {
+	if db.masking == nil {
+		return query
+	}
+	return db.masking.maskText(query)
+}
+
+// MaskArgs returns a copy of the arguments of query with the values the
+// policy selects replaced by the mask.
+func (db *DB) MaskArgs(query string, args []interface{}) []interface{} {
+	out := append([]interface{}(nil), args...)
+	p := db.masking
+	if p == nil {
+		return out
+	}
+	masked := p.maskedParams(query)
+	for i, a := range out {
+		switch v := a.(type) {
+		case sql.NamedArg:
+			if containsFold(p.Params, v.Name) || masked[i+1] {
+				v.Value = p.Mask
+				out[i] = v
+			}
+		case string:
+			if masked[i+1] {
+				out[i] = p.Mask
+			} else {
+				out[i] = p.maskText(v)
+			}
+		default:
+			if masked[i+1] {
+				out[i] = p.Mask
+			}
+		}
+	}
+	return out
+}
+
+// maskError masks err's message if the DB has a masking policy.
+func (db *DB) maskError(err error) error {
+	var m *maskedError
+	if db.masking == nil || err == nil || errors.As(err, &m) {
+		return err
+	}
+	msg := db.masking.maskText(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &maskedError{err: err, msg: msg}
+}
+
+type maskedError struct {
+	err error
+	msg string
+}
+
+func (e *maskedError) Error() string { return e.msg }
+func (e *maskedError) Unwrap() error { return e.err }
+
+// keyDetail matches the "Key (col)=(value)" of constraint violations.
+var keyDetail = regexp.MustCompile(`Key \(([^)]*)\)=\((.*?)\)`)
+
+func (p *MaskingPolicy) maskText(s string) string {
+	for _, re := range p.Patterns {
+		s = re.ReplaceAllLiteralString(s, p.Mask)
+	}
+	if len(p.Columns) > 0 {
+		s = keyDetail.ReplaceAllStringFunc(s, func(m string) string {
+			sub := keyDetail.FindStringSubmatch(m)
+			for _, c := range strings.Split(sub[1], ",") {
+				if containsFold(p.Columns, strings.Trim(strings.TrimSpace(c), `"`)) {
+					return "Key (" + sub[1] + ")=(" + p.Mask + ")"
+				}
+			}
+			return m
+		})
+	}
+	return s
+}
+
+var (
+	// comparedParam matches a column compared with a placeholder.
+	comparedParam = regexp.MustCompile(`(?i)("?[A-Za-z_][A-Za-z0-9_]*"?)\s*(?:=|<>|!=|<=|>=|<|>|\bLIKE\b|\bILIKE\b)\s*\$(\d+)`)
+	// insertColumns matches the column and value lists of an INSERT.
+	insertColumns = regexp.MustCompile(`(?is)INSERT\s+INTO\s+\S+\s*\(([^)]*)\)\s*VALUES\s*\(([^)]*)\)`)
+)
+
+// maskedParams returns the placeholder numbers of query bound to the
+// policy's columns.
+func (p *MaskingPolicy) maskedParams(query string) map[int]bool {
+	masked := map[int]bool{}
+	if len(p.Columns) == 0 {
+		return masked
+	}
+	for _, m := range comparedParam.FindAllStringSubmatch(query, -1) {
+		if containsFold(p.Columns, strings.Trim(m[1], `"`)) {
+			n, _ := strconv.Atoi(m[2])
+			masked[n] = true
+		}
+	}
+	for _, m := range insertColumns.FindAllStringSubmatch(query, -1) {
+		cols, vals := strings.Split(m[1], ","), strings.Split(m[2], ",")
+		for i := 0; i < len(cols) && i < len(vals); i++ {
+			col := strings.Trim(strings.TrimSpace(cols[i]), `"`)
+			val := strings.TrimSpace(vals[i])
+			if containsFold(p.Columns, col) && strings.HasPrefix(val, "$") {
+				n, _ := strconv.Atoi(val[1:])
+				masked[n] = true
+			}
+		}
+	}
+	return masked
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RefreshStats describes the refreshes of a materialized view by a
+// RefreshManager.
+type RefreshStats struct {
+	View string
+	// LastRefresh is when the last successful refresh finished, zero if
+	// there was none yet.
+	LastRefresh time.Time
+	// Duration is how long the last successful refresh took.
+	Duration time.Duration
+	// Concurrent reports whether it ran CONCURRENTLY.
+	Concurrent bool
+	Refreshes  int
+	// Skipped counts scheduled refreshes left out because another instance
+	// was refreshing the view.
+	Skipped int
+	// LastErr is the error of the last refresh, nil if it succeeded.
+	LastErr error
+}
+
+// Staleness returns how long ago the view was last refreshed by this
+// instance, as of now.
+func (s RefreshStats) Staleness(now time.Time) time.Duration {
+	if s.LastRefresh.IsZero() {
+		return 0
+	}
+	return now.Sub(s.LastRefresh)
+}
+
+// RefreshManager refreshes materialized views on a schedule or on demand.
+// A refresh takes a transaction-level advisory lock on the view, so
+// instances sharing the database never refresh the same view at once. It
+// runs CONCURRENTLY, so readers are not blocked, when the view is populated
+// and has a unique index on plain columns, as PostgreSQL requires.
+type RefreshManager struct {
+	db *DB
+	// Timeout bounds each scheduled refresh. Defaults to 10 minutes.
+	Timeout time.Duration
+	// OnRefresh is called after every refresh, successful or not, with the
+	// view's updated stats.
+	OnRefresh func(RefreshStats)
+
+	mu        sync.Mutex
+	intervals map[string]time.Duration
+	stats     map[string]*RefreshStats
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// NewRefreshManager returns a RefreshManager refreshing views of db.
+func NewRefreshManager(db *DB) *RefreshManager {
+	return &RefreshManager{db: db, intervals: map[string]time.Duration{}, stats: map[string]*RefreshStats{}}
+}
+
+// Register adds view, refreshed every interval once Start is called, or
+// only by Refresh if interval is 0. It must be called before Start.
+func (m *RefreshManager) Register(view string, interval time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.intervals[view] = interval
+	if m.stats[view] == nil {
+		m.stats[view] = &RefreshStats{View: view}
+	}
+}
+
+// Start starts refreshing the registered views on their schedules until
+// Stop is called. The first refresh of each view runs one interval after
+// Start.
+func (m *RefreshManager) Start() {
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mu.Lock()
+	m.cancel = cancel
+	for view, interval := range m.intervals {
+		if interval <= 0 {
+			continue
+		}
+		m.wg.Add(1)
+		go m.run(ctx, view, interval, timeout)
+	}
+	m.mu.Unlock()
+}
+
+// Stop stops the schedules and waits for in-progress refreshes to finish.
+func (m *RefreshManager) Stop() {
+	m.mu.Lock()
+	cancel := m.cancel
+	m.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	m.wg.Wait()
+}
+
+func (m *RefreshManager) run(ctx context.Context, view string, interval, timeout time.Duration) {
+	defer m.wg.Done()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		rctx, cancel := context.WithTimeout(ctx, timeout)
+		m.refresh(rctx, view, false)
+		cancel()
+	}
+}
+
+// Refresh refreshes view now, waiting for a refresh of it by another
+// instance to finish first.
+func (m *RefreshManager) Refresh(ctx context.Context, view string) error {
+	return m.refresh(ctx, view, true)
+}
+
+// Stats returns the stats of the views refreshed or registered so far,
+// ordered by view.
+func (m *RefreshManager) Stats() []RefreshStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]RefreshStats, 0, len(m.stats))
+	for _, s := range m.stats {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].View < out[j].View })
+	return out
+}
+
+func (m *RefreshManager) refresh(ctx context.Context, view string, wait bool) error {
+	var start time.Time
+	locked, concurrent := true, false
+	err := m.db.Transaction(ctx, sql.LevelDefault, func(tx *DB) error {
+		if d := tx.Dialect(); d.Name() != "postgres" {
+			return fmt.Errorf("materialized views need postgres, not %s", d.Name())
+		}
+		if wait {
+			if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "refresh:"+view); err != nil {
+				return err
+			}
+		} else if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock(hashtext($1))`, "refresh:"+view).Scan(&locked); err != nil || !locked {
+			return err
+		}
+		err := tx.QueryRow(ctx, `SELECT m.ispopulated AND EXISTS (
+				SELECT 1 FROM pg_index i
+				WHERE i.indrelid = to_regclass($1) AND i.indisunique AND i.indpred IS NULL AND i.indexprs IS NULL)
+			FROM pg_matviews m
+			WHERE to_regclass(quote_ident(m.schemaname) || '.' || quote_ident(m.matviewname)) = to_regclass($1)`,
+			quoteIdent(view)).Scan(&concurrent)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%s is not a materialized view", view)
+		}
+		if err != nil {
+			return err
+		}
+		stmt := `REFRESH MATERIALIZED VIEW ` + quoteIdent(view)
+		if concurrent {
+			stmt = `REFRESH MATERIALIZED VIEW CONCURRENTLY ` + quoteIdent(view)
+		}
+		start = time.Now()
+		_, err = tx.Exec(ctx, stmt)
+		return err
+	})
+	if err != nil {
+		err = fmt.Errorf("RefreshManager.Refresh(%s): %w", view, err)
+	}
+
+	m.mu.Lock()
+	s := m.stats[view]
+	if s == nil {
+		s = &RefreshStats{View: view}
+		m.stats[view] = s
+	}
+	if !locked && err == nil {
+		s.Skipped++
+		m.mu.Unlock()
+		return nil
+	}
+	s.LastErr = err
+	if err == nil {
+		s.LastRefresh, s.Duration, s.Concurrent = time.Now(), time.Since(start), concurrent
+		s.Refreshes++
+	}
+	stats := *s
+	m.mu.Unlock()
+
+	if m.OnRefresh != nil {
+		m.OnRefresh(stats)
+	}
+	return err
+}
@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MigrationsTable is the table where applied migration versions are recorded.
+const MigrationsTable = "schema_migrations"
+
+// Migration is a single versioned schema change.
+type Migration struct {
+	Version int64
+	Name    string
+	SQL     string
+}
+
+// Migrator applies migrations in version order, recording each applied
+// version in MigrationsTable.
+type Migrator struct {
+	db         *DB
+	migrations []Migration
+	seeder     *Seeder
+}
+
+func NewMigrator(db *DB, migrations []Migration) *Migrator {
+	ms := make([]Migration, len(migrations))
+	copy(ms, migrations)
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	return &Migrator{db: db, migrations: ms}
+}
+
+// WithSeeder makes Up and DryRun run the seeder after the migrations.
+func (m *Migrator) WithSeeder(s *Seeder) *Migrator {
+	m.seeder = s
+	return m
+}
+
+// LoadMigrations reads files named "<version>_<name>.sql" from dir in fsys.
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var ms []Migration
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+		base := strings.TrimSuffix(e.Name(), ".sql")
+		v, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %q: invalid version: %w", e.Name(), err)
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, Migration{Version: version, Name: name, SQL: string(b)})
+	}
+	return ms, nil
+}
+
+// Plan returns the migrations that have not been applied yet, in the order
+// Up would apply them. It does not modify the database.
+func (m *Migrator) Plan(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, fmt.Errorf("Plan(): %w", err)
+	}
+	var pending []Migration
+	for _, mg := range m.migrations {
+		if !applied[mg.Version] {
+			pending = append(pending, mg)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration, each in its own transaction.
+func (m *Migrator) Up(ctx context.Context) error {
+	if err := m.init(ctx, m.db); err != nil {
+		return fmt.Errorf("Up(): %w", err)
+	}
+	pending, err := m.Plan(ctx)
+	if err != nil {
+		return err
+	}
+	for _, mg := range pending {
+		err := m.db.Transaction(ctx, sql.LevelDefault, func(tx *DB) error {
+			return m.apply(ctx, tx, mg)
+		})
+		if err != nil {
+			return fmt.Errorf("Up(): migration %d_%s: %w", mg.Version, mg.Name, err)
+		}
+	}
+	if m.seeder != nil {
+		if err := m.seeder.Run(ctx); err != nil {
+			return fmt.Errorf("Up(): %w", err)
+		}
+	}
+	return nil
+}
+
+// errDryRun forces the dry-run transaction to roll back.
+var errDryRun = errors.New("dry run")
+
+// DryRun applies every pending migration inside a single transaction and
+// then rolls it back, so the migration SQL can be validated without
+// changing the database. It returns the migrations that were executed.
+func (m *Migrator) DryRun(ctx context.Context) ([]Migration, error) {
+	pending, err := m.Plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) == 0 && m.seeder == nil {
+		return nil, nil
+	}
+	err = m.db.Transaction(ctx, sql.LevelDefault, func(tx *DB) error {
+		if err := m.init(ctx, tx); err != nil {
+			return err
+		}
+		for _, mg := range pending {
+			if err := m.apply(ctx, tx, mg); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mg.Version, mg.Name, err)
+			}
+		}
+		if m.seeder != nil {
+			if err := m.seeder.runTx(ctx, tx); err != nil {
+				return err
+			}
+		}
+		return errDryRun
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, fmt.Errorf("DryRun(): %w", err)
+	}
+	return pending, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, tx *DB, mg Migration) error {
+	if _, err := tx.Exec(ctx, mg.SQL); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `INSERT INTO `+MigrationsTable+` (version, name) VALUES ($1, $2)`, mg.Version, mg.Name)
+	return err
+}
+
+func (m *Migrator) init(ctx context.Context, db *DB) error {
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+MigrationsTable+` (
+		version    BIGINT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	return err
+}
+
+// applied returns the recorded versions; a missing MigrationsTable means none.
+// The table is looked up in the current schema only, which is where init
+// creates it, so a tenant schema is not mistaken for one already migrated
+// because a schema later in the search_path has the table.
+func (m *Migrator) applied(ctx context.Context, db *DB) (map[int64]bool, error) {
+	applied := make(map[int64]bool)
+	var exists bool
+	if err := db.QueryRow(ctx, `SELECT to_regclass(quote_ident(current_schema()) || '.' || $1) IS NOT NULL`, MigrationsTable).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return applied, nil
+	}
+	rows, err := db.Query(ctx, `SELECT version FROM `+MigrationsTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
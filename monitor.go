@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type HealthMonitorConfig struct {
+	// Interval between checks. Defaults to 10 seconds.
+	Interval time.Duration
+	// Timeout bounds each check. Defaults to 5 seconds.
+	Timeout time.Duration
+	// FailureThreshold is the number of consecutive failed checks before the
+	// database is considered unhealthy. Defaults to 1.
+	FailureThreshold int
+	// Options are passed to every HealthCheck.
+	Options []HealthOption
+	// OnUnhealthy is called when the database becomes unhealthy.
+	OnUnhealthy func(r *HealthReport, err error)
+	// OnRecovered is called when an unhealthy database passes a check again.
+	OnRecovered func(r *HealthReport)
+}
+
+// HealthMonitor checks the database in the background. The database is
+// assumed healthy until a check says otherwise.
+type HealthMonitor struct {
+	db     *DB
+	cfg    HealthMonitorConfig
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu       sync.Mutex
+	healthy  bool
+	last     *HealthReport
+	lastErr  error
+	failures int
+}
+
+// StartHealthMonitor starts checking the database every cfg.Interval until
+// Stop is called. Callbacks run on the monitor goroutine.
+func (db *DB) StartHealthMonitor(cfg HealthMonitorConfig) *HealthMonitor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &HealthMonitor{db: db, cfg: cfg, cancel: cancel, done: make(chan struct{}), healthy: true}
+	go m.run(ctx)
+	return m
+}
+
+// Healthy reports the current state.
+func (m *HealthMonitor) Healthy() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.healthy
+}
+
+// Last returns the most recent report and its error, or nil before the first
+// check completes.
+func (m *HealthMonitor) Last() (*HealthReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last, m.lastErr
+}
+
+// Stop stops the monitor and waits for an in-progress check to finish.
+func (m *HealthMonitor) Stop() {
+	m.cancel()
+	<-m.done
+}
+
+func (m *HealthMonitor) run(ctx context.Context) {
+	defer close(m.done)
+	t := time.NewTicker(m.cfg.Interval)
+	defer t.Stop()
+	for {
+		m.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (m *HealthMonitor) check(ctx context.Context) {
+	cctx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+	r, err := m.db.HealthCheck(cctx, m.cfg.Options...)
+	cancel()
+	if ctx.Err() != nil {
+		// Stopped mid-check; the result says nothing about the database.
+		return
+	}
+
+	m.mu.Lock()
+	m.last, m.lastErr = r, err
+	wasHealthy := m.healthy
+	if err != nil {
+		m.failures++
+		if m.failures >= m.cfg.FailureThreshold {
+			m.healthy = false
+		}
+	} else {
+		m.failures = 0
+		m.healthy = true
+	}
+	healthy := m.healthy
+	m.mu.Unlock()
+
+	if wasHealthy && !healthy && m.cfg.OnUnhealthy != nil {
+		m.cfg.OnUnhealthy(r, err)
+	}
+	if !wasHealthy && healthy && m.cfg.OnRecovered != nil {
+		m.cfg.OnRecovered(r)
+	}
+}
@@ -0,0 +1,253 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// hostConnector returns a connector that implements libpq's multi-host
+// semantics when dsn lists several hosts or sets target_session_attrs, and
+// nil otherwise. Both URL ("postgres://h1:5432,h2:5432/db") and key/value
+// ("host=h1,h2 port=5432") DSNs are understood.
+//
+// Each new connection tries the hosts in order, starting with the one that
+// last yielded a connection, and keeps the first whose session matches
+// target_session_attrs: any (the default), read-write, read-only, primary,
+// standby or prefer-standby. When the primary fails over, connections to it
+// fail or stop matching and the pool moves on to the new primary.
+func hostConnector(drv driver.Driver, dsn string, connector func(dsn string) driver.Connector) (driver.Connector, error) {
+	hosts, attrs, err := splitHosts(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) <= 1 && attrs == "any" {
+		return nil, nil
+	}
+	switch attrs {
+	case "read-write", "read-only", "primary", "standby", "prefer-standby":
+	default:
+		return nil, fmt.Errorf("database: invalid target_session_attrs %q", attrs)
+	}
+	c := &multiHostConnector{drv: drv, attrs: attrs}
+	for _, h := range hosts {
+		c.hosts = append(c.hosts, connector(h))
+	}
+	return c, nil
+}
+
+type multiHostConnector struct {
+	drv   driver.Driver
+	hosts []driver.Connector
+	attrs string
+	// last is the index of the host that last yielded a connection.
+	last atomic.Int32
+}
+
+func (c *multiHostConnector) Driver() driver.Driver { return c.drv }
+
+func (c *multiHostConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	passes := []string{c.attrs}
+	if c.attrs == "prefer-standby" {
+		passes = []string{"standby", "any"}
+	}
+	var errs []error
+	start := int(c.last.Load())
+	for _, attrs := range passes {
+		for i := range c.hosts {
+			n := (start + i) % len(c.hosts)
+			conn, err := c.hosts[n].Connect(ctx)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("host %d: %w", n, err))
+				continue
+			}
+			ok, err := sessionMatches(ctx, conn, attrs)
+			if err != nil || !ok {
+				conn.Close()
+				if err == nil {
+					err = fmt.Errorf("session is not %s", attrs)
+				}
+				errs = append(errs, fmt.Errorf("host %d: %w", n, err))
+				continue
+			}
+			c.last.Store(int32(n))
+			return conn, nil
+		}
+	}
+	return nil, fmt.Errorf("database: no host matches target_session_attrs=%s: %w", c.attrs, errors.Join(errs...))
+}
+
+// sessionMatches reports whether conn's session satisfies attrs.
+func sessionMatches(ctx context.Context, conn driver.Conn, attrs string) (bool, error) {
+	switch attrs {
+	case "read-write", "read-only":
+		v, err := connValue(ctx, conn, "SHOW transaction_read_only")
+		if err != nil {
+			return false, err
+		}
+		return isTrue(v) == (attrs == "read-only"), nil
+	case "primary", "standby":
+		v, err := connValue(ctx, conn, "SELECT pg_is_in_recovery()")
+		if err != nil {
+			return false, err
+		}
+		return isTrue(v) == (attrs == "standby"), nil
+	}
+	return true, nil
+}
+
+// isTrue interprets a boolean or on/off setting as returned by the driver.
+func isTrue(v driver.Value) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case []byte:
+		return isTrue(string(v))
+	case string:
+		return v == "t" || v == "true" || v == "on"
+	}
+	return false
+}
+
+// splitHosts returns one single-host DSN per host listed in dsn, with
+// target_session_attrs removed since drivers without multi-host support
+// would pass it to the server, and the attrs value ("any" if unset).
+func splitHosts(dsn string) ([]string, string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return splitURLHosts(dsn)
+	}
+	return splitKeywordHosts(dsn)
+}
+
+func splitURLHosts(dsn string) ([]string, string, error) {
+	scheme, rest, _ := strings.Cut(dsn, "://")
+	end := strings.IndexAny(rest, "/?")
+	if end < 0 {
+		end = len(rest)
+	}
+	authority, tail := rest[:end], rest[end:]
+	userinfo, hostlist := "", authority
+	if at := strings.LastIndex(authority, "@"); at >= 0 {
+		userinfo, hostlist = authority[:at+1], authority[at+1:]
+	}
+	path, rawQuery, _ := strings.Cut(tail, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, "", fmt.Errorf("database: invalid DSN query: %w", err)
+	}
+	attrs := query.Get("target_session_attrs")
+	query.Del("target_session_attrs")
+	if attrs == "" {
+		attrs = "any"
+	}
+	suffix := path
+	if q := query.Encode(); q != "" {
+		suffix += "?" + q
+	}
+	var out []string
+	for _, h := range strings.Split(hostlist, ",") {
+		out = append(out, scheme+"://"+userinfo+h+suffix)
+	}
+	return out, attrs, nil
+}
+
+func splitKeywordHosts(dsn string) ([]string, string, error) {
+	var keep []string
+	var hosts, ports []string
+	attrs := "any"
+	for _, kv := range splitKeywords(dsn) {
+		k, v, _ := strings.Cut(kv, "=")
+		switch strings.TrimSpace(k) {
+		case "host":
+			hosts = strings.Split(unquote(v), ",")
+		case "port":
+			ports = strings.Split(unquote(v), ",")
+		case "target_session_attrs":
+			attrs = unquote(v)
+		default:
+			keep = append(keep, kv)
+		}
+	}
+	if len(ports) > 1 && len(ports) != len(hosts) {
+		return nil, "", errors.New("database: DSN lists a different number of hosts and ports")
+	}
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	var out []string
+	for i, h := range hosts {
+		parts := append([]string(nil), keep...)
+		if h != "" {
+			parts = append(parts, "host="+h)
+		}
+		if len(ports) == 1 {
+			parts = append(parts, "port="+ports[0])
+		} else if len(ports) > 1 {
+			parts = append(parts, "port="+ports[i])
+		}
+		out = append(out, strings.Join(parts, " "))
+	}
+	return out, attrs, nil
+}
+
+// splitKeywords splits a key/value DSN into its key=value pairs, keeping
+// single-quoted values intact.
+func splitKeywords(dsn string) []string {
+	var out []string
+	var b strings.Builder
+	quoted, escaped := false, false
+	for _, r := range dsn {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '\'':
+			quoted = !quoted
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if b.Len() > 0 {
+				out = append(out, b.String())
+				b.Reset()
+			}
+			continue
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() > 0 {
+		out = append(out, b.String())
+	}
+	return out
+}
+
+func unquote(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'' {
+		v = strings.NewReplacer(`\'`, `'`, `\\`, `\`).Replace(v[1 : len(v)-1])
+	}
+	return v
+}
+
+// dsnWithParam adds a parameter to a URL or key/value DSN.
+func dsnWithParam(dsn, key, value string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		return dsn + sep + url.QueryEscape(key) + "=" + url.QueryEscape(value)
+	}
+	return dsn + " " + key + "=" + quoteDSNValue(value)
+}
+
+// quoteDSNValue quotes a key/value DSN value if it is empty or contains
+// spaces, quotes or backslashes.
+func quoteDSNValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, " \t\n\r'\\") {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
@@ -0,0 +1,28 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// QueryEvent describes an Exec or Query call, for metrics, logs and traces.
+// It carries the statement's text but never its arguments.
+type QueryEvent struct {
+	// Op is "Exec" or "Query".
+	Op          string
+	Query       string
+	Fingerprint string
+	Duration    time.Duration
+	// Err is the error the call returned, nil if it succeeded.
+	Err error
+	// Labels are the labels of the call's context, see WithLabel.
+	Labels map[string]string
+}
+
+// WithQueryObserver calls f after every Exec and Query, and so Get and
+// Select, e.g. to record a latency histogram per fingerprint and label. f
+// runs on the caller's goroutine and should be fast. It is a Hook with
+// only AfterQuery.
+func WithQueryObserver(f func(ctx context.Context, e QueryEvent)) Option {
+	return WithHook(HookFuncs{AfterQueryFunc: f})
+}
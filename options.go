@@ -0,0 +1,4 @@
+package database
+
+// Option configures a DB in Open and OpenDB.
+type Option func(*DB)
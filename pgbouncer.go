@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrPgBouncerUnsupported is returned in PgBouncer mode for statements and
+// features that need a session of their own, which a transaction-mode
+// pooler does not provide.
+var ErrPgBouncerUnsupported = errors.New("database: unsupported behind a transaction-mode pooler")
+
+// WithPgBouncerMode makes the DB work behind PgBouncer, or another pooler, in
+// transaction mode, where consecutive transactions may run on different
+// server sessions:
+//
+//   - the pgx driver's prepared-statement cache is disabled;
+//   - WithTimeout uses SET LOCAL, so it is confined to a transaction; an Exec
+//     with WithTimeout runs in a transaction of its own, and a Query or
+//     QueryRow with it outside a transaction fails;
+//   - WithCancelBackend is ignored, as the backend PID belongs to whichever
+//     session served the connection's first statement;
+//   - LISTEN, UNLISTEN, session-level SET, PREPARE and session-level advisory
+//     locks fail with ErrPgBouncerUnsupported. Use SET LOCAL and the
+//     pg_advisory_xact_lock family instead.
+func WithPgBouncerMode() Option {
+	return func(db *DB) {
+		db.pgBouncer = true
+		db.stmtHooks = append(db.stmtHooks, rejectSessionFeatures)
+	}
+}
+
+var (
+	sessionStatement = regexp.MustCompile(`(?i)^\s*(LISTEN|UNLISTEN|PREPARE|SET)\s+(\S+)`)
+	sessionLock      = regexp.MustCompile(`(?i)\bpg_(try_)?advisory_(un)?lock(_shared|_all)?\s*\(`)
+)
+
+func rejectSessionFeatures(ctx context.Context, query string) error {
+	if m := sessionStatement.FindStringSubmatch(query); m != nil {
+		if strings.EqualFold(m[1], "SET") && (strings.EqualFold(m[2], "LOCAL") || strings.EqualFold(m[2], "TRANSACTION")) {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrPgBouncerUnsupported, strings.ToUpper(m[1]))
+	}
+	if m := sessionLock.FindString(query); m != "" {
+		return fmt.Errorf("%w: session-level advisory lock %s", ErrPgBouncerUnsupported, strings.TrimRight(m, " ("))
+	}
+	return nil
+}
+
+// pgBouncerDSN disables the statement cache of drivers that have one.
+func pgBouncerDSN(driverName, dsn string) string {
+	if driverName != "pgx" {
+		return dsn
+	}
+	return dsnWithParam(dsn, "statement_cache_capacity", "0")
+}
@@ -0,0 +1,227 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// OpenPgx opens a DB backed by a pgx v5 pgxpool.Pool instead of a
+// database/sql driver pool. The DB works as one opened with Open, with the
+// connections checked out of the pgxpool, and additionally offers CopyFrom,
+// SendBatch and PgxPool for the pgx-native protocol features.
+func OpenPgx(ctx context.Context, config *pgxpool.Config, opts ...Option) (*DB, error) {
+	db := newDB(opts)
+	if db.tls != nil {
+		config = config.Copy()
+		if err := db.tls.applyPgx(config.ConnConfig); err != nil {
+			return nil, fmt.Errorf("OpenPgx(): %w", err)
+		}
+	}
+	if db.credentials != nil {
+		config = config.Copy()
+		before := config.BeforeConnect
+		config.BeforeConnect = func(ctx context.Context, cc *pgx.ConnConfig) error {
+			user, password, err := db.credentials.GetCredentials(ctx)
+			if err != nil {
+				return err
+			}
+			if user != "" {
+				cc.User = user
+			}
+			cc.Password = password
+			if before != nil {
+				return before(ctx, cc)
+			}
+			return nil
+		}
+	}
+	config = config.Copy()
+	if db.pgBouncer {
+		// A transaction-mode pooler may run each statement on a different
+		// server session, where a statement prepared on another does not
+		// exist.
+		config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+	}
+	// database/sql hands each connection back to the pgxpool when done, so
+	// the wrapper sees every checkout as a new connection; the sessions it
+	// already set up are remembered until the pgxpool closes them.
+	db.pgxSessions = &sync.Map{}
+	beforeClose := config.BeforeClose
+	config.BeforeClose = func(conn *pgx.Conn) {
+		db.pgxSessions.Delete(conn)
+		if beforeClose != nil {
+			beforeClose(conn)
+		}
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("OpenPgx(): %w", err)
+	}
+	db.pgxPool = pool
+	if _, err := db.open(sql.OpenDB(db.wrapConnector(stdlib.GetPoolConnector(pool)))); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("OpenPgx(): %w", err)
+	}
+	// The pgxpool does the pooling; database/sql returns each connection to
+	// it when done.
+	db.db.SetMaxOpenConns(int(pool.Config().MaxConns))
+	db.db.SetMaxIdleConns(0)
+	db.watchRotation()
+	return db, nil
+}
+
+// pgxSession returns the pgx connection behind conn, on a DB opened with
+// OpenPgx, and whether the wrapper already set up its session.
+func (db *DB) pgxSession(conn driver.Conn) (*pgx.Conn, bool) {
+	sc, ok := conn.(*stdlib.Conn)
+	if !ok || db.pgxSessions == nil {
+		return nil, false
+	}
+	_, seen := db.pgxSessions.Load(sc.Conn())
+	return sc.Conn(), seen
+}
+
+// releaseTimeout bounds restoring a session before it goes back to the
+// pgxpool.
+const releaseTimeout = time.Second
+
+// releasePooled prepares the pgxpool session of c for its next checkout.
+// A session that is poisoned, retired or cannot be restored in time is
+// closed instead, so the pgxpool discards it on release.
+func (c *wrappedConn) releasePooled() {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	if !c.poisoned && !c.retired() && c.restoreSession(ctx) == nil {
+		return
+	}
+	if sc, ok := c.Conn.(*stdlib.Conn); ok {
+		sc.Conn().Close(ctx)
+	}
+}
+
+// PgxPool returns the pgxpool.Pool of a DB opened with OpenPgx, nil
+// otherwise.
+func (db *DB) PgxPool() *pgxpool.Pool {
+	return db.pgxPool
+}
+
+// errNotPgx is returned by pgx-native methods on a DB not opened with OpenPgx.
+var errNotPgx = errors.New("database: DB was not opened with OpenPgx")
+
+// CopyFrom bulk-loads rows into table with the COPY protocol. In a
+// transaction it runs on the transaction's connection. Like any statement
+// it honors ForTenant and WithRLS.
+func (db *DB) CopyFrom(ctx context.Context, table pgx.Identifier, columns []string, src pgx.CopyFromSource) (n int64, err error) {
+	err = db.withPgxConn(ctx, []string{"COPY " + table.Sanitize() + " FROM STDIN"}, func(conn *pgx.Conn) error {
+		n, err = conn.CopyFrom(ctx, table, columns, src)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("CopyFrom(%s): %w", table.Sanitize(), err)
+	}
+	return n, nil
+}
+
+// SendBatch sends the queued queries in one round trip and runs their
+// callbacks. In a transaction it runs on the transaction's connection. Like
+// any statement they honor ForTenant and WithRLS.
+func (db *DB) SendBatch(ctx context.Context, b *pgx.Batch) error {
+	err := db.withPgxConn(ctx, batchQueries(b), func(conn *pgx.Conn) error {
+		return conn.SendBatch(ctx, b).Close()
+	})
+	if err != nil {
+		return fmt.Errorf("SendBatch(): %w", err)
+	}
+	return nil
+}
+
+// withPgxConn runs f with the pgx connection of the transaction or, outside
+// one, of a connection checked out through the DB's own pool, after setting
+// up its session as for any statement: queries, the statements f sends, are
+// checked against WithRLS, and the ForTenant search_path, call timeout and
+// statement hooks are applied. The session is restored before the
+// connection goes back to the pgxpool.
+func (db *DB) withPgxConn(ctx context.Context, queries []string, f func(*pgx.Conn) error) (err error) {
+	if db.pgxPool == nil {
+		return errNotPgx
+	}
+	ctx, end, err := db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { end(err) }()
+	conn := db.conn
+	if db.tx == nil {
+		if conn, err = db.db.Conn(ctx); err != nil {
+			return err
+		}
+		defer conn.Close()
+	}
+	return conn.Raw(func(dc interface{}) error {
+		wc, ok := dc.(*wrappedConn)
+		if !ok {
+			return errNotPgx
+		}
+		sc, ok := wc.Conn.(*stdlib.Conn)
+		if !ok {
+			return errNotPgx
+		}
+		for _, q := range queries {
+			if err := wc.checkRLS(ctx, q); err != nil {
+				return err
+			}
+		}
+		first := ""
+		if len(queries) > 0 {
+			first = queries[0]
+		}
+		if err := wc.before(ctx, first); err != nil {
+			return err
+		}
+		return f(sc.Conn())
+	})
+}
+
+// batchQueries returns the statements queued in b.
+func batchQueries(b *pgx.Batch) []string {
+	queries := make([]string, len(b.QueuedQueries))
+	for i, q := range b.QueuedQueries {
+		queries[i] = q.SQL
+	}
+	return queries
+}
+
+// applyPgx sets the TLS configuration of config and its fallback hosts,
+// dropping the fallbacks pgx adds to retry with other TLS settings.
+func (c *TLSConfig) applyPgx(config *pgx.ConnConfig) error {
+	tc, err := c.tlsConfig(config.Host)
+	if err != nil {
+		return err
+	}
+	config.TLSConfig = tc
+	seen := map[string]bool{fmt.Sprint(config.Host, config.Port): true}
+	var fallbacks []*pgconn.FallbackConfig
+	for _, fb := range config.Fallbacks {
+		key := fmt.Sprint(fb.Host, fb.Port)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if fb.TLSConfig, err = c.tlsConfig(fb.Host); err != nil {
+			return err
+		}
+		fallbacks = append(fallbacks, fb)
+	}
+	config.Fallbacks = fallbacks
+	return nil
+}
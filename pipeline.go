@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrPipelineAborted is the error of the statements of a pipeline after
+// one that failed; they were not run.
+var ErrPipelineAborted = errors.New("database: earlier pipeline statement failed")
+
+// Pipeline is a sequence of statements RunPipeline sends in one round trip,
+// for chatty transaction bodies whose statements do not need each other's
+// results in Go. A later statement can still use an earlier one's effects,
+// e.g. a row it inserted or currval.
+type Pipeline struct {
+	batch   pgx.Batch
+	results []*PipelineResult
+}
+
+// PipelineResult is the outcome of a pipelined statement, set once
+// RunPipeline returns.
+type PipelineResult struct {
+	RowsAffected int64
+	Err          error
+	dest         []interface{}
+}
+
+// Exec queues a statement.
+func (p *Pipeline) Exec(query string, args ...interface{}) *PipelineResult {
+	return p.queue(nil, query, args)
+}
+
+// QueryRow queues a query whose first row is scanned into dest. Its Err is
+// sql.ErrNoRows if there is no row.
+func (p *Pipeline) QueryRow(query string, args []interface{}, dest ...interface{}) *PipelineResult {
+	if dest == nil {
+		dest = []interface{}{}
+	}
+	return p.queue(dest, query, args)
+}
+
+func (p *Pipeline) queue(dest []interface{}, query string, args []interface{}) *PipelineResult {
+	r := &PipelineResult{dest: dest}
+	p.batch.Queue(query, args...)
+	p.results = append(p.results, r)
+	return r
+}
+
+// Len returns the number of queued statements.
+func (p *Pipeline) Len() int {
+	return len(p.results)
+}
+
+// RunPipeline sends the statements of p in one round trip and sets their
+// results. Outside a transaction they run in an implicit one, so a failing
+// statement rolls back the earlier ones; the statements after it are not
+// run and get ErrPipelineAborted. It returns the first error. It needs a
+// DB opened with OpenPgx.
+func (db *DB) RunPipeline(ctx context.Context, p *Pipeline) error {
+	err := db.withPgxConn(ctx, batchQueries(&p.batch), func(conn *pgx.Conn) error {
+		var first error
+		br := conn.SendBatch(ctx, &p.batch)
+		for i, r := range p.results {
+			if first != nil {
+				r.Err = ErrPipelineAborted
+				continue
+			}
+			if r.dest != nil {
+				r.Err = br.QueryRow().Scan(r.dest...)
+				if errors.Is(r.Err, pgx.ErrNoRows) {
+					r.Err = sql.ErrNoRows
+				}
+			} else {
+				var tag pgconn.CommandTag
+				tag, r.Err = br.Exec()
+				r.RowsAffected = tag.RowsAffected()
+			}
+			if r.Err != nil && r.Err != sql.ErrNoRows {
+				first = fmt.Errorf("statement %d: %w", i, r.Err)
+			}
+		}
+		if err := br.Close(); err != nil && first == nil {
+			first = err
+		}
+		return first
+	})
+	if err != nil {
+		return fmt.Errorf("RunPipeline(): %w", err)
+	}
+	return nil
+}
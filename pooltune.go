@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SetPoolLimits changes the pool's maximum open and idle connections at
+// runtime; zero or less for maxOpen means no limit. A DB opened with OpenPgx
+// is limited by its pgxpool's MaxConns as well.
+func (db *DB) SetPoolLimits(maxOpen, maxIdle int) {
+	db.db.SetMaxOpenConns(maxOpen)
+	db.db.SetMaxIdleConns(maxIdle)
+}
+
+type PoolTunerConfig struct {
+	// Min and Max bound the maximum open connections the tuner sets.
+	// Default to 5 and 100.
+	Min, Max int
+	// Step is how many connections the limit changes by at a time. Defaults
+	// to 5.
+	Step int
+	// Interval between adjustments. Defaults to 10 seconds.
+	Interval time.Duration
+	// TargetWait is the mean time callers may wait for a connection before
+	// the limit is raised. Defaults to 5 milliseconds.
+	TargetWait time.Duration
+	// OnResize is called after the limit changes.
+	OnResize func(oldMax, newMax int)
+}
+
+// PoolTuner adjusts a pool's limits from its wait metrics: it raises the
+// maximum open connections while callers wait longer than TargetWait for a
+// saturated pool, and lowers it while fewer than half the connections are in
+// use and nobody waits. Idle connections are allowed up to the maximum,
+// except on a DB opened with OpenPgx: its pgxpool holds the idle
+// connections, and its MaxConns bounds the maximum.
+type PoolTuner struct {
+	db     *DB
+	cfg    PoolTunerConfig
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// StartPoolTuner starts adjusting the pool every cfg.Interval until Stop is
+// called. OnResize runs on the tuner goroutine.
+func (db *DB) StartPoolTuner(cfg PoolTunerConfig) *PoolTuner {
+	if cfg.Min <= 0 {
+		cfg.Min = 5
+	}
+	if cfg.Max <= 0 {
+		cfg.Max = 100
+	}
+	if cfg.Step <= 0 {
+		cfg.Step = 5
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.TargetWait <= 0 {
+		cfg.TargetWait = 5 * time.Millisecond
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &PoolTuner{db: db, cfg: cfg, cancel: cancel, done: make(chan struct{})}
+	go t.run(ctx)
+	return t
+}
+
+// Stop stops the tuner. The pool keeps its last limits.
+func (t *PoolTuner) Stop() {
+	t.cancel()
+	<-t.done
+}
+
+func (t *PoolTuner) run(ctx context.Context) {
+	defer close(t.done)
+	tick := time.NewTicker(t.cfg.Interval)
+	defer tick.Stop()
+	prev := t.db.db.Stats()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		cur := t.db.db.Stats()
+		t.adjust(prev, cur)
+		prev = cur
+	}
+}
+
+func (t *PoolTuner) adjust(prev, cur sql.DBStats) {
+	max := cur.MaxOpenConnections
+	if max <= 0 {
+		// Unlimited; start from the current size.
+		max = cur.OpenConnections
+	}
+	waits := cur.WaitCount - prev.WaitCount
+	next := max
+	switch {
+	case waits > 0 && (cur.WaitDuration-prev.WaitDuration)/time.Duration(waits) > t.cfg.TargetWait:
+		next = max + t.cfg.Step
+	case waits == 0 && cur.InUse < max/2:
+		next = max - t.cfg.Step
+	}
+	if next > t.cfg.Max {
+		next = t.cfg.Max
+	}
+	if next < t.cfg.Min {
+		next = t.cfg.Min
+	}
+	idle := next
+	if pool := t.db.pgxPool; pool != nil {
+		// The pgxpool keeps the idle connections and caps the open ones.
+		idle = 0
+		if pm := int(pool.Config().MaxConns); next > pm {
+			next = pm
+		}
+	}
+	if next == cur.MaxOpenConnections {
+		return
+	}
+	t.db.SetPoolLimits(next, idle)
+	if t.cfg.OnResize != nil {
+		t.cfg.OnResize(cur.MaxOpenConnections, next)
+	}
+}
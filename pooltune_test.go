@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestPoolTunerAdjust(t *testing.T) {
+	sqldb := sql.OpenDB(failConnector{errors.New("no connections")})
+	defer sqldb.Close()
+	db := &DB{db: sqldb}
+	var resized []int
+	tuner := &PoolTuner{db: db, cfg: PoolTunerConfig{Min: 5, Max: 100, Step: 5, TargetWait: 1, OnResize: func(_, n int) { resized = append(resized, n) }}}
+	waiting := func(max int) (sql.DBStats, sql.DBStats) {
+		return sql.DBStats{MaxOpenConnections: max}, sql.DBStats{MaxOpenConnections: max, InUse: max, WaitCount: 1, WaitDuration: 10}
+	}
+
+	sqldb.SetMaxOpenConns(10)
+	tuner.adjust(waiting(10))
+	if s := sqldb.Stats(); s.MaxOpenConnections != 15 {
+		t.Errorf("MaxOpenConnections = %d after waits, want 15", s.MaxOpenConnections)
+	}
+	tuner.adjust(sql.DBStats{MaxOpenConnections: 15}, sql.DBStats{MaxOpenConnections: 15, InUse: 2})
+	if s := sqldb.Stats(); s.MaxOpenConnections != 10 {
+		t.Errorf("MaxOpenConnections = %d when mostly unused, want 10", s.MaxOpenConnections)
+	}
+
+	// A DB opened with OpenPgx never goes past its pgxpool's MaxConns.
+	config, err := pgxpool.ParseConfig("postgres://localhost/test?pool_max_conns=12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	db.pgxPool = pool
+	tuner.adjust(waiting(10))
+	tuner.adjust(waiting(12))
+	if len(resized) != 3 || resized[2] != 12 {
+		t.Errorf("resized to %v, want to stop at MaxConns 12", resized)
+	}
+	if n := sqldb.Stats().MaxOpenConnections; n != 12 {
+		t.Errorf("MaxOpenConnections = %d, want 12", n)
+	}
+}
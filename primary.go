@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ErrNotPrimary is returned for a write on a server in recovery, i.e. a
+// standby, when WithRequirePrimary is set.
+var ErrNotPrimary = errors.New("database: server is not the primary")
+
+// WithRequirePrimary makes Exec, read-write transactions and the Query and
+// QueryRow of writes, e.g. INSERT ... RETURNING or SELECT ... FOR UPDATE,
+// check that the connection they check out is to a primary, with
+// pg_is_in_recovery(), and fail with ErrNotPrimary otherwise so callers can
+// re-route the write instead of getting an opaque read-only error from the
+// server.
+func WithRequirePrimary() Option {
+	return func(db *DB) {
+		db.requirePrimary = true
+	}
+}
+
+// IsPrimary reports whether the server is a primary rather than a standby.
+func (db *DB) IsPrimary(ctx context.Context) (bool, error) {
+	var recovery bool
+	if err := db.QueryRow(ctx, "SELECT pg_is_in_recovery()").Scan(&recovery); err != nil {
+		return false, fmt.Errorf("IsPrimary(): %w", err)
+	}
+	return !recovery, nil
+}
+
+type writeKey struct{}
+
+// writeContext marks ctx as the context of a write when db requires one to
+// go to a primary.
+func (db *DB) writeContext(ctx context.Context) context.Context {
+	if !db.requirePrimary || db.tx != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, writeKey{}, true)
+}
+
+// writeStatement matches the queries that write: data-modifying statements,
+// also in a WITH or after leading comments, and row locks.
+var writeStatement = regexp.MustCompile(`(?is)^(\s|/\*.*?\*/|--[^\n]*\n)*(INSERT|UPDATE|DELETE|MERGE)\b` +
+	`|^(\s|/\*.*?\*/|--[^\n]*\n)*WITH\b.*\b(INSERT\s+INTO|UPDATE\s+\S+\s+SET|DELETE\s+FROM|MERGE\s+INTO)\b` +
+	`|\bFOR\s+(NO\s+KEY\s+UPDATE|UPDATE|KEY\s+SHARE|SHARE)\b`)
+
+// queryWriteContext is writeContext for a Query or QueryRow, which only
+// writes if its statement does.
+func (db *DB) queryWriteContext(ctx context.Context, query string) context.Context {
+	if !db.requirePrimary || db.tx != nil || !writeStatement.MatchString(query) {
+		return ctx
+	}
+	return db.writeContext(ctx)
+}
+
+// verifyPrimary checks that the connection is to a primary, once per
+// checkout, if ctx is a write's.
+func (c *wrappedConn) verifyPrimary(ctx context.Context) error {
+	if c.primaryChecked || ctx.Value(writeKey{}) == nil {
+		return nil
+	}
+	v, err := connValue(ctx, c.Conn, "SELECT pg_is_in_recovery()")
+	if err != nil {
+		return err
+	}
+	if isTrue(v) {
+		c.observe(ErrNotPrimary)
+		return ErrNotPrimary
+	}
+	c.primaryChecked = true
+	return nil
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// WithProfilerLabels runs Exec, Query and Transaction, and so Get, Select
+// and the helpers built on them, under pprof labels, so CPU and goroutine
+// profiles attribute the time spent in and waiting on the database to
+// statements: "db.op" is "Exec", "Query" or "Transaction" and
+// "db.fingerprint" the statement's Fingerprint. The labels of WithLabel are
+// added as well. Goroutines started meanwhile inherit the labels.
+func WithProfilerLabels() Option {
+	return func(db *DB) {
+		db.profilerLabels = true
+	}
+}
+
+// profile runs f under the pprof labels of op and query, if enabled.
+func (db *DB) profile(ctx context.Context, op, query string, f func(ctx context.Context)) {
+	if !db.profilerLabels {
+		f(ctx)
+		return
+	}
+	labels := []string{"db.op", op}
+	if query != "" {
+		labels = append(labels, "db.fingerprint", Fingerprint(query))
+	}
+	for k, v := range Labels(ctx) {
+		labels = append(labels, k, v)
+	}
+	pprof.Do(ctx, pprof.Labels(labels...), f)
+}
@@ -0,0 +1,20 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Querier is the query API shared by a DB and the transaction-bound *DB that
+// Transaction passes to its callback. Application code can depend on it and
+// substitute a fake in unit tests.
+type Querier interface {
+	Exec(ctx context.Context, query string, args ...interface{}) (int64, error)
+	Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row
+	Get(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	Select(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	Transaction(ctx context.Context, iso sql.IsolationLevel, f func(*DB) error) error
+}
+
+var _ Querier = (*DB)(nil)
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// QueryError is the error of an Exec or Query (and so Get and Select). It
+// identifies the statement by its fingerprint, never by its text or
+// arguments, so it is safe to log and expose. It unwraps to the driver's
+// error.
+type QueryError struct {
+	// Op is "Exec" or "Query".
+	Op string
+	// Fingerprint identifies the statement, see Fingerprint.
+	Fingerprint string
+	// Duration is how long the call took.
+	Duration time.Duration
+	// Attempt is the attempt of the retried transaction the call ran in, 1
+	// outside of retries.
+	Attempt int
+	// Labels are the labels of the call's context, see WithLabel.
+	Labels map[string]string
+	Err    error
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s(%s, %v, attempt %d): %v", e.Op, e.Fingerprint, e.Duration.Round(time.Microsecond), e.Attempt, e.Err)
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	stringLiteral  = regexp.MustCompile(`(?s)'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	whitespace     = regexp.MustCompile(`\s+`)
+)
+
+// Fingerprint returns a short hash of query with its literals and layout
+// normalized away, so the same statement with different values or
+// formatting has the same fingerprint.
+func Fingerprint(query string) string {
+	q := stringLiteral.ReplaceAllLiteralString(query, "?")
+	q = numericLiteral.ReplaceAllLiteralString(q, "?")
+	q = strings.ToLower(strings.TrimSpace(whitespace.ReplaceAllLiteralString(q, " ")))
+	h := sha256.Sum256([]byte(q))
+	return hex.EncodeToString(h[:8])
+}
+
+type attemptKey struct{}
+
+func attemptFrom(ctx context.Context) int {
+	if n, ok := ctx.Value(attemptKey{}).(int); ok {
+		return n
+	}
+	return 1
+}
+
+// queryError wraps a non-nil err of op in a *QueryError.
+func queryError(ctx context.Context, op, query string, start time.Time, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &QueryError{Op: op, Fingerprint: Fingerprint(query), Duration: time.Since(start), Attempt: attemptFrom(ctx), Labels: Labels(ctx), Err: err}
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// QueryStat is the in-process statistics of the statements with one
+// fingerprint since the DB was opened. The percentiles come from a
+// histogram whose buckets are 20% apart, so they are accurate to within
+// 20%.
+type QueryStat struct {
+	Fingerprint string `json:"fingerprint"`
+	// Query is the text of the first statement seen with the fingerprint.
+	// Arguments are never part of it, but the literals of a statement that
+	// inlines its values rather than using placeholders are kept as they
+	// are, and QueryStatsHandler serves them.
+	Query  string `json:"query"`
+	Count  int64  `json:"count"`
+	Errors int64  `json:"errors"`
+	// Total is the time spent in the statements.
+	Total time.Duration `json:"total_ns"`
+	Max   time.Duration `json:"max_ns"`
+	P50   time.Duration `json:"p50_ns"`
+	P95   time.Duration `json:"p95_ns"`
+	P99   time.Duration `json:"p99_ns"`
+}
+
+// ErrorRate returns the fraction of the statements that failed.
+func (s QueryStat) ErrorRate() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Count)
+}
+
+// Mean returns the mean duration of the statements.
+func (s QueryStat) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// WithQueryStats keeps statistics of every Exec and Query, and so Get and
+// Select, by fingerprint, for QueryStats. A Query's duration ends when its
+// first rows are ready, before they are read. At most 1000 fingerprints are
+// tracked; statements of further ones are not counted.
+func WithQueryStats() Option {
+	return func(db *DB) {
+		if db.stats != nil {
+			return
+		}
+		db.stats = &queryStats{m: make(map[string]*queryStat)}
+		WithHook(HookFuncs{AfterQueryFunc: db.stats.record})(db)
+	}
+}
+
+// QueryStats returns the statistics of WithQueryStats, the statements
+// taking the most time in total first, e.g. to find the queries that got
+// slow after a deploy. It returns nil without WithQueryStats.
+func (db *DB) QueryStats() []QueryStat {
+	if db.stats == nil {
+		return nil
+	}
+	return db.stats.snapshot()
+}
+
+const (
+	maxStatsFingerprints = 1000
+
+	histogramBuckets = 120
+	histogramBase    = 10 * time.Microsecond
+	histogramFactor  = 1.2
+)
+
+type queryStats struct {
+	mu sync.Mutex
+	m  map[string]*queryStat
+}
+
+type queryStat struct {
+	QueryStat
+	buckets [histogramBuckets]int64
+}
+
+func (s *queryStats) record(_ context.Context, e QueryEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.m[e.Fingerprint]
+	if st == nil {
+		if len(s.m) >= maxStatsFingerprints {
+			return
+		}
+		st = &queryStat{QueryStat: QueryStat{Fingerprint: e.Fingerprint, Query: e.Query}}
+		s.m[e.Fingerprint] = st
+	}
+	st.Count++
+	if e.Err != nil {
+		st.Errors++
+	}
+	st.Total += e.Duration
+	if e.Duration > st.Max {
+		st.Max = e.Duration
+	}
+	st.buckets[bucket(e.Duration)]++
+}
+
+func (s *queryStats) snapshot() []QueryStat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make([]QueryStat, 0, len(s.m))
+	for _, st := range s.m {
+		qs := st.QueryStat
+		qs.P50, qs.P95, qs.P99 = st.percentile(0.5), st.percentile(0.95), st.percentile(0.99)
+		stats = append(stats, qs)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Total > stats[j].Total })
+	return stats
+}
+
+// percentile returns the upper bound of the bucket holding the q-th
+// quantile, capped at Max.
+func (st *queryStat) percentile(q float64) time.Duration {
+	rank := int64(math.Ceil(q * float64(st.Count)))
+	var n int64
+	for i, c := range st.buckets {
+		n += c
+		if n >= rank {
+			d := time.Duration(float64(histogramBase) * math.Pow(histogramFactor, float64(i)))
+			if d > st.Max {
+				d = st.Max
+			}
+			return d
+		}
+	}
+	return st.Max
+}
+
+// bucket returns the histogram bucket of d, the first whose upper bound
+// is at least d.
+func bucket(d time.Duration) int {
+	if d <= histogramBase {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(float64(d)/float64(histogramBase)) / math.Log(histogramFactor)))
+	if i >= histogramBuckets {
+		i = histogramBuckets - 1
+	}
+	return i
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	for _, c := range []struct {
+		d    time.Duration
+		want int
+	}{
+		{0, 0},
+		{time.Microsecond, 0},
+		{histogramBase, 0},
+		{11 * time.Microsecond, 1},
+		{13 * time.Microsecond, 2},
+		{time.Millisecond, 26},
+		{time.Second, 64},
+		{24 * time.Hour, histogramBuckets - 1},
+	} {
+		if got := bucket(c.d); got != c.want {
+			t.Errorf("bucket(%v) = %d, want %d", c.d, got, c.want)
+		}
+	}
+}
+
+func TestBucketBounds(t *testing.T) {
+	bound := func(i int) time.Duration {
+		return time.Duration(float64(histogramBase) * math.Pow(histogramFactor, float64(i)))
+	}
+	for d := histogramBase + 1; d < 10*time.Second; d = d*3/2 + 7 {
+		i := bucket(d)
+		if bound(i) < d || bound(i-1) >= d {
+			t.Errorf("bucket(%v) = %d, bounds (%v, %v]", d, i, bound(i-1), bound(i))
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var s queryStats
+	s.m = make(map[string]*queryStat)
+	record := func(n int, d time.Duration) {
+		for i := 0; i < n; i++ {
+			s.record(context.Background(), QueryEvent{Fingerprint: "fp", Duration: d})
+		}
+	}
+	if got := (&queryStat{}).percentile(0.5); got != 0 {
+		t.Errorf("percentile of no statements = %v, want 0", got)
+	}
+	record(90, time.Millisecond)
+	record(6, 10*time.Millisecond)
+	record(4, 100*time.Millisecond)
+	st := s.m["fp"]
+	for _, c := range []struct {
+		q        float64
+		min, max time.Duration
+	}{
+		{0.5, time.Millisecond, 1200 * time.Microsecond},
+		{0.9, time.Millisecond, 1200 * time.Microsecond},
+		{0.95, 10 * time.Millisecond, 12 * time.Millisecond},
+		// The bucket's bound is above the slowest statement, so Max is used.
+		{0.99, 100 * time.Millisecond, 100 * time.Millisecond},
+	} {
+		if got := st.percentile(c.q); got < c.min || got > c.max {
+			t.Errorf("percentile(%v) = %v, want in [%v, %v]", c.q, got, c.min, c.max)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when an operation exceeds a rate limit and
+// either WithRateLimitNoWait is set or the context deadline would pass
+// before the operation is allowed.
+var ErrRateLimited = errors.New("database: rate limited")
+
+type workloadKey struct{}
+
+// WithWorkload returns a context whose operations belong to the named
+// workload class, selecting its rate limit and concurrency limit.
+func WithWorkload(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, workloadKey{}, name)
+}
+
+func workloadFrom(ctx context.Context) string {
+	name, _ := ctx.Value(workloadKey{}).(string)
+	return name
+}
+
+// WithRateLimit limits all top-level operations to rps per second, allowing
+// bursts of up to burst operations. Over-limit callers wait until allowed or
+// until their context is done.
+func WithRateLimit(rps float64, burst int) Option {
+	return func(db *DB) {
+		db.rateLimiter().global = newTokenBucket(rps, burst)
+	}
+}
+
+// WithWorkloadRateLimit limits operations of the workload (see WithWorkload)
+// to rps per second with the given burst, in addition to any global limit.
+func WithWorkloadRateLimit(workload string, rps float64, burst int) Option {
+	return func(db *DB) {
+		db.rateLimiter().workloads[workload] = newTokenBucket(rps, burst)
+	}
+}
+
+// WithRateLimitNoWait makes over-limit operations fail immediately with
+// ErrRateLimited instead of waiting.
+func WithRateLimitNoWait() Option {
+	return func(db *DB) {
+		db.rateLimiter().noWait = true
+	}
+}
+
+func (db *DB) rateLimiter() *rateLimiter {
+	if db.limiter == nil {
+		db.limiter = &rateLimiter{workloads: make(map[string]*tokenBucket)}
+		db.guards = append(db.guards, db.limiter)
+	}
+	return db.limiter
+}
+
+type rateLimiter struct {
+	global    *tokenBucket
+	workloads map[string]*tokenBucket
+	noWait    bool
+}
+
+func (l *rateLimiter) enter(ctx context.Context) (context.Context, func(error), error) {
+	if l.global != nil {
+		if err := l.wait(ctx, l.global); err != nil {
+			return ctx, nil, err
+		}
+	}
+	if b := l.workloads[workloadFrom(ctx)]; b != nil {
+		if err := l.wait(ctx, b); err != nil {
+			return ctx, nil, err
+		}
+	}
+	return ctx, func(error) {}, nil
+}
+
+func (l *rateLimiter) wait(ctx context.Context, b *tokenBucket) error {
+	d := b.reserve(time.Now())
+	if d <= 0 {
+		return nil
+	}
+	if l.noWait {
+		b.cancel()
+		return ErrRateLimited
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		b.cancel()
+		return ErrRateLimited
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
+
+// tokenBucket refills at rate tokens per second up to burst. Tokens may go
+// negative: each reservation queues behind the earlier ones.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rps float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rps, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// reserve takes a token and returns how long to wait before using it.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate <= 0 {
+		return 0
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns a reserved token that will not be used.
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	b.tokens++
+	b.mu.Unlock()
+}
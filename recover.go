@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// WithOnRollbackError calls f when rolling back a transaction fails, e.g.
+// to log it; the connection is then discarded rather than returned to the
+// pool. The error is also joined to the one Transaction returns. f runs
+// with the transaction's context.
+func WithOnRollbackError(f func(ctx context.Context, err error)) Option {
+	return func(db *DB) {
+		db.onRollbackError = append(db.onRollbackError, f)
+	}
+}
+
+// WithRecoverPanics makes Transaction recover a panic in its callback,
+// after rolling back, and return it as a *PanicError instead of panicking
+// again.
+func WithRecoverPanics() Option {
+	return func(db *DB) {
+		db.recoverPanics = true
+	}
+}
+
+// PanicError is a panic recovered from a Transaction callback.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n\n%s", e.Value, e.Stack)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
@@ -0,0 +1,364 @@
+// Package replaydb records the queries a test sends to a real database and
+// replays the recorded results later without one.
+//
+// Record a tape once against a live server:
+//
+//	db := replaydb.Record(t, "postgres", dsn, "testdata/users.json")
+//
+// then switch the test to serve it offline:
+//
+//	db := replaydb.Replay(t, "testdata/users.json")
+//
+// Replay matches statements by query text and arguments. Repeated identical
+// statements get their recorded results in order, the last one repeating.
+package replaydb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkrypt0987/database"
+)
+
+// entry is one recorded statement and its outcome.
+type entry struct {
+	Query        string    `json:"query"`
+	Args         []value   `json:"args"`
+	Columns      []string  `json:"columns,omitempty"`
+	Rows         [][]value `json:"rows,omitempty"`
+	RowsAffected int64     `json:"rows_affected,omitempty"`
+	Err          string    `json:"error,omitempty"`
+}
+
+// value is a driver.Value with its type kept through JSON.
+type value struct {
+	Type  string `json:"t"`
+	Value string `json:"v,omitempty"`
+}
+
+func encodeValue(v driver.Value) value {
+	switch v := v.(type) {
+	case nil:
+		return value{Type: "null"}
+	case int64:
+		return value{Type: "int64", Value: fmt.Sprint(v)}
+	case float64:
+		return value{Type: "float64", Value: fmt.Sprint(v)}
+	case bool:
+		return value{Type: "bool", Value: fmt.Sprint(v)}
+	case []byte:
+		return value{Type: "bytes", Value: base64.StdEncoding.EncodeToString(v)}
+	case string:
+		return value{Type: "string", Value: v}
+	case time.Time:
+		return value{Type: "time", Value: v.Format(time.RFC3339Nano)}
+	}
+	return value{Type: "string", Value: fmt.Sprint(v)}
+}
+
+func decodeValue(v value) (driver.Value, error) {
+	switch v.Type {
+	case "null":
+		return nil, nil
+	case "int64":
+		var n int64
+		_, err := fmt.Sscan(v.Value, &n)
+		return n, err
+	case "float64":
+		var f float64
+		_, err := fmt.Sscan(v.Value, &f)
+		return f, err
+	case "bool":
+		return v.Value == "true", nil
+	case "bytes":
+		return base64.StdEncoding.DecodeString(v.Value)
+	case "string":
+		return v.Value, nil
+	case "time":
+		return time.Parse(time.RFC3339Nano, v.Value)
+	}
+	return nil, fmt.Errorf("replaydb: unknown value type %q", v.Type)
+}
+
+func entryKey(query string, args []driver.NamedValue) ([]value, string) {
+	vs := make([]value, len(args))
+	for i, a := range args {
+		vs[i] = encodeValue(a.Value)
+	}
+	b, _ := json.Marshal(vs)
+	return vs, query + "\x00" + string(b)
+}
+
+// Record returns a DB connected to dataSourceName through driverName that
+// writes every statement and result to file when the test ends.
+func Record(t testing.TB, driverName, dataSourceName, file string) *database.DB {
+	t.Helper()
+	sqldb, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		t.Fatalf("replaydb.Record(): %v", err)
+	}
+	drv := sqldb.Driver()
+	sqldb.Close()
+
+	rec := &recorder{drv: drv, dsn: dataSourceName}
+	db, err := database.OpenDB(rec)
+	if err != nil {
+		t.Fatalf("replaydb.Record(): %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if err := rec.save(file); err != nil {
+			t.Errorf("replaydb.Record(): %v", err)
+		}
+	})
+	return db
+}
+
+type recorder struct {
+	drv driver.Driver
+	dsn string
+
+	mu      sync.Mutex
+	entries []entry
+}
+
+func (r *recorder) Connect(ctx context.Context) (driver.Conn, error) {
+	c, err := r.drv.Open(r.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &recordConn{Conn: c, r: r}, nil
+}
+
+func (r *recorder) Driver() driver.Driver { return r.drv }
+
+func (r *recorder) add(e entry) {
+	r.mu.Lock()
+	r.entries = append(r.entries, e)
+	r.mu.Unlock()
+}
+
+func (r *recorder) save(file string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, err := json.MarshalIndent(r.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, b, 0o644)
+}
+
+type recordConn struct {
+	driver.Conn
+	r *recorder
+}
+
+func (c *recordConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *recordConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *recordConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if ch, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return ch.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// ExecContext and QueryContext return driver.ErrSkip for drivers without
+// the context interfaces, for database/sql to fall back on a prepared
+// statement, which is not recorded.
+func (c *recordConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ex, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	e := entry{Query: query}
+	e.Args, _ = entryKey(query, args)
+	res, err := ex.ExecContext(ctx, query, args)
+	if err != nil {
+		e.Err = err.Error()
+		c.r.add(e)
+		return nil, err
+	}
+	e.RowsAffected, _ = res.RowsAffected()
+	c.r.add(e)
+	return res, nil
+}
+
+func (c *recordConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	e := entry{Query: query}
+	e.Args, _ = entryKey(query, args)
+	rs, err := q.QueryContext(ctx, query, args)
+	if err != nil {
+		e.Err = err.Error()
+		c.r.add(e)
+		return nil, err
+	}
+	defer rs.Close()
+	e.Columns = rs.Columns()
+	out := &rows{columns: e.Columns}
+	for {
+		dest := make([]driver.Value, len(e.Columns))
+		if err := rs.Next(dest); err == io.EOF {
+			break
+		} else if err != nil {
+			e.Err = err.Error()
+			c.r.add(e)
+			return nil, err
+		}
+		row := make([]value, len(dest))
+		for i, v := range dest {
+			// Drivers may reuse dest buffers between rows.
+			if b, ok := v.([]byte); ok {
+				dest[i] = append([]byte(nil), b...)
+			}
+			row[i] = encodeValue(dest[i])
+		}
+		e.Rows = append(e.Rows, row)
+		out.rows = append(out.rows, dest)
+	}
+	c.r.add(e)
+	return out, nil
+}
+
+// Replay returns a DB that serves the statements recorded in file.
+func Replay(t testing.TB, file string) *database.DB {
+	t.Helper()
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("replaydb.Replay(): %v", err)
+	}
+	var entries []entry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		t.Fatalf("replaydb.Replay(): %s: %v", file, err)
+	}
+	p := &player{byKey: make(map[string][]*entry)}
+	for i := range entries {
+		e := &entries[i]
+		if e.Args == nil {
+			e.Args = []value{}
+		}
+		bk, _ := json.Marshal(e.Args)
+		key := e.Query + "\x00" + string(bk)
+		p.byKey[key] = append(p.byKey[key], e)
+	}
+	db, err := database.OpenDB(p)
+	if err != nil {
+		t.Fatalf("replaydb.Replay(): %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+type player struct {
+	mu    sync.Mutex
+	byKey map[string][]*entry
+}
+
+func (p *player) Connect(context.Context) (driver.Conn, error) { return &replayConn{p: p}, nil }
+func (p *player) Driver() driver.Driver                        { return p }
+func (p *player) Open(string) (driver.Conn, error)             { return &replayConn{p: p}, nil }
+
+// next returns the next recorded entry for the statement.
+func (p *player) next(query string, args []driver.NamedValue) (*entry, error) {
+	_, key := entryKey(query, args)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	es := p.byKey[key]
+	if len(es) == 0 {
+		return nil, fmt.Errorf("replaydb: no recording for query %q", query)
+	}
+	e := es[0]
+	if len(es) > 1 {
+		p.byKey[key] = es[1:]
+	}
+	if e.Err != "" {
+		return nil, errors.New(e.Err)
+	}
+	return e, nil
+}
+
+type replayConn struct{ p *player }
+
+func (c *replayConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("replaydb: prepared statements are not supported")
+}
+func (c *replayConn) Close() error              { return nil }
+func (c *replayConn) Begin() (driver.Tx, error) { return replayTx{}, nil }
+
+func (c *replayConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return replayTx{}, nil
+}
+
+func (c *replayConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, err := c.p.next(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(e.RowsAffected), nil
+}
+
+func (c *replayConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	e, err := c.p.next(query, args)
+	if err != nil {
+		return nil, err
+	}
+	out := &rows{columns: e.Columns}
+	for _, r := range e.Rows {
+		row := make([]driver.Value, len(r))
+		for i, v := range r {
+			if row[i], err = decodeValue(v); err != nil {
+				return nil, err
+			}
+		}
+		out.rows = append(out.rows, row)
+	}
+	return out, nil
+}
+
+type replayTx struct{}
+
+func (replayTx) Commit() error   { return nil }
+func (replayTx) Rollback() error { return nil }
+
+type rows struct {
+	columns []string
+	rows    [][]driver.Value
+	pos     int
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RetryPolicy says how often Transaction retries a transaction that failed
+// with an error the dialect considers retryable, such as a serialization
+// failure.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, the first included; 1 or less
+	// never retries.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled for each further
+	// one. Defaults to 150ms.
+	Backoff time.Duration
+}
+
+// defaultRetryPolicies apply to isolation levels without a WithRetryPolicy.
+// Serialization failures only occur at REPEATABLE READ and above.
+var defaultRetryPolicies = map[sql.IsolationLevel]RetryPolicy{
+	sql.LevelRepeatableRead: {MaxAttempts: 3},
+	sql.LevelSerializable:   {MaxAttempts: 3},
+}
+
+// WithRetryPolicy sets the retry policy of transactions at level, replacing
+// the default of 3 attempts for RepeatableRead and Serializable and none
+// for the others.
+func WithRetryPolicy(level sql.IsolationLevel, p RetryPolicy) Option {
+	return func(db *DB) {
+		if db.retryPolicies == nil {
+			db.retryPolicies = map[sql.IsolationLevel]RetryPolicy{}
+		}
+		db.retryPolicies[level] = p
+	}
+}
+
+// retryPolicy returns the retry policy for level, ok false if transactions
+// at level are not retried.
+func (db *DB) retryPolicy(level sql.IsolationLevel) (p RetryPolicy, ok bool) {
+	p, ok = db.retryPolicies[level]
+	if !ok {
+		p, ok = defaultRetryPolicies[level]
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = 150 * time.Millisecond
+	}
+	return p, ok && p.MaxAttempts > 1
+}
+
+// ErrRetryBudgetExhausted is matched by the error of a transaction that
+// failed every attempt its RetryPolicy allowed, or that would have been
+// retried but whose context deadline would pass before the next attempt.
+var ErrRetryBudgetExhausted = errors.New("database: retry budget exhausted")
+
+// RetryError is the error of a transaction that was attempted more than
+// once. It unwraps to the last attempt's error and, if it stopped retrying
+// a retryable error, to the reason: ErrRetryBudgetExhausted if it gave up,
+// or the context's error if the caller cancelled.
+type RetryError struct {
+	// Attempts is the number of attempts made.
+	Attempts int
+	// Elapsed is the time spent on all attempts and the waits between them.
+	Elapsed time.Duration
+	// Err is the error of the last attempt.
+	Err error
+
+	reason error
+}
+
+func (e *RetryError) Error() string {
+	msg := fmt.Sprintf("after %d attempts in %v: %v", e.Attempts, e.Elapsed.Round(time.Millisecond), e.Err)
+	if e.reason != nil {
+		return fmt.Sprintf("%v %s", e.reason, msg)
+	}
+	return msg
+}
+
+func (e *RetryError) Unwrap() []error {
+	if e.reason == nil {
+		return []error{e.Err}
+	}
+	return []error{e.reason, e.Err}
+}
+
+// Retryable reports whether an operation that failed with err may succeed
+// if run again: after a serialization failure or deadlock, or a transient
+// connection failure such as a failover. Transaction retries the first two
+// itself; it is for retry loops outside of it. A write that failed with a
+// connection error may still have been applied, so only retry it if it is
+// idempotent.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrRetryBudgetExhausted) {
+		return false
+	}
+	return Postgres.IsRetryable(err) || isFailover(err)
+}
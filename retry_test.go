@@ -0,0 +1,121 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkrypt0987/database"
+	"github.com/pkrypt0987/database/fakedb"
+)
+
+var errSerialization = &pq.Error{Code: "40001", Message: "could not serialize access"}
+
+func TestTransactionRetryStopsBeforeDeadline(t *testing.T) {
+	db := fakedb.New().DB(t, database.WithRetryPolicy(sql.LevelDefault, database.RetryPolicy{MaxAttempts: 5, Backoff: time.Second}))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	attempts := 0
+	start := time.Now()
+	err := db.Transaction(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		attempts++
+		return errSerialization
+	})
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("took %v; the backoff would pass the deadline and should not be slept", elapsed)
+	}
+	if attempts != 1 {
+		t.Errorf("%d attempts, want 1", attempts)
+	}
+	if !errors.Is(err, database.ErrRetryBudgetExhausted) {
+		t.Errorf("err = %v, want ErrRetryBudgetExhausted", err)
+	}
+}
+
+func TestTransactionRetryPolicy(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		opts     []database.Option
+		iso      sql.IsolationLevel
+		failures int
+		attempts int
+		wantErr  bool
+	}{
+		{"default level is not retried", nil, sql.LevelDefault, 1, 1, true},
+		{"serializable succeeds on the last attempt", nil, sql.LevelSerializable, 2, 3, false},
+		{"serializable gives up after MaxAttempts", nil, sql.LevelSerializable, 5, 3, true},
+		{"policy for the default level", []database.Option{database.WithRetryPolicy(sql.LevelDefault, database.RetryPolicy{MaxAttempts: 4, Backoff: time.Millisecond})}, sql.LevelDefault, 3, 4, false},
+		{"policy turning retries off", []database.Option{database.WithRetryPolicy(sql.LevelSerializable, database.RetryPolicy{MaxAttempts: 1})}, sql.LevelSerializable, 1, 1, true},
+	} {
+		opts := append([]database.Option{database.WithRetryPolicy(sql.LevelSerializable, database.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})}, c.opts...)
+		db := fakedb.New().DB(t, opts...)
+		attempts := 0
+		err := db.Transaction(context.Background(), c.iso, func(tx *database.DB) error {
+			attempts++
+			if attempts <= c.failures {
+				return errSerialization
+			}
+			return nil
+		})
+		if attempts != c.attempts {
+			t.Errorf("%s: %d attempts, want %d", c.name, attempts, c.attempts)
+		}
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: err = %v, want error %v", c.name, err, c.wantErr)
+		}
+	}
+}
+
+func TestTransactionRetryNotRetryable(t *testing.T) {
+	db := fakedb.New().DB(t)
+	attempts := 0
+	bad := errors.New("bad input")
+	err := db.Transaction(context.Background(), sql.LevelSerializable, func(tx *database.DB) error {
+		attempts++
+		return bad
+	})
+	if attempts != 1 || !errors.Is(err, bad) {
+		t.Errorf("%d attempts, err %v; want 1 attempt failing with %v", attempts, err, bad)
+	}
+}
+
+func TestTransactionRetryError(t *testing.T) {
+	db := fakedb.New().DB(t, database.WithRetryPolicy(sql.LevelSerializable, database.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+	err := db.Transaction(context.Background(), sql.LevelSerializable, func(tx *database.DB) error {
+		return errSerialization
+	})
+	var rerr *database.RetryError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("err = %v, want a RetryError", err)
+	}
+	if rerr.Attempts != 3 || rerr.Elapsed < 3*time.Millisecond {
+		t.Errorf("Attempts = %d, Elapsed = %v; want 3 attempts and the two backoffs", rerr.Attempts, rerr.Elapsed)
+	}
+	if !errors.Is(err, database.ErrRetryBudgetExhausted) || !errors.Is(err, errSerialization) {
+		t.Errorf("err = %v, want ErrRetryBudgetExhausted and the last attempt's error", err)
+	}
+}
+
+func TestTransactionRetryCancelled(t *testing.T) {
+	db := fakedb.New().DB(t, database.WithRetryPolicy(sql.LevelSerializable, database.RetryPolicy{MaxAttempts: 5, Backoff: time.Hour}))
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := db.Transaction(ctx, sql.LevelSerializable, func(tx *database.DB) error {
+		attempts++
+		time.AfterFunc(10*time.Millisecond, cancel)
+		return errSerialization
+	})
+	var rerr *database.RetryError
+	if !errors.As(err, &rerr) || rerr.Attempts != 1 || attempts != 1 {
+		t.Fatalf("err = %v after %d attempts, want a RetryError after 1", err, attempts)
+	}
+	if !errors.Is(err, context.Canceled) || errors.Is(err, database.ErrRetryBudgetExhausted) {
+		t.Errorf("err = %v, want context.Canceled as the reason", err)
+	}
+	if database.Retryable(err) {
+		t.Error("a cancelled transaction is Retryable")
+	}
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrNoRLSContext is returned for a statement on a table listed with
+// WithRLSTables that runs outside a transaction or before SetRLSContext.
+var ErrNoRLSContext = errors.New("database: RLS-protected query without RLS context")
+
+// WithRLSTables lists tables protected by row-level security policies that
+// read GUCs set with SetRLSContext. Statements mentioning them fail with
+// ErrNoRLSContext unless they run in a transaction after SetRLSContext, so a
+// missing context cannot silently match no rows or, with a permissive
+// policy, all of them.
+func WithRLSTables(tables ...string) Option {
+	return func(db *DB) {
+		names := make([]string, len(tables))
+		for i, t := range tables {
+			names[i] = regexp.QuoteMeta(t)
+		}
+		db.rlsTables = regexp.MustCompile(`(?i)(^|[^\w"])"?(` + strings.Join(names, "|") + `)"?($|[^\w"])`)
+	}
+}
+
+type rlsKey struct{}
+
+// SetRLSContext sets the GUCs read by row-level security policies, e.g.
+// app.current_tenant and app.current_user, for the rest of the transaction.
+// It must be called on a transaction, before the RLS-protected statements.
+func (db *DB) SetRLSContext(ctx context.Context, settings map[string]string) error {
+	if db.tx == nil {
+		return errors.New("SetRLSContext(): not in a transaction")
+	}
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ctx = context.WithValue(ctx, rlsKey{}, true)
+	for _, k := range keys {
+		if err := db.SetLocal(ctx, k, settings[k]); err != nil {
+			return fmt.Errorf("SetRLSContext(): %w", err)
+		}
+	}
+	return nil
+}
+
+// checkRLS enforces WithRLSTables for the statement about to run.
+func (c *wrappedConn) checkRLS(ctx context.Context, query string) error {
+	if c.db.rlsTables == nil {
+		return nil
+	}
+	if ctx.Value(rlsKey{}) != nil && c.inTx {
+		c.rlsSet = true
+		return nil
+	}
+	if c.rlsSet || !c.db.rlsTables.MatchString(query) {
+		return nil
+	}
+	if !c.inTx {
+		return fmt.Errorf("%w: not in a transaction", ErrNoRLSContext)
+	}
+	return fmt.Errorf("%w: SetRLSContext not called", ErrNoRLSContext)
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// rowsRelease holds what a Query must keep until its rows are closed, such
+// as its bulkhead slot and its statement deadline. The wrapped connection
+// runs it when the driver rows close.
+type rowsRelease struct {
+	once sync.Once
+	f    func()
+	// taken is set once the driver rows carry the release.
+	taken bool
+}
+
+type rowsReleaseKey struct{}
+
+// withRowsRelease returns a context whose Query runs f when its rows are
+// closed.
+func withRowsRelease(ctx context.Context, f func()) (context.Context, *rowsRelease) {
+	r := &rowsRelease{f: f}
+	return context.WithValue(ctx, rowsReleaseKey{}, r), r
+}
+
+func (r *rowsRelease) release() {
+	r.once.Do(r.f)
+}
+
+// done runs the release now unless the rows took it: on error, or when
+// database/sql fell back to a prepared statement bypassing the wrapper.
+func (r *rowsRelease) done() {
+	if !r.taken {
+		r.release()
+	}
+}
+
+// wrapRows makes rows run the release of ctx when closed.
+func wrapRows(ctx context.Context, rows driver.Rows) driver.Rows {
+	r, ok := ctx.Value(rowsReleaseKey{}).(*rowsRelease)
+	if !ok || r.taken {
+		return rows
+	}
+	r.taken = true
+	return &wrappedRows{Rows: rows, r: r}
+}
+
+// wrappedRows forwards to the driver rows. The optional interfaces the
+// driver lacks answer as database/sql does without them.
+type wrappedRows struct {
+	driver.Rows
+	r *rowsRelease
+}
+
+// Close releases after closing the driver rows, which may still read from
+// the connection under the statement's context.
+func (w *wrappedRows) Close() error {
+	defer w.r.release()
+	return w.Rows.Close()
+}
+
+func (w *wrappedRows) HasNextResultSet() bool {
+	if n, ok := w.Rows.(driver.RowsNextResultSet); ok {
+		return n.HasNextResultSet()
+	}
+	return false
+}
+
+func (w *wrappedRows) NextResultSet() error {
+	if n, ok := w.Rows.(driver.RowsNextResultSet); ok {
+		return n.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (w *wrappedRows) ColumnTypeScanType(i int) reflect.Type {
+	if t, ok := w.Rows.(driver.RowsColumnTypeScanType); ok {
+		return t.ColumnTypeScanType(i)
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
+
+func (w *wrappedRows) ColumnTypeDatabaseTypeName(i int) string {
+	if t, ok := w.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return t.ColumnTypeDatabaseTypeName(i)
+	}
+	return ""
+}
+
+func (w *wrappedRows) ColumnTypeLength(i int) (int64, bool) {
+	if t, ok := w.Rows.(driver.RowsColumnTypeLength); ok {
+		return t.ColumnTypeLength(i)
+	}
+	return 0, false
+}
+
+func (w *wrappedRows) ColumnTypeNullable(i int) (bool, bool) {
+	if t, ok := w.Rows.(driver.RowsColumnTypeNullable); ok {
+		return t.ColumnTypeNullable(i)
+	}
+	return false, false
+}
+
+func (w *wrappedRows) ColumnTypePrecisionScale(i int) (int64, int64, bool) {
+	if t, ok := w.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return t.ColumnTypePrecisionScale(i)
+	}
+	return 0, 0, false
+}
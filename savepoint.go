@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// WithSavepoints returns a copy of db on which Transaction, when called
+// inside a transaction, runs f in a savepoint instead of failing.
+func (db *DB) WithSavepoints() *DB {
+	c := *db
+	c.nested = true
+	return &c
+}
+
+// Savepoint runs f inside a savepoint of the current transaction. If f
+// returns an error or panics, only the work done since the savepoint is
+// rolled back and the transaction can continue. If rolling back to the
+// savepoint fails the transaction cannot, and the error is that failure.
+func (db *DB) Savepoint(ctx context.Context, f func(*DB) error) (err error) {
+	if db.tx == nil {
+		return fmt.Errorf("Savepoint(): no transaction in progress")
+	}
+	sp := *db
+	sp.savepoints++
+	name := fmt.Sprintf("sp_%d", sp.savepoints)
+	if _, err := db.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("Savepoint(): %w", err)
+	}
+
+	returned := false
+	defer func() {
+		if p := recover(); p != nil {
+			db.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+			panic(p)
+		} else if err != nil || !returned {
+			if _, rerr := db.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rerr != nil {
+				err = &rollbackToError{err: rerr, cause: err}
+			}
+		} else if _, rerr := db.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name); rerr != nil {
+			err = fmt.Errorf("Savepoint(): release: %w", rerr)
+		}
+	}()
+
+	err = f(&sp)
+	returned = true
+	if err != nil {
+		return fmt.Errorf("Savepoint(): call f(tx): %w", err)
+	}
+	return nil
+}
+
+// rollbackToError is the error of a Savepoint whose rollback failed,
+// leaving the transaction aborted.
+type rollbackToError struct {
+	err   error
+	cause error // the error f returned, if any
+}
+
+func (e *rollbackToError) Error() string {
+	if e.cause == nil {
+		return "Savepoint(): rollback: " + e.err.Error()
+	}
+	return fmt.Sprintf("Savepoint(): rollback: %v (after %v)", e.err, e.cause)
+}
+
+func (e *rollbackToError) Unwrap() error {
+	return e.err
+}
+
+// ItemError is the error of one item of ForEachWithSavepoint.
+type ItemError struct {
+	Index int
+	Item  interface{}
+	Err   error
+}
+
+// ForEachWithSavepoint calls f for each element of the slice items, each in
+// its own savepoint, so a failed item is rolled back on its own and the
+// rest still apply, e.g. for imports where one bad row should not abort the
+// others. It returns the items f failed for; err is set only if the
+// transaction itself failed, and then the remaining items were not run.
+func (db *DB) ForEachWithSavepoint(ctx context.Context, items interface{}, f func(tx *DB, item interface{}) error) (failed []ItemError, err error) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("ForEachWithSavepoint(): items must be a slice, got %T", items)
+	}
+	for i := 0; i < v.Len(); i++ {
+		item := v.Index(i).Interface()
+		var itemErr error
+		err := db.Savepoint(ctx, func(tx *DB) error {
+			itemErr = f(tx, item)
+			return itemErr
+		})
+		if itemErr != nil {
+			failed = append(failed, ItemError{Index: i, Item: item, Err: itemErr})
+			var rerr *rollbackToError
+			if !errors.As(err, &rerr) {
+				continue
+			}
+		}
+		if err != nil {
+			return failed, fmt.Errorf("ForEachWithSavepoint(): item %d: %w", i, err)
+		}
+	}
+	return failed, nil
+}
@@ -0,0 +1,89 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/pkrypt0987/database"
+	"github.com/pkrypt0987/database/fakedb"
+)
+
+func queries(calls []fakedb.Call) []string {
+	qs := make([]string, len(calls))
+	for i, c := range calls {
+		qs[i] = c.Query
+	}
+	return qs
+}
+
+func TestForEachWithSavepoint(t *testing.T) {
+	f := fakedb.New()
+	f.On(`^(SAVEPOINT|RELEASE SAVEPOINT|ROLLBACK TO SAVEPOINT) `).ReturnRowsAffected(0)
+	f.On(`^INSERT`).ReturnRowsAffected(1)
+	db := f.DB(t)
+	bad := errors.New("bad item")
+	var failed []database.ItemError
+	err := db.Transaction(context.Background(), sql.LevelDefault, func(tx *database.DB) error {
+		var err error
+		failed, err = tx.ForEachWithSavepoint(context.Background(), []int{1, 2, 3}, func(tx *database.DB, item interface{}) error {
+			if item == 2 {
+				return bad
+			}
+			_, err := tx.Exec(context.Background(), "INSERT INTO t VALUES ($1)", item)
+			return err
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].Index != 1 || failed[0].Item != 2 || failed[0].Err != bad {
+		t.Errorf("failed = %+v, want item 2 with %v", failed, bad)
+	}
+	want := []string{
+		"BEGIN",
+		"SAVEPOINT sp_1", "INSERT INTO t VALUES ($1)", "RELEASE SAVEPOINT sp_1",
+		"SAVEPOINT sp_1", "ROLLBACK TO SAVEPOINT sp_1",
+		"SAVEPOINT sp_1", "INSERT INTO t VALUES ($1)", "RELEASE SAVEPOINT sp_1",
+		"COMMIT",
+	}
+	if got := queries(f.Calls()); !reflect.DeepEqual(got, want) {
+		t.Errorf("queries:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestForEachWithSavepointRollbackFails(t *testing.T) {
+	f := fakedb.New()
+	aborted := errors.New("current transaction is aborted")
+	f.On(`^ROLLBACK TO SAVEPOINT `).ReturnError(aborted)
+	f.On(`^(SAVEPOINT|RELEASE SAVEPOINT) `).ReturnRowsAffected(0)
+	db := f.DB(t)
+	var ran []interface{}
+	var failed []database.ItemError
+	err := db.Transaction(context.Background(), sql.LevelDefault, func(tx *database.DB) error {
+		var err error
+		failed, err = tx.ForEachWithSavepoint(context.Background(), []int{1, 2, 3}, func(tx *database.DB, item interface{}) error {
+			ran = append(ran, item)
+			if item == 1 {
+				return errors.New("bad item")
+			}
+			return nil
+		})
+		return err
+	})
+	if !errors.Is(err, aborted) {
+		t.Fatalf("err = %v, want the failed rollback", err)
+	}
+	if !reflect.DeepEqual(ran, []interface{}{1}) {
+		t.Errorf("ran items %v, want only the first", ran)
+	}
+	if len(failed) != 1 || failed[0].Index != 0 {
+		t.Errorf("failed = %+v, want item 1", failed)
+	}
+	if calls := f.Calls(); calls[len(calls)-1].Query != "ROLLBACK" {
+		t.Errorf("last query %q, want the transaction rolled back", calls[len(calls)-1].Query)
+	}
+}
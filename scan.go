@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// Get runs query and scans the first row into dest, which must be a pointer
+// to a struct (columns are matched to `db` tags) or to a single-column value.
+// It returns sql.ErrNoRows if the query returns no rows.
+func (db *DB) Get(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("Get(): dest must be a non-nil pointer, got %T", dest)
+	}
+	return db.intercept(ctx, &Call{Op: "Get", Query: query, Args: args, Dest: dest}, func(ctx context.Context, c *Call) error {
+		return db.get(ctx, v, c.Query, c.Args...)
+	})
+}
+
+func (db *DB) get(ctx context.Context, v reflect.Value, query string, args ...interface{}) error {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	if err := scanInto(rows, v.Elem()); err != nil {
+		return fmt.Errorf("Get(): %w", err)
+	}
+	return rows.Close()
+}
+
+// Select runs query and appends every row to dest, which must be a pointer
+// to a slice of structs, struct pointers or single-column values.
+func (db *DB) Select(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("Select(): dest must be a pointer to a slice, got %T", dest)
+	}
+	return db.intercept(ctx, &Call{Op: "Select", Query: query, Args: args, Dest: dest}, func(ctx context.Context, c *Call) error {
+		return db.selectRows(ctx, v, c.Query, c.Args...)
+	})
+}
+
+func (db *DB) selectRows(ctx context.Context, v reflect.Value, query string, args ...interface{}) error {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	slice := v.Elem()
+	elem := slice.Type().Elem()
+	isPtr := elem.Kind() == reflect.Ptr
+	if isPtr {
+		elem = elem.Elem()
+	}
+	for rows.Next() {
+		item := reflect.New(elem)
+		if err := scanInto(rows, item.Elem()); err != nil {
+			return fmt.Errorf("Select(): %w", err)
+		}
+		if isPtr {
+			slice = reflect.Append(slice, item)
+		} else {
+			slice = reflect.Append(slice, item.Elem())
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	v.Elem().Set(slice)
+	return nil
+}
+
+// scanInto scans the current row into v.
+func scanInto(rows *sql.Rows, v reflect.Value) error {
+	if !isStructDest(v.Type()) {
+		return rows.Scan(v.Addr().Interface())
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	byColumn := make(map[string][]int)
+	for _, f := range structFields(v.Type()) {
+		byColumn[f.column] = f.index
+	}
+	ptrs := make([]interface{}, len(cols))
+	for i, c := range cols {
+		index, ok := byColumn[c]
+		if !ok {
+			return fmt.Errorf("no field for column %q in %s", c, v.Type())
+		}
+		ptrs[i] = v.FieldByIndex(index).Addr().Interface()
+	}
+	return rows.Scan(ptrs...)
+}
+
+// isStructDest reports whether t is scanned field by field, as opposed to
+// being a struct that scans itself such as time.Time or sql.NullString.
+func isStructDest(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PtrTo(t).Implements(scannerType)
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// ScatterOption configures QueryAllShards and SelectAllShards.
+type ScatterOption func(*scatterConfig)
+
+type scatterConfig struct {
+	limit int
+	less  func(a, b interface{}) bool
+}
+
+// ScatterLimit wraps the query sent to every shard as
+// SELECT * FROM (query) AS s LIMIT n, so each returns at most n rows even if
+// the query has its own LIMIT or ends in a clause a trailing LIMIT would
+// break; SelectAllShards also truncates the merged result to n. The query
+// should then have an ORDER BY matching ScatterOrderBy.
+func ScatterLimit(n int) ScatterOption {
+	return func(c *scatterConfig) { c.limit = n }
+}
+
+// ScatterOrderBy orders the rows merged by SelectAllShards. a and b are
+// elements of the destination slice. QueryAllShards, which leaves merging to
+// the caller, rejects it.
+func ScatterOrderBy(less func(a, b interface{}) bool) ScatterOption {
+	return func(c *scatterConfig) { c.less = less }
+}
+
+func (s *Shards) scatterQuery(query string, opts []ScatterOption) (string, scatterConfig) {
+	var cfg scatterConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.limit > 0 {
+		query = fmt.Sprintf("SELECT * FROM (%s) AS s LIMIT %d", query, cfg.limit)
+	}
+	return query, cfg
+}
+
+// QueryAllShards runs a read on every shard concurrently and passes each
+// shard's rows to merge. Calls of merge are serialized, in no particular
+// shard order. The error joins the failures of all shards.
+func (s *Shards) QueryAllShards(ctx context.Context, query string, args []interface{}, merge func(shard int, rows *sql.Rows) error, opts ...ScatterOption) error {
+	query, cfg := s.scatterQuery(query, opts)
+	if cfg.less != nil {
+		return fmt.Errorf("QueryAllShards(): ScatterOrderBy is only supported by SelectAllShards")
+	}
+	var mu sync.Mutex
+	err := s.each(func(i int, db *DB) error {
+		rows, err := db.Query(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		if err := merge(i, rows); err != nil {
+			return err
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return fmt.Errorf("QueryAllShards(): %w", err)
+	}
+	return nil
+}
+
+// SelectAllShards is like Select but runs the query on every shard
+// concurrently and appends all their rows to dest, ordered by ScatterOrderBy
+// and truncated by ScatterLimit if given.
+func (s *Shards) SelectAllShards(ctx context.Context, dest interface{}, query string, args []interface{}, opts ...ScatterOption) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("SelectAllShards(): dest must be a pointer to a slice, got %T", dest)
+	}
+	query, cfg := s.scatterQuery(query, opts)
+	results := make([]reflect.Value, len(s.dbs))
+	err := s.each(func(i int, db *DB) error {
+		part := reflect.New(v.Elem().Type())
+		if err := db.Select(ctx, part.Interface(), query, args...); err != nil {
+			return err
+		}
+		results[i] = part.Elem()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("SelectAllShards(): %w", err)
+	}
+	all := reflect.MakeSlice(v.Elem().Type(), 0, 0)
+	for _, part := range results {
+		all = reflect.AppendSlice(all, part)
+	}
+	if cfg.less != nil {
+		sort.SliceStable(all.Interface(), func(i, j int) bool {
+			return cfg.less(all.Index(i).Interface(), all.Index(j).Interface())
+		})
+	}
+	if cfg.limit > 0 && all.Len() > cfg.limit {
+		all = all.Slice(0, cfg.limit)
+	}
+	v.Elem().Set(reflect.AppendSlice(v.Elem(), all))
+	return nil
+}
+
+// each runs f for every shard concurrently and joins the errors in shard
+// order.
+func (s *Shards) each(f func(i int, db *DB) error) error {
+	errs := make([]error, len(s.dbs))
+	var wg sync.WaitGroup
+	for i, db := range s.dbs {
+		wg.Add(1)
+		go func(i int, db *DB) {
+			defer wg.Done()
+			if err := f(i, db); err != nil {
+				errs[i] = fmt.Errorf("shard %d: %w", i, err)
+			}
+		}(i, db)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
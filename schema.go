@@ -0,0 +1,241 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Schema describes the user tables of a database.
+type Schema struct {
+	Tables []*Table
+}
+
+// Table returns the table with the given name, or nil. The name may be
+// schema-qualified; an unqualified name prefers the "public" schema.
+func (s *Schema) Table(name string) *Table {
+	schema, table, ok := strings.Cut(name, ".")
+	if !ok {
+		schema, table = "", name
+	}
+	var found *Table
+	for _, t := range s.Tables {
+		if t.Name != table || (schema != "" && t.Schema != schema) {
+			continue
+		}
+		if schema != "" || t.Schema == "public" {
+			return t
+		}
+		if found == nil {
+			found = t
+		}
+	}
+	return found
+}
+
+type Table struct {
+	Schema      string
+	Name        string
+	Columns     []Column
+	Indexes     []Index
+	Constraints []Constraint
+	ForeignKeys []ForeignKey
+}
+
+// Column returns the column with the given name, or nil.
+func (t *Table) Column(name string) *Column {
+	for i := range t.Columns {
+		if t.Columns[i].Name == name {
+			return &t.Columns[i]
+		}
+	}
+	return nil
+}
+
+type Column struct {
+	Name string
+	// Type is the information_schema data_type, e.g. "integer" or "ARRAY".
+	Type string
+	// UDTName is the underlying type name, e.g. "int4" or "_text".
+	UDTName  string
+	Nullable bool
+	// Default is the default expression, empty if there is none.
+	Default string
+}
+
+type Index struct {
+	Name    string
+	Columns []string
+	Unique  bool
+	Primary bool
+}
+
+// ConstraintType is the single-letter pg_constraint.contype.
+type ConstraintType string
+
+const (
+	PrimaryKeyConstraint ConstraintType = "p"
+	UniqueConstraint     ConstraintType = "u"
+	CheckConstraint      ConstraintType = "c"
+	ForeignKeyConstraint ConstraintType = "f"
+	ExclusionConstraint  ConstraintType = "x"
+)
+
+type Constraint struct {
+	Name       string
+	Type       ConstraintType
+	Columns    []string
+	Definition string
+}
+
+type ForeignKey struct {
+	Name       string
+	Columns    []string
+	RefSchema  string
+	RefTable   string
+	RefColumns []string
+}
+
+const userSchemas = `NOT IN ('pg_catalog', 'information_schema') AND %s NOT LIKE 'pg_toast%%'`
+
+// Schema reads the tables, columns, indexes, constraints and foreign keys of
+// every non-system schema.
+func (db *DB) Schema(ctx context.Context) (*Schema, error) {
+	s := &Schema{}
+	tables := make(map[string]*Table)
+	lookup := func(schema, name string) *Table {
+		return tables[schema+"."+name]
+	}
+
+	rows, err := db.Query(ctx, `SELECT table_schema, table_name FROM information_schema.tables
+		WHERE table_type = 'BASE TABLE' AND table_schema `+fmt.Sprintf(userSchemas, "table_schema")+`
+		ORDER BY table_schema, table_name`)
+	if err != nil {
+		return nil, fmt.Errorf("Schema(): tables: %w", err)
+	}
+	for rows.Next() {
+		t := &Table{}
+		if err := rows.Scan(&t.Schema, &t.Name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("Schema(): tables: %w", err)
+		}
+		s.Tables = append(s.Tables, t)
+		tables[t.Schema+"."+t.Name] = t
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Schema(): tables: %w", err)
+	}
+
+	rows, err = db.Query(ctx, `SELECT table_schema, table_name, column_name, data_type, udt_name,
+		is_nullable = 'YES', COALESCE(column_default, '')
+		FROM information_schema.columns
+		WHERE table_schema `+fmt.Sprintf(userSchemas, "table_schema")+`
+		ORDER BY table_schema, table_name, ordinal_position`)
+	if err != nil {
+		return nil, fmt.Errorf("Schema(): columns: %w", err)
+	}
+	for rows.Next() {
+		var schema, table string
+		var c Column
+		if err := rows.Scan(&schema, &table, &c.Name, &c.Type, &c.UDTName, &c.Nullable, &c.Default); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("Schema(): columns: %w", err)
+		}
+		if t := lookup(schema, table); t != nil {
+			t.Columns = append(t.Columns, c)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Schema(): columns: %w", err)
+	}
+
+	rows, err = db.Query(ctx, `SELECT n.nspname, t.relname, i.relname, ix.indisunique, ix.indisprimary,
+		array_to_string(ARRAY(
+			SELECT a.attname FROM unnest(ix.indkey) WITH ORDINALITY k(attnum, ord)
+			JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+			ORDER BY k.ord), ',')
+		FROM pg_index ix
+		JOIN pg_class t ON t.oid = ix.indrelid
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname `+fmt.Sprintf(userSchemas, "n.nspname")+`
+		ORDER BY 1, 2, 3`)
+	if err != nil {
+		return nil, fmt.Errorf("Schema(): indexes: %w", err)
+	}
+	for rows.Next() {
+		var schema, table, cols string
+		var ix Index
+		if err := rows.Scan(&schema, &table, &ix.Name, &ix.Unique, &ix.Primary, &cols); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("Schema(): indexes: %w", err)
+		}
+		ix.Columns = splitList(cols)
+		if t := lookup(schema, table); t != nil {
+			t.Indexes = append(t.Indexes, ix)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Schema(): indexes: %w", err)
+	}
+
+	rows, err = db.Query(ctx, `SELECT n.nspname, t.relname, c.conname, c.contype::text,
+		array_to_string(ARRAY(
+			SELECT a.attname FROM unnest(c.conkey) WITH ORDINALITY k(attnum, ord)
+			JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+			ORDER BY k.ord), ','),
+		COALESCE(rn.nspname, ''), COALESCE(rt.relname, ''),
+		array_to_string(ARRAY(
+			SELECT a.attname FROM unnest(c.confkey) WITH ORDINALITY k(attnum, ord)
+			JOIN pg_attribute a ON a.attrelid = c.confrelid AND a.attnum = k.attnum
+			ORDER BY k.ord), ','),
+		pg_get_constraintdef(c.oid)
+		FROM pg_constraint c
+		JOIN pg_class t ON t.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		LEFT JOIN pg_class rt ON rt.oid = c.confrelid
+		LEFT JOIN pg_namespace rn ON rn.oid = rt.relnamespace
+		WHERE n.nspname `+fmt.Sprintf(userSchemas, "n.nspname")+`
+		ORDER BY 1, 2, 3`)
+	if err != nil {
+		return nil, fmt.Errorf("Schema(): constraints: %w", err)
+	}
+	for rows.Next() {
+		var schema, table, cols, refSchema, refTable, refCols string
+		var c Constraint
+		if err := rows.Scan(&schema, &table, &c.Name, &c.Type, &cols, &refSchema, &refTable, &refCols, &c.Definition); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("Schema(): constraints: %w", err)
+		}
+		c.Columns = splitList(cols)
+		t := lookup(schema, table)
+		if t == nil {
+			continue
+		}
+		t.Constraints = append(t.Constraints, c)
+		if c.Type == ForeignKeyConstraint {
+			t.ForeignKeys = append(t.ForeignKeys, ForeignKey{
+				Name:       c.Name,
+				Columns:    c.Columns,
+				RefSchema:  refSchema,
+				RefTable:   refTable,
+				RefColumns: splitList(refCols),
+			})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Schema(): constraints: %w", err)
+	}
+	return s, nil
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
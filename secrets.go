@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// PasswordFile is a CredentialSource that reads the password from path, e.g.
+// a Docker or Kubernetes secret mount, each time a connection is made, so a
+// rotated secret takes effect without a restart. Surrounding whitespace is
+// trimmed, and the user is left as given in the DSN.
+func PasswordFile(path string) CredentialsProvider {
+	return func(context.Context) (string, string, error) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", fmt.Errorf("PasswordFile(%s): %w", path, err)
+		}
+		return "", strings.TrimSpace(string(b)), nil
+	}
+}
+
+// WithEnvExpansion makes Open replace ${NAME} in the DSN's values with the
+// environment variable NAME, quoting or escaping it as the DSN format needs.
+// Open fails if a referenced variable is not set.
+func WithEnvExpansion() Option {
+	return func(db *DB) {
+		db.expandEnv = true
+	}
+}
+
+// prepareDSN applies WithEnvExpansion and the password_file parameter to the
+// DSN given to Open.
+func (db *DB) prepareDSN(dsn string) (string, error) {
+	if db.expandEnv {
+		var err error
+		if dsn, err = expandDSNEnv(dsn); err != nil {
+			return "", err
+		}
+	}
+	dsn, path, ok := cutDSNParam(dsn, "password_file")
+	if !ok {
+		return dsn, nil
+	}
+	if db.credentials != nil {
+		return "", fmt.Errorf("database: password_file cannot be combined with WithCredentials")
+	}
+	db.credentials = PasswordFile(path)
+	return dsn, nil
+}
+
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the ${NAME} references in s.
+func expandEnv(s string) (string, error) {
+	var err error
+	s = envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		v, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("database: environment variable %s is not set", name)
+		}
+		return v
+	})
+	return s, err
+}
+
+func expandDSNEnv(dsn string) (string, error) {
+	if isURLDSN(dsn) {
+		// Escape each value so it stays within its part of the URL.
+		var err error
+		dsn = envRef.ReplaceAllStringFunc(dsn, func(ref string) string {
+			v, verr := expandEnv(ref)
+			if verr != nil && err == nil {
+				err = verr
+			}
+			return strings.ReplaceAll(url.QueryEscape(v), "+", "%20")
+		})
+		return dsn, err
+	}
+	kvs := splitKeywords(dsn)
+	for i, kv := range kvs {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		v, err := expandEnv(unquote(v))
+		if err != nil {
+			return "", err
+		}
+		kvs[i] = strings.TrimSpace(k) + "=" + quoteDSNValue(v)
+	}
+	return strings.Join(kvs, " "), nil
+}
+
+func isURLDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// cutDSNParam removes the parameter key from a URL or key/value DSN and
+// returns its value.
+func cutDSNParam(dsn, key string) (rest, value string, found bool) {
+	if isURLDSN(dsn) {
+		base, query, ok := strings.Cut(dsn, "?")
+		if !ok {
+			return dsn, "", false
+		}
+		var kept []string
+		for _, p := range strings.Split(query, "&") {
+			k, v, _ := strings.Cut(p, "=")
+			if k, _ := url.QueryUnescape(k); k == key {
+				value, _ = url.QueryUnescape(v)
+				found = true
+				continue
+			}
+			kept = append(kept, p)
+		}
+		if len(kept) == 0 {
+			return base, value, found
+		}
+		return base + "?" + strings.Join(kept, "&"), value, found
+	}
+	var kept []string
+	for _, kv := range splitKeywords(dsn) {
+		if k, v, _ := strings.Cut(kv, "="); strings.TrimSpace(k) == key {
+			value = unquote(v)
+			found = true
+			continue
+		}
+		kept = append(kept, kv)
+	}
+	return strings.Join(kept, " "), value, found
+}
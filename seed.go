@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// SeedsTable is the table where applied seed names are recorded.
+const SeedsTable = "schema_seeds"
+
+// Seed is a named set of reference data. Exactly one of SQL or Func must be
+// set. A seed with no Envs applies to every environment.
+type Seed struct {
+	Name string
+	Envs []string
+	SQL  string
+	Func func(ctx context.Context, tx *DB) error
+}
+
+func (s Seed) appliesTo(env string) bool {
+	if len(s.Envs) == 0 {
+		return true
+	}
+	for _, e := range s.Envs {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+// Seeder applies the seeds for one environment, each at most once.
+type Seeder struct {
+	db    *DB
+	env   string
+	seeds []Seed
+}
+
+func NewSeeder(db *DB, env string, seeds ...Seed) *Seeder {
+	return &Seeder{db: db, env: env, seeds: seeds}
+}
+
+// Run applies every seed for the environment that has not been applied yet,
+// each in its own transaction. It applies none if any seed sets both or
+// neither of SQL and Func.
+func (s *Seeder) Run(ctx context.Context) error {
+	if err := s.check(); err != nil {
+		return fmt.Errorf("Seeder.Run(): %w", err)
+	}
+	if err := s.init(ctx, s.db); err != nil {
+		return fmt.Errorf("Seeder.Run(): %w", err)
+	}
+	for _, sd := range s.seeds {
+		if !sd.appliesTo(s.env) {
+			continue
+		}
+		err := s.db.Transaction(ctx, sql.LevelDefault, func(tx *DB) error {
+			return s.apply(ctx, tx, sd)
+		})
+		if err != nil {
+			return fmt.Errorf("Seeder.Run(): seed %q: %w", sd.Name, err)
+		}
+	}
+	return nil
+}
+
+// runTx applies the pending seeds inside an existing transaction.
+func (s *Seeder) runTx(ctx context.Context, tx *DB) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	if err := s.init(ctx, tx); err != nil {
+		return err
+	}
+	for _, sd := range s.seeds {
+		if !sd.appliesTo(s.env) {
+			continue
+		}
+		if err := s.apply(ctx, tx, sd); err != nil {
+			return fmt.Errorf("seed %q: %w", sd.Name, err)
+		}
+	}
+	return nil
+}
+
+// check rejects seeds that do not set exactly one of SQL and Func.
+func (s *Seeder) check() error {
+	for _, sd := range s.seeds {
+		if (sd.SQL == "") == (sd.Func == nil) {
+			return fmt.Errorf("seed %q must set exactly one of SQL and Func", sd.Name)
+		}
+	}
+	return nil
+}
+
+func (s *Seeder) apply(ctx context.Context, tx *DB, sd Seed) error {
+	n, err := tx.Exec(ctx, `INSERT INTO `+SeedsTable+` (name, env) VALUES ($1, $2) ON CONFLICT DO NOTHING`, sd.Name, s.env)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// Already applied.
+		return nil
+	}
+	if sd.Func != nil {
+		return sd.Func(ctx, tx)
+	}
+	_, err = tx.Exec(ctx, sd.SQL)
+	return err
+}
+
+func (s *Seeder) init(ctx context.Context, db *DB) error {
+	_, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+SeedsTable+` (
+		name       TEXT NOT NULL,
+		env        TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (name, env)
+	)`)
+	return err
+}
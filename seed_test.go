@@ -0,0 +1,59 @@
+package database_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/pkrypt0987/database"
+	"github.com/pkrypt0987/database/fakedb"
+)
+
+func TestSeederRun(t *testing.T) {
+	f := fakedb.New()
+	f.On(`^CREATE TABLE`).ReturnRowsAffected(0)
+	f.On(`^INSERT INTO schema_seeds`).ReturnRowsAffected(1).Once()
+	f.On(`^INSERT INTO schema_seeds`).ReturnRowsAffected(0)
+	f.On(`^INSERT INTO countries`).ReturnRowsAffected(2)
+	db := f.DB(t)
+	ctx := context.Background()
+	countries := database.Seed{Name: "countries", SQL: "INSERT INTO countries VALUES ('NL'), ('PT')"}
+	demo := database.Seed{Name: "demo", Envs: []string{"dev"}, Func: func(context.Context, *database.DB) error {
+		t.Error("dev seed applied in prod")
+		return nil
+	}}
+	if err := database.NewSeeder(db, "prod", countries, demo).Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Applied seeds are skipped.
+	if err := database.NewSeeder(db, "prod", countries).Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var inserts []string
+	for _, q := range queries(f.Calls()) {
+		if q == countries.SQL {
+			inserts = append(inserts, q)
+		}
+	}
+	if !reflect.DeepEqual(inserts, []string{countries.SQL}) {
+		t.Errorf("seed SQL ran %d times, want once", len(inserts))
+	}
+}
+
+func TestSeederInvalidSeed(t *testing.T) {
+	f := fakedb.New()
+	db := f.DB(t)
+	noop := func(context.Context, *database.DB) error { return nil }
+	for _, sd := range []database.Seed{
+		{Name: "both", SQL: "SELECT 1", Func: noop},
+		{Name: "neither"},
+	} {
+		valid := database.Seed{Name: "valid", SQL: "SELECT 1"}
+		if err := database.NewSeeder(db, "prod", valid, sd).Run(context.Background()); err == nil {
+			t.Errorf("seed %q: Run succeeded", sd.Name)
+		}
+	}
+	if calls := f.Calls(); len(calls) != 0 {
+		t.Errorf("invalid seeds ran queries %v, want none", calls)
+	}
+}
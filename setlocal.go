@@ -0,0 +1,32 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// settingName matches a configuration parameter name, optionally qualified
+// as custom GUCs are ("app.current_tenant").
+var settingName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)*$`)
+
+// SetLocal sets a configuration parameter for the rest of the transaction,
+// like SET LOCAL. The value is sent as a query argument, never spliced into
+// the statement. It must be called on a transaction.
+func (db *DB) SetLocal(ctx context.Context, name, value string) error {
+	if db.tx == nil {
+		return fmt.Errorf("SetLocal(%s): not in a transaction", name)
+	}
+	if !settingName.MatchString(name) {
+		return fmt.Errorf("SetLocal(%q): invalid parameter name", name)
+	}
+	if strings.IndexByte(value, 0) >= 0 {
+		return fmt.Errorf("SetLocal(%s): %w", name, errors.New("value contains a NUL byte"))
+	}
+	if _, err := db.tx.ExecContext(ctx, `SELECT set_config($1, $2, true)`, name, value); err != nil {
+		return fmt.Errorf("SetLocal(%s): %w", name, err)
+	}
+	return nil
+}
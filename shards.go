@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+)
+
+type ShardsConfig struct {
+	Driver string
+	// DSNs lists the shards in order; a key's shard is its hash modulo the
+	// number of shards, so the order must not change.
+	DSNs []string
+	// Hash hashes a shard key. Defaults to 32-bit FNV-1a.
+	Hash    func(key string) uint32
+	Options []Option
+}
+
+// Shards routes statements to one of several databases by a shard key, for
+// tables partitioned across databases.
+type Shards struct {
+	dbs  []*DB
+	hash func(string) uint32
+}
+
+// OpenShards opens every shard. If one fails to open, the ones already
+// opened are closed.
+func OpenShards(cfg ShardsConfig) (*Shards, error) {
+	if len(cfg.DSNs) == 0 {
+		return nil, errors.New("OpenShards(): no shards")
+	}
+	s := &Shards{hash: cfg.Hash}
+	if s.hash == nil {
+		s.hash = fnvHash
+	}
+	for i, dsn := range cfg.DSNs {
+		db, err := Open(cfg.Driver, dsn, cfg.Options...)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("OpenShards(): shard %d: %w", i, err)
+		}
+		s.dbs = append(s.dbs, db)
+	}
+	return s, nil
+}
+
+func fnvHash(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// Len returns the number of shards.
+func (s *Shards) Len() int {
+	return len(s.dbs)
+}
+
+// Shard returns the i-th shard.
+func (s *Shards) Shard(i int) *DB {
+	return s.dbs[i]
+}
+
+// ShardIndex returns the index of the shard holding key.
+func (s *Shards) ShardIndex(key string) int {
+	return int(s.hash(key) % uint32(len(s.dbs)))
+}
+
+// ShardFor returns the shard holding key.
+func (s *Shards) ShardFor(key string) *DB {
+	return s.dbs[s.ShardIndex(key)]
+}
+
+// ExecOnShard executes a statement on the shard holding key.
+func (s *Shards) ExecOnShard(ctx context.Context, key string, query string, args ...interface{}) (int64, error) {
+	return s.ShardFor(key).Exec(ctx, query, args...)
+}
+
+// QueryOnShard runs a query on the shard holding key.
+func (s *Shards) QueryOnShard(ctx context.Context, key string, query string, args ...interface{}) (*sql.Rows, error) {
+	return s.ShardFor(key).Query(ctx, query, args...)
+}
+
+// QueryRowOnShard runs a single-row query on the shard holding key.
+func (s *Shards) QueryRowOnShard(ctx context.Context, key string, query string, args ...interface{}) *sql.Row {
+	return s.ShardFor(key).QueryRow(ctx, query, args...)
+}
+
+// TransactionOnShard runs f in a transaction on the shard holding key.
+func (s *Shards) TransactionOnShard(ctx context.Context, key string, iso sql.IsolationLevel, f func(*DB) error) error {
+	return s.ShardFor(key).Transaction(ctx, iso, f)
+}
+
+func (s *Shards) Close() error {
+	var errs []error
+	for _, db := range s.dbs {
+		errs = append(errs, db.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrShuttingDown is returned for work started after Shutdown was called.
+var ErrShuttingDown = errors.New("database: shutting down")
+
+// lifecycle tracks in-flight top-level operations for Shutdown.
+type lifecycle struct {
+	mu       sync.Mutex
+	closing  bool
+	inflight int
+	idle     chan struct{}
+}
+
+func (lc *lifecycle) enter(ctx context.Context) (context.Context, func(error), error) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if lc.closing {
+		return ctx, nil, ErrShuttingDown
+	}
+	lc.inflight++
+	return ctx, lc.exit, nil
+}
+
+func (lc *lifecycle) exit(error) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.inflight--
+	if lc.closing && lc.inflight == 0 && lc.idle != nil {
+		close(lc.idle)
+		lc.idle = nil
+	}
+}
+
+// Shutdown stops accepting new work, waits for in-flight queries and
+// transactions to finish or for ctx to be done, and then closes the pool.
+// Calls made after Shutdown started return ErrShuttingDown.
+func (db *DB) Shutdown(ctx context.Context) error {
+	lc := db.lc
+	lc.mu.Lock()
+	if lc.closing {
+		lc.mu.Unlock()
+		return fmt.Errorf("Shutdown(): %w", ErrShuttingDown)
+	}
+	lc.closing = true
+	idle := make(chan struct{})
+	if lc.inflight == 0 {
+		close(idle)
+	} else {
+		lc.idle = idle
+	}
+	lc.mu.Unlock()
+
+	var waitErr error
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		waitErr = fmt.Errorf("waiting for in-flight work: %w", ctx.Err())
+	}
+	if err := errors.Join(waitErr, db.close()); err != nil {
+		return fmt.Errorf("Shutdown(): %w", err)
+	}
+	return nil
+}
+
+// errRow returns a *sql.Row whose Scan returns err. A Row cannot be built
+// directly, so it comes from a throwaway DB whose connector always fails.
+func errRow(err error) *sql.Row {
+	sqldb := sql.OpenDB(failConnector{err})
+	defer sqldb.Close()
+	return sqldb.QueryRowContext(context.Background(), "")
+}
+
+type failConnector struct{ err error }
+
+func (c failConnector) Connect(context.Context) (driver.Conn, error) { return nil, c.err }
+func (c failConnector) Driver() driver.Driver                        { return failDriver(c) }
+
+type failDriver failConnector
+
+func (d failDriver) Open(string) (driver.Conn, error) { return nil, d.err }
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TopSlowQueries returns the statistics of the n slowest statements by
+// p95 latency, or all of them if n is negative, for triage on services
+// without full APM coverage. It needs WithQueryStats and returns nil
+// without it.
+func (db *DB) TopSlowQueries(n int) []QueryStat {
+	stats := db.QueryStats()
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].P95 > stats[j].P95 })
+	if n >= 0 && n < len(stats) {
+		stats = stats[:n]
+	}
+	return stats
+}
+
+// SlowQueryReport is the JSON document of QueryStatsHandler.
+type SlowQueryReport struct {
+	Queries []SlowQuery `json:"queries"`
+}
+
+// SlowQuery is a statement of a SlowQueryReport.
+type SlowQuery struct {
+	QueryStat
+	Mean      time.Duration `json:"mean_ns"`
+	ErrorRate float64       `json:"error_rate"`
+}
+
+// QueryStatsHandler serves TopSlowQueries as a SlowQueryReport, 20
+// statements unless the "n" query parameter says otherwise. Mount it on an
+// internal listener: the report includes statement text.
+func (db *DB) QueryStatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if db.stats == nil {
+			http.Error(w, "query statistics are not enabled", http.StatusNotFound)
+			return
+		}
+		n := 20
+		if s := r.URL.Query().Get("n"); s != "" {
+			var err error
+			if n, err = strconv.Atoi(s); err != nil || n < 0 {
+				http.Error(w, "invalid n", http.StatusBadRequest)
+				return
+			}
+		}
+		report := SlowQueryReport{Queries: []SlowQuery{}}
+		for _, s := range db.TopSlowQueries(n) {
+			report.Queries = append(report.Queries, SlowQuery{QueryStat: s, Mean: s.Mean(), ErrorRate: s.ErrorRate()})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	})
+}
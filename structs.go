@@ -0,0 +1,106 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Tabler is implemented by models whose table name differs from the
+// snake_case form of their type name.
+type Tabler interface {
+	TableName() string
+}
+
+// field is a struct field mapped to a column through its `db` tag.
+type field struct {
+	column string
+	index  []int
+	typ    reflect.Type
+	opts   map[string]bool
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+// structFields returns the mapped fields of struct type t. Fields without a
+// `db` tag use the snake_case field name; `db:"-"` skips the field and
+// embedded structs are flattened.
+func structFields(t reflect.Type) []field {
+	if fs, ok := fieldCache.Load(t); ok {
+		return fs.([]field)
+	}
+	var fs []field
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			tag := sf.Tag.Get("db")
+			if tag == "-" {
+				continue
+			}
+			idx := append(append([]int(nil), index...), i)
+			if sf.Anonymous && tag == "" && sf.Type.Kind() == reflect.Struct {
+				walk(sf.Type, idx)
+				continue
+			}
+			name, rest, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = toSnake(sf.Name)
+			}
+			f := field{column: name, index: idx, typ: sf.Type, opts: map[string]bool{}}
+			for _, o := range strings.Split(rest, ",") {
+				if o != "" {
+					f.opts[o] = true
+				}
+			}
+			fs = append(fs, f)
+		}
+	}
+	walk(t, nil)
+	fieldCache.Store(t, fs)
+	return fs
+}
+
+// modelType returns the struct type behind v, which may be a struct, a
+// pointer to one, or a slice of either.
+func modelType(v interface{}) reflect.Type {
+	t := reflect.TypeOf(v)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice) {
+		t = t.Elem()
+	}
+	return t
+}
+
+// tableName returns the table for model v.
+func tableName(v interface{}) string {
+	if t, ok := v.(Tabler); ok {
+		return t.TableName()
+	}
+	t := modelType(v)
+	if t == nil {
+		return ""
+	}
+	if tb, ok := reflect.New(t).Interface().(Tabler); ok {
+		return tb.TableName()
+	}
+	return toSnake(t.Name())
+}
+
+func toSnake(s string) string {
+	var b strings.Builder
+	rs := []rune(s)
+	for i, r := range rs {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(rs[i-1]) || (i+1 < len(rs) && unicode.IsLower(rs[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/lib/pq"
+)
+
+// OnCommit is what happens to a temporary table when its transaction
+// commits.
+type OnCommit string
+
+const (
+	// OnCommitDrop drops the table, so it lasts exactly as long as the
+	// transaction.
+	OnCommitDrop OnCommit = "DROP"
+	// OnCommitDeleteRows empties the table. It is kept, on the session of
+	// the pooled connection, until the connection closes.
+	OnCommitDeleteRows OnCommit = "DELETE ROWS"
+	// OnCommitPreserveRows keeps the table and its rows on the session of
+	// the pooled connection until the connection closes.
+	OnCommitPreserveRows OnCommit = "PRESERVE ROWS"
+)
+
+// CreateTempTable creates the temporary table name with the column
+// definitions ddl, e.g. "id bigint, email text" or "LIKE users", for
+// staging data to MERGE or join into other tables:
+//
+//	err := db.Transaction(ctx, sql.LevelDefault, func(tx *database.DB) error {
+//		if err := tx.CreateTempTable(ctx, "users_in", "LIKE users", database.OnCommitDrop); err != nil {
+//			return err
+//		}
+//		if _, err := tx.LoadTempTable(ctx, "users_in", cols, pgx.CopyFromRows(rows)); err != nil {
+//			return err
+//		}
+//		_, err := tx.Exec(ctx, `MERGE INTO users u USING users_in i ON ...`)
+//		return err
+//	})
+//
+// It must be called on a transaction. onCommit defaults to OnCommitDrop;
+// with the others the table outlives the transaction, so later
+// transactions on the same connection cannot create it again. A rollback
+// always drops it.
+func (db *DB) CreateTempTable(ctx context.Context, name, ddl string, onCommit OnCommit) error {
+	if db.tx == nil {
+		return fmt.Errorf("CreateTempTable(%s): not in a transaction", name)
+	}
+	if onCommit == "" {
+		onCommit = OnCommitDrop
+	}
+	switch onCommit {
+	case OnCommitDrop, OnCommitDeleteRows, OnCommitPreserveRows:
+	default:
+		return fmt.Errorf("CreateTempTable(%s): invalid ON COMMIT action %q", name, onCommit)
+	}
+	if _, err := db.Exec(ctx, `CREATE TEMPORARY TABLE `+pq.QuoteIdentifier(name)+` (`+ddl+`) ON COMMIT `+string(onCommit)); err != nil {
+		return fmt.Errorf("CreateTempTable(%s): %w", name, err)
+	}
+	return nil
+}
+
+// maxParams is the number of bind parameters a statement may have.
+const maxParams = 65535
+
+// LoadTempTable loads the rows of src into the columns of the temporary
+// table name and returns the number of rows loaded. On a DB opened with
+// OpenPgx it uses COPY, otherwise multi-row INSERTs. It must be called on
+// the transaction that created the table.
+func (db *DB) LoadTempTable(ctx context.Context, name string, columns []string, src pgx.CopyFromSource) (int64, error) {
+	if db.tx == nil {
+		return 0, fmt.Errorf("LoadTempTable(%s): not in a transaction", name)
+	}
+	if len(columns) == 0 {
+		return 0, fmt.Errorf("LoadTempTable(%s): no columns", name)
+	}
+	if db.pgxPool != nil {
+		n, err := db.CopyFrom(ctx, pgx.Identifier{name}, columns, src)
+		if err != nil {
+			return n, fmt.Errorf("LoadTempTable(%s): %w", name, err)
+		}
+		return n, nil
+	}
+
+	cols := make([]string, len(columns))
+	for i, c := range columns {
+		cols[i] = pq.QuoteIdentifier(c)
+	}
+	prefix := `INSERT INTO ` + pq.QuoteIdentifier(name) + ` (` + strings.Join(cols, ", ") + `) VALUES `
+	batch := maxParams / len(columns)
+	if batch > 1000 {
+		batch = 1000
+	}
+	var total int64
+	var args []interface{}
+	var values []string
+	flush := func() error {
+		if len(values) == 0 {
+			return nil
+		}
+		n, err := db.Exec(ctx, prefix+strings.Join(values, ", "), args...)
+		total += n
+		args, values = args[:0], values[:0]
+		return err
+	}
+	for src.Next() {
+		row, err := src.Values()
+		if err != nil {
+			return total, fmt.Errorf("LoadTempTable(%s): %w", name, err)
+		}
+		if len(row) != len(columns) {
+			return total, fmt.Errorf("LoadTempTable(%s): row of %d values for %d columns", name, len(row), len(columns))
+		}
+		params := make([]string, len(row))
+		for i, v := range row {
+			args = append(args, v)
+			params[i] = "$" + strconv.Itoa(len(args))
+		}
+		values = append(values, "("+strings.Join(params, ", ")+")")
+		if len(values) == batch {
+			if err := flush(); err != nil {
+				return total, fmt.Errorf("LoadTempTable(%s): %w", name, err)
+			}
+		}
+	}
+	if err := src.Err(); err != nil {
+		return total, fmt.Errorf("LoadTempTable(%s): %w", name, err)
+	}
+	if err := flush(); err != nil {
+		return total, fmt.Errorf("LoadTempTable(%s): %w", name, err)
+	}
+	return total, nil
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownTenant is returned by ForTenant when the tenant has no schema.
+var ErrUnknownTenant = errors.New("database: unknown tenant")
+
+// WithTenantSchema sets how ForTenant names a tenant's schema. Defaults to
+// "tenant_" followed by the tenant ID.
+func WithTenantSchema(name func(tenantID string) string) Option {
+	return func(db *DB) {
+		db.tenantSchema = name
+	}
+}
+
+func (db *DB) tenantSchemaName(tenantID string) string {
+	if db.tenantSchema != nil {
+		return db.tenantSchema(tenantID)
+	}
+	return "tenant_" + tenantID
+}
+
+// ForTenant returns a DB whose statements and transactions run with
+// search_path set to the tenant's schema, followed by public. Connections
+// get their search_path restored before they are used for anything else.
+// Called on a transaction, it sets the search_path for the rest of the
+// transaction only.
+func (db *DB) ForTenant(ctx context.Context, tenantID string) (*DB, error) {
+	if db.pgBouncer {
+		return nil, fmt.Errorf("ForTenant(%s): %w", tenantID, ErrPgBouncerUnsupported)
+	}
+	schema := db.tenantSchemaName(tenantID)
+	var exists bool
+	if err := db.QueryRow(ctx, "SELECT to_regnamespace($1) IS NOT NULL", quoteIdent(schema)).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("ForTenant(%s): %w", tenantID, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("ForTenant(%s): %w", tenantID, ErrUnknownTenant)
+	}
+	if db.tx != nil {
+		if err := db.SetLocal(ctx, "search_path", searchPath(schema)); err != nil {
+			return nil, fmt.Errorf("ForTenant(%s): %w", tenantID, err)
+		}
+	}
+	tdb := *db
+	tdb.searchPath = schema
+	return &tdb, nil
+}
+
+// CreateTenant creates the tenant's schema if needed and applies the
+// migrations to it.
+func (db *DB) CreateTenant(ctx context.Context, tenantID string, migrations []Migration) error {
+	schema := db.tenantSchemaName(tenantID)
+	if _, err := db.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS "+quoteIdent(schema)); err != nil {
+		return fmt.Errorf("CreateTenant(%s): %w", tenantID, err)
+	}
+	return db.MigrateTenant(ctx, tenantID, migrations)
+}
+
+// MigrateTenant applies the pending migrations to the tenant's schema. The
+// schema has its own migrations table.
+func (db *DB) MigrateTenant(ctx context.Context, tenantID string, migrations []Migration) error {
+	tdb, err := db.ForTenant(ctx, tenantID)
+	if err != nil {
+		return fmt.Errorf("MigrateTenant(%s): %w", tenantID, err)
+	}
+	if err := NewMigrator(tdb, migrations).Up(ctx); err != nil {
+		return fmt.Errorf("MigrateTenant(%s): %w", tenantID, err)
+	}
+	return nil
+}
+
+// DropTenant drops the tenant's schema and everything in it.
+func (db *DB) DropTenant(ctx context.Context, tenantID string) error {
+	if _, err := db.Exec(ctx, "DROP SCHEMA IF EXISTS "+quoteIdent(db.tenantSchemaName(tenantID))+" CASCADE"); err != nil {
+		return fmt.Errorf("DropTenant(%s): %w", tenantID, err)
+	}
+	return nil
+}
+
+func searchPath(schema string) string {
+	return quoteIdent(schema) + ", public"
+}
+
+type searchPathKey struct{}
+
+// applySearchPath gives the connection the search_path of the operation's
+// DB before its statement or transaction starts. Inside a transaction the
+// path was already set when it began.
+func (c *wrappedConn) applySearchPath(ctx context.Context) error {
+	if c.inTx {
+		return nil
+	}
+	want, _ := ctx.Value(searchPathKey{}).(string)
+	if want == c.searchPath {
+		return nil
+	}
+	ex, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return errors.New("database: ForTenant: driver does not implement driver.ExecerContext")
+	}
+	query := "RESET search_path"
+	if want != "" {
+		query = "SET search_path TO " + searchPath(want)
+	}
+	if _, err := ex.ExecContext(ctx, query, nil); err != nil {
+		return err
+	}
+	c.searchPath = want
+	return nil
+}
@@ -0,0 +1,291 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNoTenant is returned by a TenantRouter for a context without a tenant.
+var ErrNoTenant = errors.New("database: no tenant in context")
+
+type tenantKey struct{}
+
+// WithTenant returns a context whose operations on a TenantRouter go to the
+// tenant's database.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFrom returns the tenant set by WithTenant, or "".
+func TenantFrom(ctx context.Context) string {
+	id, _ := ctx.Value(tenantKey{}).(string)
+	return id
+}
+
+type TenantRouterConfig struct {
+	Driver string
+	// DSNs maps tenant IDs to their DSNs.
+	DSNs map[string]string
+	// Lookup resolves the DSN of tenants missing from DSNs.
+	Lookup func(ctx context.Context, tenantID string) (string, error)
+	// Options are applied to every tenant's DB.
+	Options []Option
+	// MaxPools bounds the number of open tenant pools; the least recently
+	// used is closed to make room. Zero means no bound.
+	MaxPools int
+	// IdleTimeout closes the pools of tenants unused for that long. Zero
+	// means never.
+	IdleTimeout time.Duration
+	// CloseTimeout bounds how long an evicted pool waits for its in-flight
+	// work. Defaults to 30 seconds.
+	CloseTimeout time.Duration
+}
+
+// TenantRouter routes each operation to the dedicated database of the
+// tenant in its context, opening tenant pools on first use.
+type TenantRouter struct {
+	cfg TenantRouterConfig
+
+	mu      sync.Mutex
+	pools   map[string]*tenantPool
+	closed  bool
+	stop    chan struct{}
+	done    chan struct{}
+	evicted sync.WaitGroup
+}
+
+type tenantPool struct {
+	ready    chan struct{}
+	db       *DB
+	err      error
+	lastUsed time.Time
+}
+
+var _ Querier = (*TenantRouter)(nil)
+
+func NewTenantRouter(cfg TenantRouterConfig) *TenantRouter {
+	if cfg.CloseTimeout <= 0 {
+		cfg.CloseTimeout = 30 * time.Second
+	}
+	r := &TenantRouter{cfg: cfg, pools: make(map[string]*tenantPool), stop: make(chan struct{}), done: make(chan struct{})}
+	if cfg.IdleTimeout > 0 {
+		go r.janitor()
+	} else {
+		close(r.done)
+	}
+	return r
+}
+
+// DB returns the tenant's DB, opening it if needed. The pool may be evicted
+// while the caller still holds it, after which new work on it fails with
+// ErrShuttingDown; the router's own Querier methods retry such work once.
+func (r *TenantRouter) DB(ctx context.Context, tenantID string) (*DB, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("TenantRouter.DB(%s): %w", tenantID, ErrShuttingDown)
+	}
+	p, ok := r.pools[tenantID]
+	if !ok {
+		p = &tenantPool{ready: make(chan struct{})}
+		r.pools[tenantID] = p
+	}
+	p.lastUsed = time.Now()
+	r.mu.Unlock()
+
+	if !ok {
+		db, err := r.open(ctx, tenantID)
+		r.mu.Lock()
+		switch {
+		case err != nil:
+			delete(r.pools, tenantID)
+		case r.closed:
+			// Close ran while the pool was being opened.
+			db.Close()
+			db, err = nil, ErrShuttingDown
+		default:
+			r.evictLRU(tenantID)
+		}
+		p.db, p.err = db, err
+		r.mu.Unlock()
+		close(p.ready)
+	}
+	select {
+	case <-p.ready:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("TenantRouter.DB(%s): %w", tenantID, ctx.Err())
+	}
+	if p.err != nil {
+		return nil, fmt.Errorf("TenantRouter.DB(%s): %w", tenantID, p.err)
+	}
+	return p.db, nil
+}
+
+func (r *TenantRouter) open(ctx context.Context, tenantID string) (*DB, error) {
+	dsn, ok := r.cfg.DSNs[tenantID]
+	if !ok {
+		if r.cfg.Lookup == nil {
+			return nil, ErrUnknownTenant
+		}
+		var err error
+		if dsn, err = r.cfg.Lookup(ctx, tenantID); err != nil {
+			return nil, err
+		}
+	}
+	return Open(r.cfg.Driver, dsn, r.cfg.Options...)
+}
+
+// evictLRU closes the least recently used pools, other than keep, beyond
+// MaxPools. r.mu must be held.
+func (r *TenantRouter) evictLRU(keep string) {
+	for r.cfg.MaxPools > 0 && len(r.pools) > r.cfg.MaxPools {
+		oldest := ""
+		var at time.Time
+		for id, p := range r.pools {
+			if id == keep || p.db == nil {
+				continue
+			}
+			if oldest == "" || p.lastUsed.Before(at) {
+				oldest, at = id, p.lastUsed
+			}
+		}
+		if oldest == "" {
+			return
+		}
+		r.evict(oldest)
+	}
+}
+
+// evict removes the tenant's pool and shuts it down in the background, so
+// operations already running on it can finish. r.mu must be held.
+func (r *TenantRouter) evict(tenantID string) {
+	db := r.pools[tenantID].db
+	delete(r.pools, tenantID)
+	r.evicted.Add(1)
+	go func() {
+		defer r.evicted.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), r.cfg.CloseTimeout)
+		defer cancel()
+		db.Shutdown(ctx)
+	}()
+}
+
+func (r *TenantRouter) janitor() {
+	defer close(r.done)
+	t := time.NewTicker(r.cfg.IdleTimeout / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-t.C:
+		}
+		r.mu.Lock()
+		for id, p := range r.pools {
+			if p.db != nil && time.Since(p.lastUsed) > r.cfg.IdleTimeout {
+				r.evict(id)
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Close closes every tenant pool, waiting for in-flight work up to
+// CloseTimeout.
+func (r *TenantRouter) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.stop)
+	for id, p := range r.pools {
+		if p.db != nil {
+			r.evict(id)
+		}
+	}
+	r.mu.Unlock()
+	<-r.done
+	r.evicted.Wait()
+	return nil
+}
+
+func (r *TenantRouter) tenantDB(ctx context.Context) (*DB, error) {
+	id := TenantFrom(ctx)
+	if id == "" {
+		return nil, ErrNoTenant
+	}
+	return r.DB(ctx, id)
+}
+
+// tenantDo runs f on the tenant's DB. If the pool was evicted between DB
+// returning it and f starting, f fails with ErrShuttingDown without having
+// run and is retried once on a freshly opened pool. Errors of a Transaction
+// callback are never retried, since the callback did run.
+func (r *TenantRouter) tenantDo(ctx context.Context, f func(*DB) error) error {
+	db, err := r.tenantDB(ctx)
+	if err != nil {
+		return err
+	}
+	err = f(db)
+	var cerr *callbackError
+	if !errors.Is(err, ErrShuttingDown) || errors.As(err, &cerr) {
+		return err
+	}
+	if db, err = r.tenantDB(ctx); err != nil {
+		return err
+	}
+	return f(db)
+}
+
+func (r *TenantRouter) Exec(ctx context.Context, query string, args ...interface{}) (n int64, err error) {
+	err = r.tenantDo(ctx, func(db *DB) error {
+		n, err = db.Exec(ctx, query, args...)
+		return err
+	})
+	return n, err
+}
+
+func (r *TenantRouter) Query(ctx context.Context, query string, args ...interface{}) (rows *sql.Rows, err error) {
+	err = r.tenantDo(ctx, func(db *DB) error {
+		rows, err = db.Query(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+func (r *TenantRouter) QueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	var row *sql.Row
+	err := r.tenantDo(ctx, func(db *DB) error {
+		row = db.QueryRow(ctx, query, args...)
+		return row.Err()
+	})
+	// err is not row's own if no DB could be had for the (last) attempt.
+	if row == nil || err != row.Err() {
+		return errRow(err)
+	}
+	return row
+}
+
+func (r *TenantRouter) Get(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return r.tenantDo(ctx, func(db *DB) error {
+		return db.Get(ctx, dest, query, args...)
+	})
+}
+
+func (r *TenantRouter) Select(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return r.tenantDo(ctx, func(db *DB) error {
+		return db.Select(ctx, dest, query, args...)
+	})
+}
+
+func (r *TenantRouter) Transaction(ctx context.Context, iso sql.IsolationLevel, f func(*DB) error) error {
+	return r.tenantDo(ctx, func(db *DB) error {
+		return db.Transaction(ctx, iso, f)
+	})
+}
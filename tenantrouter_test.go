@@ -0,0 +1,148 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkrypt0987/database"
+	"github.com/pkrypt0987/database/fakedb"
+)
+
+// tenantDriver opens the fake registered for a DSN.
+type tenantDriver map[string]*fakedb.Fake
+
+func (d tenantDriver) Open(dsn string) (driver.Conn, error) {
+	f, ok := d[dsn]
+	if !ok {
+		return nil, fmt.Errorf("no fake for DSN %q", dsn)
+	}
+	return f.Driver().Open(dsn)
+}
+
+// tenantDrivers numbers the drivers registered, as sql.Register takes each
+// name once.
+var tenantDrivers atomic.Int64
+
+// tenantRouter returns a router over one fake per tenant, whose SELECTs
+// return the tenant's ID.
+func tenantRouter(t *testing.T, cfg database.TenantRouterConfig, tenants ...string) (*database.TenantRouter, tenantDriver) {
+	t.Helper()
+	d := tenantDriver{}
+	cfg.DSNs = map[string]string{}
+	for _, id := range tenants {
+		f := fakedb.New()
+		f.On(`^SELECT`).Return([]string{"tenant"}, []interface{}{id})
+		f.On(`^UPDATE`).ReturnRowsAffected(1)
+		d["dsn-"+id] = f
+		cfg.DSNs[id] = "dsn-" + id
+	}
+	cfg.Driver = fmt.Sprintf("fakedb-tenants-%d", tenantDrivers.Add(1))
+	sql.Register(cfg.Driver, d)
+	r := database.NewTenantRouter(cfg)
+	t.Cleanup(func() { r.Close() })
+	return r, d
+}
+
+func TestTenantRouter(t *testing.T) {
+	r, d := tenantRouter(t, database.TenantRouterConfig{
+		Lookup: func(ctx context.Context, tenantID string) (string, error) {
+			if tenantID == "c" {
+				return "dsn-c", nil
+			}
+			return "", database.ErrUnknownTenant
+		},
+	}, "a", "b")
+	c := fakedb.New()
+	c.On(`^SELECT`).Return([]string{"tenant"}, []interface{}{"c"})
+	d["dsn-c"] = c
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c", "a"} {
+		var got string
+		if err := r.Get(database.WithTenant(ctx, id), &got, "SELECT current_database()"); err != nil {
+			t.Fatalf("tenant %s: %v", id, err)
+		}
+		if got != id {
+			t.Errorf("tenant %s: query went to %s", id, got)
+		}
+	}
+	if n := len(d["dsn-a"].Calls()); n != 2 {
+		t.Errorf("tenant a got %d queries, want 2", n)
+	}
+
+	if _, err := r.Exec(ctx, "UPDATE t SET x = 1"); err != database.ErrNoTenant {
+		t.Errorf("no tenant: err = %v, want ErrNoTenant", err)
+	}
+	if _, err := r.Exec(database.WithTenant(ctx, "z"), "UPDATE t SET x = 1"); !errors.Is(err, database.ErrUnknownTenant) {
+		t.Errorf("unknown tenant: err = %v, want ErrUnknownTenant", err)
+	}
+}
+
+func TestTenantRouterEviction(t *testing.T) {
+	r, d := tenantRouter(t, database.TenantRouterConfig{MaxPools: 1}, "a", "b")
+	ctx := context.Background()
+	a := database.WithTenant(ctx, "a")
+
+	// Evicting a pool lets the work already running on it finish.
+	var old *database.DB
+	err := r.Transaction(a, sql.LevelDefault, func(tx *database.DB) error {
+		var err error
+		if old, err = r.DB(ctx, "a"); err != nil {
+			return err
+		}
+		if _, err := r.DB(ctx, "b"); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "UPDATE t SET x = 1")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("transaction on an evicted pool: %v", err)
+	}
+	if calls := d["dsn-a"].Calls(); calls[len(calls)-1].Query != "COMMIT" {
+		t.Errorf("tenant a calls %v, want the transaction committed", calls)
+	}
+
+	// New work on the evicted pool fails; the router opens a new one.
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err := old.Exec(ctx, "UPDATE t SET x = 1")
+		if errors.Is(err, database.ErrShuttingDown) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("evicted pool still accepts work: err = %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	var got string
+	if err := r.Get(a, &got, "SELECT current_database()"); err != nil || got != "a" {
+		t.Errorf("after eviction: %q, %v", got, err)
+	}
+	if db, _ := r.DB(ctx, "a"); db == old {
+		t.Error("router still hands out the evicted pool")
+	}
+
+	r.Close()
+	if _, err := r.Exec(a, "UPDATE t SET x = 1"); !errors.Is(err, database.ErrShuttingDown) {
+		t.Errorf("closed router: err = %v, want ErrShuttingDown", err)
+	}
+}
+
+func TestTenantRouterCallbackNotRetried(t *testing.T) {
+	r, _ := tenantRouter(t, database.TenantRouterConfig{}, "a")
+	runs := 0
+	err := r.Transaction(database.WithTenant(context.Background(), "a"), sql.LevelDefault, func(tx *database.DB) error {
+		runs++
+		return fmt.Errorf("downstream: %w", database.ErrShuttingDown)
+	})
+	if runs != 1 || !errors.Is(err, database.ErrShuttingDown) {
+		t.Errorf("callback ran %d times, err %v; want 1 run and its error", runs, err)
+	}
+}
@@ -0,0 +1,119 @@
+package testdb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkrypt0987/database"
+)
+
+// DatabaseURLEnv names the environment variable that, when set, points
+// StartPostgres at an existing server instead of starting a container.
+const DatabaseURLEnv = "TEST_DATABASE_URL"
+
+type Options struct {
+	// Image is the Docker image to run. Defaults to "postgres:16-alpine".
+	Image string
+	// Driver is the database/sql driver name. Defaults to "postgres".
+	Driver string
+	// Migrations are applied before the DB is returned.
+	Migrations []database.Migration
+	// StartTimeout bounds how long to wait for the server to accept
+	// connections. Defaults to one minute.
+	StartTimeout time.Duration
+}
+
+func (o *Options) setDefaults() {
+	if o.Image == "" {
+		o.Image = "postgres:16-alpine"
+	}
+	if o.Driver == "" {
+		o.Driver = "postgres"
+	}
+	if o.StartTimeout == 0 {
+		o.StartTimeout = time.Minute
+	}
+}
+
+// StartPostgres returns a migrated DB for the test. It connects to
+// TEST_DATABASE_URL if set, otherwise it starts an ephemeral Postgres
+// container with the docker CLI and removes it when the test ends. The test
+// is skipped if neither is available.
+func StartPostgres(t testing.TB, opts Options) *database.DB {
+	t.Helper()
+	opts.setDefaults()
+
+	db := connect(t, opts, serverDSN(t, opts))
+	t.Cleanup(func() { db.Close() })
+
+	if len(opts.Migrations) > 0 {
+		if err := database.NewMigrator(db, opts.Migrations).Up(context.Background()); err != nil {
+			t.Fatalf("testdb.StartPostgres(): %v", err)
+		}
+	}
+	return db
+}
+
+// serverDSN returns TEST_DATABASE_URL or the DSN of a new container.
+func serverDSN(t testing.TB, opts Options) string {
+	t.Helper()
+	if dsn := os.Getenv(DatabaseURLEnv); dsn != "" {
+		return dsn
+	}
+	return startContainer(t, opts)
+}
+
+func startContainer(t testing.TB, opts Options) string {
+	t.Helper()
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skipf("testdb.StartPostgres(): docker not found and %s not set", DatabaseURLEnv)
+	}
+	out, err := exec.Command("docker", "run", "-d", "--rm",
+		"-e", "POSTGRES_PASSWORD=postgres",
+		"-e", "POSTGRES_DB=test",
+		"-p", "127.0.0.1::5432",
+		opts.Image).Output()
+	if err != nil {
+		t.Fatalf("testdb.StartPostgres(): docker run: %v", commandError(err))
+	}
+	id := strings.TrimSpace(string(out))
+	t.Cleanup(func() {
+		exec.Command("docker", "rm", "-f", "-v", id).Run()
+	})
+
+	out, err = exec.Command("docker", "port", id, "5432/tcp").Output()
+	if err != nil {
+		t.Fatalf("testdb.StartPostgres(): docker port: %v", commandError(err))
+	}
+	// docker port may print one line per address family.
+	addr, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return fmt.Sprintf("postgres://postgres:postgres@%s/test?sslmode=disable", addr)
+}
+
+// connect opens dsn, retrying until the server accepts connections.
+func connect(t testing.TB, opts Options, dsn string) *database.DB {
+	t.Helper()
+	deadline := time.Now().Add(opts.StartTimeout)
+	for {
+		db, err := database.Open(opts.Driver, dsn)
+		if err == nil {
+			return db
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("testdb.StartPostgres(): %v", err)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+func commandError(err error) error {
+	if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(ee.Stderr)))
+	}
+	return err
+}
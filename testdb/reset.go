@@ -0,0 +1,87 @@
+package testdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/pkrypt0987/database"
+)
+
+// Reset truncates every table in the schemas of the session's search_path,
+// current_schemas(false), except database.MigrationsTable and the excluded
+// ones (by name or schema-qualified name), restarting identity sequences.
+// On a DB of Server.Isolated that is the test's own schema, so parallel
+// tests keep their data. Tables are listed so that referencing tables come before the
+// tables they reference. The seeds table is truncated too, so seeds can be
+// applied again afterwards.
+func Reset(ctx context.Context, db *database.DB, exclude ...string) error {
+	schema, err := db.Schema(ctx)
+	if err != nil {
+		return fmt.Errorf("testdb.Reset(): %w", err)
+	}
+	var current []string
+	if err := db.Select(ctx, &current, `SELECT unnest(current_schemas(false))`); err != nil {
+		return fmt.Errorf("testdb.Reset(): %w", err)
+	}
+	inPath := make(map[string]bool, len(current))
+	for _, s := range current {
+		inPath[s] = true
+	}
+	skip := map[string]bool{database.MigrationsTable: true}
+	for _, e := range exclude {
+		skip[e] = true
+	}
+
+	var tables []*database.Table
+	for _, t := range schema.Tables {
+		if inPath[t.Schema] && !skip[t.Name] && !skip[t.Schema+"."+t.Name] {
+			tables = append(tables, t)
+		}
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(tables))
+	for _, t := range dependentsFirst(schema, tables) {
+		names = append(names, pq.QuoteIdentifier(t.Schema)+"."+pq.QuoteIdentifier(t.Name))
+	}
+	if _, err := db.Exec(ctx, "TRUNCATE "+strings.Join(names, ", ")+" RESTART IDENTITY CASCADE"); err != nil {
+		return fmt.Errorf("testdb.Reset(): %w", err)
+	}
+	return nil
+}
+
+// dependentsFirst orders tables so that each table precedes the tables its
+// foreign keys reference.
+func dependentsFirst(schema *database.Schema, tables []*database.Table) []*database.Table {
+	included := make(map[*database.Table]bool)
+	for _, t := range tables {
+		included[t] = true
+	}
+	var order []*database.Table
+	visited := make(map[*database.Table]bool)
+	var visit func(t *database.Table)
+	visit = func(t *database.Table) {
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+		for _, fk := range t.ForeignKeys {
+			if ref := schema.Table(fk.RefSchema + "." + fk.RefTable); included[ref] && ref != t {
+				visit(ref)
+			}
+		}
+		order = append(order, t)
+	}
+	for _, t := range tables {
+		visit(t)
+	}
+	// order has referenced tables first; reverse it.
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
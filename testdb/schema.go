@@ -0,0 +1,76 @@
+package testdb
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/pkrypt0987/database"
+)
+
+// Server is a Postgres server shared by the tests of a package, typically
+// created once in the parent test of a group of parallel subtests.
+type Server struct {
+	opts Options
+	dsn  string
+}
+
+// NewServer connects to TEST_DATABASE_URL or starts a container that lives
+// until t ends.
+func NewServer(t testing.TB, opts Options) *Server {
+	t.Helper()
+	opts.setDefaults()
+	s := &Server{opts: opts, dsn: serverDSN(t, opts)}
+	connect(t, opts, s.dsn).Close()
+	return s
+}
+
+// DSN returns the server's data source name.
+func (s *Server) DSN() string {
+	return s.dsn
+}
+
+// Isolated creates a uniquely named schema for the test and returns a DB
+// whose connections all use it as their search_path, so parallel tests do
+// not see each other's tables. Migrations are applied inside the schema and
+// the schema is dropped when the test ends.
+func (s *Server) Isolated(t testing.TB) *database.DB {
+	t.Helper()
+	ctx := context.Background()
+	schema := "test_" + randomSuffix()
+	dsn, err := withParam(s.dsn, "search_path", schema)
+	if err != nil {
+		t.Fatalf("testdb.Isolated(): %v", err)
+	}
+	db := connect(t, s.opts, dsn)
+	t.Cleanup(func() {
+		db.Exec(ctx, "DROP SCHEMA IF EXISTS "+pq.QuoteIdentifier(schema)+" CASCADE")
+		db.Close()
+	})
+	if _, err := db.Exec(ctx, "CREATE SCHEMA "+pq.QuoteIdentifier(schema)); err != nil {
+		t.Fatalf("testdb.Isolated(): %v", err)
+	}
+	if len(s.opts.Migrations) > 0 {
+		if err := database.NewMigrator(db, s.opts.Migrations).Up(ctx); err != nil {
+			t.Fatalf("testdb.Isolated(): %v", err)
+		}
+	}
+	return db
+}
+
+// withParam returns dsn with the connection parameter key set to value.
+func withParam(dsn, key, value string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		q := u.Query()
+		q.Set(key, value)
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+	return dsn + " " + key + "=" + value, nil
+}
@@ -0,0 +1,165 @@
+package testdb
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/lib/pq"
+	"github.com/pkrypt0987/database"
+)
+
+// Template is a migrated database that per-test databases are copied from
+// with CREATE DATABASE ... TEMPLATE, which is much faster than migrating
+// each one.
+type Template struct {
+	opts  Options
+	dsn   string
+	admin *database.DB
+	name  string
+}
+
+// NewTemplate returns the template database for opts.Migrations, creating
+// and migrating it if no earlier test binary has. Templates are named after
+// a hash of the migrations, so a changed migration gets a fresh template.
+func NewTemplate(t testing.TB, opts Options) *Template {
+	t.Helper()
+	opts.setDefaults()
+	dsn := serverDSN(t, opts)
+	admin := connect(t, opts, dsn)
+	t.Cleanup(func() { admin.Close() })
+
+	tp := &Template{opts: opts, dsn: dsn, admin: admin, name: templateName(opts.Migrations)}
+	if err := tp.ensure(context.Background()); err != nil {
+		t.Fatalf("testdb.NewTemplate(): %v", err)
+	}
+	return tp
+}
+
+// Name returns the template database name.
+func (tp *Template) Name() string {
+	return tp.name
+}
+
+// Clone creates a new database from the template and returns a DB connected
+// to it. The database is dropped when the test ends.
+func (tp *Template) Clone(t testing.TB) *database.DB {
+	t.Helper()
+	ctx := context.Background()
+	name := "test_" + randomSuffix()
+	if _, err := tp.admin.Exec(ctx, "CREATE DATABASE "+pq.QuoteIdentifier(name)+" TEMPLATE "+pq.QuoteIdentifier(tp.name)); err != nil {
+		t.Fatalf("testdb.Clone(): %v", err)
+	}
+	t.Cleanup(func() {
+		tp.admin.Exec(ctx, "DROP DATABASE IF EXISTS "+pq.QuoteIdentifier(name))
+	})
+
+	dsn, err := withDatabase(tp.dsn, name)
+	if err != nil {
+		t.Fatalf("testdb.Clone(): %v", err)
+	}
+	db := connect(t, tp.opts, dsn)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// ensure creates the template if it does not exist. It is built under a
+// temporary name and renamed once migrated, so concurrent test binaries never
+// clone a half-migrated template.
+func (tp *Template) ensure(ctx context.Context) error {
+	exists, err := tp.exists(ctx)
+	if err != nil || exists {
+		return err
+	}
+
+	tmp := tp.name + "_" + randomSuffix()
+	if _, err := tp.admin.Exec(ctx, "CREATE DATABASE "+pq.QuoteIdentifier(tmp)); err != nil {
+		return err
+	}
+	drop := func() { tp.admin.Exec(ctx, "DROP DATABASE IF EXISTS "+pq.QuoteIdentifier(tmp)) }
+
+	dsn, err := withDatabase(tp.dsn, tmp)
+	if err != nil {
+		drop()
+		return err
+	}
+	db, err := database.Open(tp.opts.Driver, dsn)
+	if err != nil {
+		drop()
+		return err
+	}
+	err = database.NewMigrator(db, tp.opts.Migrations).Up(ctx)
+	db.Close()
+	if err != nil {
+		drop()
+		return err
+	}
+
+	if _, err := tp.admin.Exec(ctx, "ALTER DATABASE "+pq.QuoteIdentifier(tmp)+" RENAME TO "+pq.QuoteIdentifier(tp.name)); err != nil {
+		drop()
+		if isDuplicateDatabase(err) {
+			// Another test binary created the template first.
+			return nil
+		}
+		return err
+	}
+	_, err = tp.admin.Exec(ctx, "ALTER DATABASE "+pq.QuoteIdentifier(tp.name)+" IS_TEMPLATE true")
+	return err
+}
+
+func (tp *Template) exists(ctx context.Context) (bool, error) {
+	var exists bool
+	err := tp.admin.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`, tp.name).Scan(&exists)
+	return exists, err
+}
+
+func isDuplicateDatabase(err error) bool {
+	const duplicateDatabase = "42P04"
+	var perr *pq.Error
+	if errors.As(err, &perr) && perr.Code == duplicateDatabase {
+		return true
+	}
+	var gerr *pgconn.PgError
+	return errors.As(err, &gerr) && gerr.Code == duplicateDatabase
+}
+
+func templateName(ms []database.Migration) string {
+	h := sha256.New()
+	for _, m := range ms {
+		fmt.Fprintf(h, "%d\x00%s\x00%s\x00", m.Version, m.Name, m.SQL)
+	}
+	return "template_" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func randomSuffix() string {
+	var b [6]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+var dbnameRe = regexp.MustCompile(`(^|\s)dbname=\S*`)
+
+// withDatabase returns dsn pointed at database name. Both URL and
+// keyword/value DSNs are supported.
+func withDatabase(dsn, name string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		u.Path = "/" + name
+		return u.String(), nil
+	}
+	if dbnameRe.MatchString(dsn) {
+		return dbnameRe.ReplaceAllString(dsn, "${1}dbname="+name), nil
+	}
+	return dsn + " dbname=" + name, nil
+}
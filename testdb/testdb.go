@@ -0,0 +1,28 @@
+// Package testdb provides helpers for integration tests against a real
+// database.
+package testdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/pkrypt0987/database"
+)
+
+var errRollback = errors.New("testdb: rollback")
+
+// WithRollback runs f inside a transaction that is always rolled back, so
+// tests leave no data behind. Transaction calls made on tx run in
+// savepoints. A failing test (t.FailNow) also rolls back.
+func WithRollback(t testing.TB, db *database.DB, f func(tx *database.DB)) {
+	t.Helper()
+	err := db.Transaction(context.Background(), sql.LevelDefault, func(tx *database.DB) error {
+		f(tx.WithSavepoints())
+		return errRollback
+	})
+	if err != nil && !errors.Is(err, errRollback) {
+		t.Fatalf("testdb.WithRollback(): %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// TextSearch builds full-text search expressions over a document. User
+// input is always bound as a parameter and parsed by
+// websearch_to_tsquery, which accepts any text (quoted phrases, "or", -word)
+// without syntax errors. Document and Headline are SQL spliced into the
+// expressions and must not come from user input.
+type TextSearch struct {
+	// Document is the tsvector searched, e.g. a generated column "search"
+	// or "to_tsvector('english', title || ' ' || body)".
+	Document string
+	// Config is the text search configuration, e.g. "english". Defaults to
+	// the server's default_text_search_config.
+	Config string
+	// Headline is the text expression snippets are taken from, e.g. "body".
+	Headline string
+	// HeadlineOptions are ts_headline's options, e.g.
+	// "MaxWords=35, MinWords=15, StartSel=<b>, StopSel=</b>".
+	HeadlineOptions string
+}
+
+func (s TextSearch) config() string {
+	if s.Config == "" {
+		return ""
+	}
+	return pq.QuoteLiteral(s.Config) + "::regconfig, "
+}
+
+// TSQuery returns the tsquery of the user input bound to placeholder $n.
+func (s TextSearch) TSQuery(n int) string {
+	return "websearch_to_tsquery(" + s.config() + "$" + strconv.Itoa(n) + ")"
+}
+
+// Match returns the condition that the document matches the input at $n.
+func (s TextSearch) Match(n int) string {
+	return "(" + s.Document + ") @@ " + s.TSQuery(n)
+}
+
+// Rank returns the ts_rank of the document for the input at $n.
+func (s TextSearch) Rank(n int) string {
+	return "ts_rank(" + s.Document + ", " + s.TSQuery(n) + ")"
+}
+
+// HeadlineExpr returns the ts_headline snippet of Headline with the
+// matches of the input at $n highlighted.
+func (s TextSearch) HeadlineExpr(n int) string {
+	opts := ""
+	if s.HeadlineOptions != "" {
+		opts = ", " + pq.QuoteLiteral(s.HeadlineOptions)
+	}
+	return "ts_headline(" + s.config() + s.Headline + ", " + s.TSQuery(n) + opts + ")"
+}
+
+// Query returns a query of columns of table matching the input at $1, best
+// ranked first, with the rank selected as "rank" and, if Headline is set,
+// the snippet as "headline", so Select can scan the results into structs
+// with `db:"rank"` and `db:"headline"` fields:
+//
+//	s := database.TextSearch{Document: "search", Config: "english", Headline: "body"}
+//	err := db.Select(ctx, &posts, s.Query("posts", "id, title", 20), input)
+//
+// A limit of 0 returns every match.
+func (s TextSearch) Query(table, columns string, limit int) string {
+	query := "SELECT " + columns + ", " + s.Rank(1) + " AS rank"
+	if s.Headline != "" {
+		query += ", " + s.HeadlineExpr(1) + " AS headline"
+	}
+	query += " FROM " + quoteIdent(table) + " WHERE " + s.Match(1) + " ORDER BY rank DESC"
+	if limit > 0 {
+		query += " LIMIT " + strconv.Itoa(limit)
+	}
+	return query
+}
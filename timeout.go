@@ -0,0 +1,29 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// WithDefaultQueryTimeout gives every Exec, Query and QueryRow whose context
+// has no deadline a deadline d from now, so a forgotten timeout cannot leave
+// a connection stuck on a runaway query. For Query the deadline also bounds
+// reading the rows.
+func WithDefaultQueryTimeout(d time.Duration) Option {
+	return func(db *DB) {
+		db.queryTimeout = d
+	}
+}
+
+// statementContext applies the default query timeout to ctx. The returned
+// cancel must not be called before the statement's rows have been read, so
+// Query and QueryRow call it when their rows are closed.
+func (db *DB) statementContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, db.queryTimeout)
+}
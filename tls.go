@@ -0,0 +1,175 @@
+package database
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLSConfig configures the TLS of the connections. Certificates and keys are
+// given either as files or as PEM in memory.
+type TLSConfig struct {
+	// Mode is the sslmode: "disable", "require", "verify-ca" or
+	// "verify-full".
+	Mode string
+	// RootCAFile or RootCAPEM is the CA bundle server certificates are
+	// verified against.
+	RootCAFile string
+	RootCAPEM  []byte
+	// CertFile and KeyFile, or CertPEM and KeyPEM, are the client
+	// certificate and key.
+	CertFile string
+	KeyFile  string
+	CertPEM  []byte
+	KeyPEM   []byte
+	// ServerName overrides the host name verify-full checks the server
+	// certificate against. It is supported by OpenPgx only.
+	ServerName string
+}
+
+// WithTLS sets the TLS configuration of the connections, merged into the
+// DSN in Open and into the pgx configuration in OpenPgx. With Open, the
+// "postgres" driver accepts certificates from files or memory and the "pgx"
+// driver from files only. It has no effect with OpenDB.
+func WithTLS(cfg TLSConfig) Option {
+	return func(db *DB) {
+		db.tls = &cfg
+	}
+}
+
+func (c *TLSConfig) validate() error {
+	switch c.Mode {
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		return fmt.Errorf("database: invalid TLS mode %q", c.Mode)
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") || (c.CertPEM == nil) != (c.KeyPEM == nil) {
+		return errors.New("database: TLS client certificate and key must be given together")
+	}
+	return nil
+}
+
+// applyDSN adds the TLS parameters to dsn for driverName.
+func (c *TLSConfig) applyDSN(driverName, dsn string) (string, error) {
+	if err := c.validate(); err != nil {
+		return "", err
+	}
+	if c.ServerName != "" {
+		return "", fmt.Errorf("database: TLS ServerName is not supported with driver %q, use OpenPgx", driverName)
+	}
+	inline := c.RootCAPEM != nil || c.CertPEM != nil
+	if inline && driverName != "postgres" {
+		return "", fmt.Errorf("database: in-memory TLS certificates are not supported with driver %q", driverName)
+	}
+	params := [][2]string{{"sslmode", c.Mode}}
+	add := func(key, file string, pem []byte) error {
+		switch {
+		case inline && pem == nil && file != "":
+			b, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			params = append(params, [2]string{key, string(b)})
+		case pem != nil:
+			params = append(params, [2]string{key, string(pem)})
+		case file != "":
+			params = append(params, [2]string{key, file})
+		}
+		return nil
+	}
+	if err := add("sslrootcert", c.RootCAFile, c.RootCAPEM); err != nil {
+		return "", err
+	}
+	if err := add("sslcert", c.CertFile, c.CertPEM); err != nil {
+		return "", err
+	}
+	if err := add("sslkey", c.KeyFile, c.KeyPEM); err != nil {
+		return "", err
+	}
+	if inline {
+		params = append(params, [2]string{"sslinline", "true"})
+	}
+	for _, p := range params {
+		dsn = dsnWithParam(dsn, p[0], p[1])
+	}
+	return dsn, nil
+}
+
+// tlsConfig returns the crypto/tls configuration for host, nil for
+// "disable".
+func (c *TLSConfig) tlsConfig(host string) (*tls.Config, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	if c.Mode == "disable" {
+		return nil, nil
+	}
+	cfg := &tls.Config{ServerName: host}
+	if c.ServerName != "" {
+		cfg.ServerName = c.ServerName
+	}
+	certPEM, keyPEM := c.CertPEM, c.KeyPEM
+	if c.CertFile != "" {
+		var err error
+		if certPEM, err = os.ReadFile(c.CertFile); err != nil {
+			return nil, err
+		}
+		if keyPEM, err = os.ReadFile(c.KeyFile); err != nil {
+			return nil, err
+		}
+	}
+	if certPEM != nil {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("database: TLS client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	caPEM := c.RootCAPEM
+	if c.RootCAFile != "" {
+		var err error
+		if caPEM, err = os.ReadFile(c.RootCAFile); err != nil {
+			return nil, err
+		}
+	}
+	if caPEM != nil {
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("database: TLS root CA: no certificates found")
+		}
+	}
+	mode := c.Mode
+	if mode == "require" && caPEM != nil {
+		// As in libpq, require with a root CA verifies the chain.
+		mode = "verify-ca"
+	}
+	switch mode {
+	case "require":
+		cfg.InsecureSkipVerify = true
+	case "verify-ca":
+		// Verify the chain but not the host name.
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = func(raw [][]byte, _ [][]*x509.Certificate) error {
+			certs := make([]*x509.Certificate, len(raw))
+			for i, b := range raw {
+				cert, err := x509.ParseCertificate(b)
+				if err != nil {
+					return err
+				}
+				certs[i] = cert
+			}
+			if len(certs) == 0 {
+				return errors.New("database: server sent no certificate")
+			}
+			opts := x509.VerifyOptions{Roots: cfg.RootCAs, Intermediates: x509.NewCertPool()}
+			for _, cert := range certs[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := certs[0].Verify(opts)
+			return err
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+type txKey struct{}
+
+// NewContext returns a copy of ctx carrying tx, the *DB a Transaction
+// callback receives, so code further down can join the transaction through
+// FromContext or InContext without being passed tx.
+func NewContext(ctx context.Context, tx *DB) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// FromContext returns the transaction NewContext stored in ctx.
+func FromContext(ctx context.Context) (tx *DB, ok bool) {
+	tx, ok = ctx.Value(txKey{}).(*DB)
+	return tx, ok && tx != nil && tx.tx != nil
+}
+
+// InContext returns the transaction in ctx if it was started on db's pool,
+// and db otherwise, so that
+//
+//	db.InContext(ctx).Exec(ctx, query, args...)
+//
+// runs in the caller's transaction if there is one.
+func (db *DB) InContext(ctx context.Context) *DB {
+	if tx, ok := FromContext(ctx); ok && tx.db == db.db {
+		return tx
+	}
+	return db
+}
+
+// ExecContext is Exec in the transaction in ctx, as with InContext.
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	return db.InContext(ctx).Exec(ctx, query, args...)
+}
+
+// QueryContext is Query in the transaction in ctx, as with InContext.
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.InContext(ctx).Query(ctx, query, args...)
+}
+
+// QueryRowContext is QueryRow in the transaction in ctx, as with InContext.
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.InContext(ctx).QueryRow(ctx, query, args...)
+}
+
+// GetContext is Get in the transaction in ctx, as with InContext.
+func (db *DB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return db.InContext(ctx).Get(ctx, dest, query, args...)
+}
+
+// SelectContext is Select in the transaction in ctx, as with InContext.
+func (db *DB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return db.InContext(ctx).Select(ctx, dest, query, args...)
+}
+
+// RunInTx runs f in the transaction in ctx if there is one on db's pool, or
+// else in a new transaction that commits when f returns nil. f receives a
+// context carrying the transaction, for InContext and nested RunInTx calls.
+// On a DB from WithSavepoints, joining a transaction runs f in a savepoint,
+// so an error from f undoes only its own work.
+func (db *DB) RunInTx(ctx context.Context, f func(ctx context.Context) error) error {
+	tx := db
+	if db.tx == nil {
+		tx = db.InContext(ctx)
+	}
+	if tx.tx == nil {
+		return db.Transaction(ctx, sql.LevelDefault, func(tx *DB) error {
+			return f(NewContext(ctx, tx))
+		})
+	}
+	if db.nested {
+		return tx.Savepoint(ctx, func(sp *DB) error {
+			return f(NewContext(ctx, sp))
+		})
+	}
+	return f(NewContext(ctx, tx))
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// UnitOfWork collects operations, e.g. from several repositories taking
+// part in one service call, and runs them together in a single transaction:
+//
+//	uow := db.NewUnitOfWork(sql.LevelDefault)
+//	orders.Place(uow, order)
+//	stock.Reserve(uow, order.Items)
+//	err := uow.Commit(ctx)
+type UnitOfWork struct {
+	db  *DB
+	iso sql.IsolationLevel
+
+	mu  sync.Mutex
+	ops []uowOp
+}
+
+type uowOp struct {
+	order int
+	f     func(ctx context.Context, tx *DB) error
+}
+
+// NewUnitOfWork returns an empty unit of work whose transaction runs at
+// isolation level iso.
+func (db *DB) NewUnitOfWork(iso sql.IsolationLevel) *UnitOfWork {
+	return &UnitOfWork{db: db, iso: iso}
+}
+
+// Add registers f to run in the transaction, after the operations added
+// before it with the same order.
+func (u *UnitOfWork) Add(f func(ctx context.Context, tx *DB) error) {
+	u.AddOrdered(0, f)
+}
+
+// AddOrdered registers f to run before the operations with a greater order,
+// e.g. so inserts of parent rows precede their children however the
+// repositories were called.
+func (u *UnitOfWork) AddOrdered(order int, f func(ctx context.Context, tx *DB) error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.ops = append(u.ops, uowOp{order: order, f: f})
+}
+
+// Len returns the number of registered operations.
+func (u *UnitOfWork) Len() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.ops)
+}
+
+// Commit runs the registered operations in one transaction, stopping at
+// and rolling back on the first error, and empties the unit of work. The
+// operations get a context carrying the transaction, as with NewContext.
+func (u *UnitOfWork) Commit(ctx context.Context) error {
+	u.mu.Lock()
+	ops := u.ops
+	u.ops = nil
+	u.mu.Unlock()
+	if len(ops) == 0 {
+		return nil
+	}
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].order < ops[j].order })
+	return u.db.Transaction(ctx, u.iso, func(tx *DB) error {
+		ctx := NewContext(ctx, tx)
+		for i, op := range ops {
+			if err := op.f(ctx, tx); err != nil {
+				return fmt.Errorf("UnitOfWork.Commit(): operation %d: %w", i, err)
+			}
+		}
+		return nil
+	})
+}
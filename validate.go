@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// SchemaMismatch is a single difference between a model and its table.
+type SchemaMismatch struct {
+	Model   string
+	Table   string
+	Column  string
+	Problem string
+}
+
+func (m SchemaMismatch) String() string {
+	if m.Column == "" {
+		return fmt.Sprintf("%s (%s): %s", m.Model, m.Table, m.Problem)
+	}
+	return fmt.Sprintf("%s (%s.%s): %s", m.Model, m.Table, m.Column, m.Problem)
+}
+
+// SchemaError is returned by ValidateSchema when models and tables disagree.
+type SchemaError struct {
+	Mismatches []SchemaMismatch
+}
+
+func (e *SchemaError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "schema validation failed with %d mismatch(es):", len(e.Mismatches))
+	for _, m := range e.Mismatches {
+		b.WriteString("\n\t")
+		b.WriteString(m.String())
+	}
+	return b.String()
+}
+
+// ValidateSchema compares the `db`-tagged fields of each model against the
+// columns of its table (see Tabler) and returns a *SchemaError listing every
+// missing table or column, incompatible type, and nullable column mapped to
+// a field that cannot hold NULL.
+func (db *DB) ValidateSchema(ctx context.Context, models ...interface{}) error {
+	schema, err := db.Schema(ctx)
+	if err != nil {
+		return fmt.Errorf("ValidateSchema(): %w", err)
+	}
+	var mismatches []SchemaMismatch
+	for _, model := range models {
+		t := modelType(model)
+		if t == nil || t.Kind() != reflect.Struct {
+			return fmt.Errorf("ValidateSchema(): model %T is not a struct", model)
+		}
+		name := tableName(model)
+		table := schema.Table(name)
+		if table == nil {
+			mismatches = append(mismatches, SchemaMismatch{Model: t.String(), Table: name, Problem: "table does not exist"})
+			continue
+		}
+		for _, f := range structFields(t) {
+			mm := SchemaMismatch{Model: t.String(), Table: name, Column: f.column}
+			col := table.Column(f.column)
+			if col == nil {
+				mm.Problem = "column does not exist"
+				mismatches = append(mismatches, mm)
+				continue
+			}
+			nullable, compatible := typeCompatible(f.typ, col.UDTName)
+			if !compatible {
+				mm.Problem = fmt.Sprintf("field type %s is not compatible with column type %s", f.typ, col.UDTName)
+				mismatches = append(mismatches, mm)
+			}
+			if col.Nullable && !nullable {
+				mm.Problem = fmt.Sprintf("column is nullable but field type %s cannot hold NULL", f.typ)
+				mismatches = append(mismatches, mm)
+			}
+		}
+	}
+	if len(mismatches) > 0 {
+		return &SchemaError{Mismatches: mismatches}
+	}
+	return nil
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	bytesType   = reflect.TypeOf([]byte(nil))
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+	nullTypes = map[reflect.Type]reflect.Type{
+		reflect.TypeOf(sql.NullString{}):  reflect.TypeOf(""),
+		reflect.TypeOf(sql.NullInt64{}):   reflect.TypeOf(int64(0)),
+		reflect.TypeOf(sql.NullInt32{}):   reflect.TypeOf(int32(0)),
+		reflect.TypeOf(sql.NullInt16{}):   reflect.TypeOf(int16(0)),
+		reflect.TypeOf(sql.NullFloat64{}): reflect.TypeOf(float64(0)),
+		reflect.TypeOf(sql.NullBool{}):    reflect.TypeOf(false),
+		reflect.TypeOf(sql.NullTime{}):    timeType,
+	}
+)
+
+// typeCompatible reports whether a value of column type udt can be scanned
+// into Go type t, and whether t can hold NULL. Unknown scanner types are
+// assumed compatible.
+func typeCompatible(t reflect.Type, udt string) (nullable, compatible bool) {
+	if t.Kind() == reflect.Ptr {
+		_, ok := typeCompatible(t.Elem(), udt)
+		return true, ok
+	}
+	if u, ok := nullTypes[t]; ok {
+		_, ok := typeCompatible(u, udt)
+		return true, ok
+	}
+	if t == timeType {
+		return false, oneOf(udt, "timestamp", "timestamptz", "date", "time", "timetz")
+	}
+	if t == bytesType {
+		return true, oneOf(udt, "bytea", "json", "jsonb", "text", "varchar")
+	}
+	if reflect.PtrTo(t).Implements(scannerType) {
+		return true, true
+	}
+	switch t.Kind() {
+	case reflect.String:
+		// Enums and domains report their own udt name, so anything that is
+		// not clearly numeric, boolean or binary is accepted.
+		return false, !oneOf(udt, "int2", "int4", "int8", "float4", "float8", "bool", "bytea")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return false, oneOf(udt, "int2", "int4", "int8", "numeric", "oid")
+	case reflect.Float32, reflect.Float64:
+		return false, oneOf(udt, "float4", "float8", "numeric", "int2", "int4", "int8")
+	case reflect.Bool:
+		return false, udt == "bool"
+	case reflect.Slice, reflect.Map:
+		return true, strings.HasPrefix(udt, "_") || oneOf(udt, "json", "jsonb")
+	}
+	return false, true
+}
+
+func oneOf(s string, vs ...string) bool {
+	for _, v := range vs {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	pgconn5 "github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+// Violation describes the constraint violation of a server error, for
+// mapping it to a response such as 409 Conflict or 422 Unprocessable
+// Entity.
+type Violation struct {
+	// Code is the SQLSTATE code.
+	Code       string
+	Constraint string
+	Schema     string
+	Table      string
+	// Column is the column the server reported, or for a unique or foreign
+	// key violation the first column of the key in the error detail.
+	Column string
+	// Detail is the server's detail message. It may contain the values
+	// involved.
+	Detail string
+}
+
+// serverError returns the fields of a server error from lib/pq or either
+// pgx version.
+func serverError(err error) (Violation, bool) {
+	var perr *pq.Error
+	if errors.As(err, &perr) {
+		return Violation{Code: string(perr.Code), Constraint: perr.Constraint, Schema: perr.Schema, Table: perr.Table, Column: perr.Column, Detail: perr.Detail}, true
+	}
+	var gerr *pgconn.PgError
+	if errors.As(err, &gerr) {
+		return Violation{Code: gerr.Code, Constraint: gerr.ConstraintName, Schema: gerr.SchemaName, Table: gerr.TableName, Column: gerr.ColumnName, Detail: gerr.Detail}, true
+	}
+	var g5err *pgconn5.PgError
+	if errors.As(err, &g5err) {
+		return Violation{Code: g5err.Code, Constraint: g5err.ConstraintName, Schema: g5err.SchemaName, Table: g5err.TableName, Column: g5err.ColumnName, Detail: g5err.Detail}, true
+	}
+	return Violation{}, false
+}
+
+// SQLState returns the SQLSTATE code of the server error err wraps, from
+// lib/pq or pgx, or "" if it wraps none, e.g. "23505" for a
+// unique_violation.
+func SQLState(err error) string {
+	v, _ := serverError(err)
+	return v.Code
+}
+
+func violation(err error, code string) (Violation, bool) {
+	v, ok := serverError(err)
+	if !ok || v.Code != code {
+		return Violation{}, false
+	}
+	if v.Column == "" {
+		if m := keyDetail.FindStringSubmatch(v.Detail); m != nil {
+			col, _, _ := strings.Cut(m[1], ",")
+			v.Column = strings.Trim(strings.TrimSpace(col), `"`)
+		}
+	}
+	return v, true
+}
+
+// IsUniqueViolation reports whether err is a unique_violation (23505),
+// e.g. a duplicate e-mail address.
+func IsUniqueViolation(err error) (Violation, bool) {
+	return violation(err, "23505")
+}
+
+// UniqueViolation returns the name of the unique constraint err violates.
+func UniqueViolation(err error) (constraint string, ok bool) {
+	v, ok := IsUniqueViolation(err)
+	return v.Constraint, ok
+}
+
+// WithConstraintFields maps constraint names to the user-facing field
+// names UniqueViolationField reports, e.g. {"users_email_key": "email"}.
+func WithConstraintFields(fields map[string]string) Option {
+	return func(db *DB) {
+		if db.constraintFields == nil {
+			db.constraintFields = map[string]string{}
+		}
+		for c, f := range fields {
+			db.constraintFields[c] = f
+		}
+	}
+}
+
+// UniqueViolationField returns the field whose value err reports as
+// already taken, for responses such as "email already exists": the field
+// WithConstraintFields maps the constraint to, or else the first key
+// column.
+func (db *DB) UniqueViolationField(err error) (field string, ok bool) {
+	v, ok := IsUniqueViolation(err)
+	if !ok {
+		return "", false
+	}
+	if f, ok := db.constraintFields[v.Constraint]; ok {
+		return f, true
+	}
+	return v.Column, true
+}
+
+// IsForeignKeyViolation reports whether err is a foreign_key_violation
+// (23503): a referenced row does not exist, or is still referenced.
+func IsForeignKeyViolation(err error) (Violation, bool) {
+	return violation(err, "23503")
+}
+
+// IsNotNullViolation reports whether err is a not_null_violation (23502).
+func IsNotNullViolation(err error) (Violation, bool) {
+	return violation(err, "23502")
+}
+
+// IsCheckViolation reports whether err is a check_violation (23514).
+func IsCheckViolation(err error) (Violation, bool) {
+	return violation(err, "23514")
+}
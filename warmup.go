@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// WithWarmupQueries registers statements that Warmup prepares on every
+// connection it opens. Parsing them loads the catalog entries they use into
+// the new backend's caches, which the first real execution would otherwise
+// pay for.
+func WithWarmupQueries(queries ...string) Option {
+	return func(db *DB) {
+		db.warmupQueries = append(db.warmupQueries, queries...)
+	}
+}
+
+// Warmup opens n connections, or as many as the pool allows, pings them and
+// prepares the WithWarmupQueries statements on each, then returns them to
+// the pool, so the first burst of traffic after a deploy doesn't wait for
+// connections to be established. Connections beyond the idle limit are
+// closed again when returned.
+func (db *DB) Warmup(ctx context.Context, n int) error {
+	if max := db.db.Stats().MaxOpenConnections; max > 0 && n > max {
+		n = max
+	}
+	conns := make([]*sql.Conn, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conns[i], errs[i] = db.warmConn(ctx)
+		}(i)
+	}
+	wg.Wait()
+	// Only release them once all are open, so each is a distinct connection.
+	for _, c := range conns {
+		if c != nil {
+			c.Close()
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("Warmup(): %w", err)
+	}
+	return nil
+}
+
+func (db *DB) warmConn(ctx context.Context) (*sql.Conn, error) {
+	c, err := db.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.PingContext(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+	for _, q := range db.warmupQueries {
+		stmt, err := c.PrepareContext(ctx, q)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("prepare %q: %w", q, err)
+		}
+		stmt.Close()
+	}
+	return c, nil
+}
@@ -0,0 +1,112 @@
+// Package zaplog logs the statements of a database.DB to a zap.Logger:
+//
+//	db, err := database.Open("postgres", dsn, zaplog.Logging(logger, zaplog.Config{
+//		SlowThreshold: 200 * time.Millisecond,
+//		Sampling:      &zaplog.Sampling{Tick: time.Second, First: 10, Thereafter: 100},
+//	}))
+//
+// Each Exec and Query, and so Get and Select, is logged with its op,
+// fingerprint, text, duration, error and the labels of database.WithLabel,
+// never its arguments. The logging is an AfterQuery database.Hook, so it
+// combines with the DB's other hooks, such as those of WithQueryStats.
+package zaplog
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkrypt0987/database"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Config configures the logging of Logging.
+type Config struct {
+	// Level is the level of successful statements. Defaults to Info.
+	Level zapcore.Level
+	// SlowThreshold, if set, logs successful statements taking at least
+	// that long at Warn, unsampled.
+	SlowThreshold time.Duration
+	// Sampling, if set, limits how many successful statements are logged.
+	// Slow and failed statements, logged at Warn and Error, are not
+	// sampled.
+	Sampling *Sampling
+}
+
+// Sampling limits the logs of high-volume statements. Each fingerprint is
+// sampled on its own, so a hot statement does not crowd out the others:
+// in every Tick its First statements are logged, then every Thereafter-th.
+type Sampling struct {
+	Tick       time.Duration
+	First      int
+	Thereafter int
+}
+
+// Logging returns the option that logs the DB's statements to l.
+func Logging(l *zap.Logger, cfg Config) database.Option {
+	var s *sampler
+	if cfg.Sampling != nil {
+		s = &sampler{Sampling: *cfg.Sampling, counts: make(map[string]*count)}
+	}
+	return database.WithHook(database.HookFuncs{AfterQueryFunc: func(ctx context.Context, e database.QueryEvent) {
+		level, msg := cfg.Level, "query"
+		switch {
+		case e.Err != nil:
+			level, msg = zapcore.ErrorLevel, "query failed"
+		case cfg.SlowThreshold > 0 && e.Duration >= cfg.SlowThreshold:
+			level, msg = zapcore.WarnLevel, "slow query"
+		case s != nil && !s.sample(e.Fingerprint):
+			return
+		}
+		ce := l.Check(level, msg)
+		if ce == nil {
+			return
+		}
+		fields := make([]zap.Field, 0, 5+len(e.Labels))
+		fields = append(fields,
+			zap.String("db.op", e.Op),
+			zap.String("db.fingerprint", e.Fingerprint),
+			zap.String("db.query", e.Query),
+			zap.Duration("duration", e.Duration),
+		)
+		if e.Err != nil {
+			fields = append(fields, zap.Error(e.Err))
+		}
+		for k, v := range e.Labels {
+			fields = append(fields, zap.String(k, v))
+		}
+		ce.Write(fields...)
+	}})
+}
+
+type sampler struct {
+	Sampling
+	mu     sync.Mutex
+	counts map[string]*count
+}
+
+type count struct {
+	start time.Time
+	n     int
+}
+
+// sample reports whether to log a statement of fingerprint fp.
+func (s *sampler) sample(fp string) bool {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.counts[fp]
+	if c == nil {
+		c = &count{start: now}
+		s.counts[fp] = c
+	}
+	if now.Sub(c.start) >= s.Tick {
+		c.start, c.n = now, 0
+	}
+	c.n++
+	if c.n <= s.First {
+		return true
+	}
+	return s.Thereafter > 0 && (c.n-s.First)%s.Thereafter == 0
+}
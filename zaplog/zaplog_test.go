@@ -0,0 +1,46 @@
+package zaplog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSamplerSample(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		sampling Sampling
+		want     []bool
+	}{
+		{"first and every third", Sampling{Tick: time.Hour, First: 2, Thereafter: 3},
+			[]bool{true, true, false, false, true, false, false, true}},
+		{"first only", Sampling{Tick: time.Hour, First: 2},
+			[]bool{true, true, false, false, false}},
+		{"thereafter only", Sampling{Tick: time.Hour, Thereafter: 2},
+			[]bool{false, true, false, true}},
+	} {
+		s := &sampler{Sampling: c.sampling, counts: make(map[string]*count)}
+		for i, want := range c.want {
+			if got := s.sample("a"); got != want {
+				t.Errorf("%s: statement %d sampled = %v, want %v", c.name, i+1, got, want)
+			}
+		}
+	}
+}
+
+func TestSamplerPerFingerprintAndTick(t *testing.T) {
+	s := &sampler{Sampling: Sampling{Tick: time.Hour, First: 1}, counts: make(map[string]*count)}
+	if !s.sample("a") || s.sample("a") {
+		t.Fatal("want only the first statement of a sampled")
+	}
+	if !s.sample("b") {
+		t.Error("b was not sampled; fingerprints must be counted apart")
+	}
+	// A new tick starts the count again.
+	s.counts["a"].start = time.Now().Add(-time.Hour)
+	if !s.sample("a") {
+		t.Error("a was not sampled in a new tick")
+	}
+	if s.sample("a") {
+		t.Error("a was sampled twice in a tick")
+	}
+}